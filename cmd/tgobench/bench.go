@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tgo-team/tgo-core/tgo/client"
+)
+
+// groupIDBase 群组管道ID的起始值 避免和客户端ID（个人管道ID）冲突
+const groupIDBase uint64 = 1 << 40
+
+// config 压测参数
+type config struct {
+	Addr         string        // 服务端TCP地址
+	Clients      int           // 客户端数量
+	ConnectRate  int           // 每秒最多建立多少个连接 0表示不限制
+	Duration     time.Duration // 发送消息的时长
+	Rate         int           // 所有客户端每秒一共发送多少条消息 0表示不限制（每个客户端收到Msgack后立即发送下一条）
+	GroupRatio   float64       // 群组消息的比例 0~1
+	GroupSize    int           // 每个群组的成员数量
+	PayloadSize  int           // 消息内容的大小 单位byte 最小为8（发送时间）
+	Timeout      time.Duration // 连接和等待Msgack的超时时间
+	DrainTimeout time.Duration // 发送结束后等待消息投递完成的最长时间
+}
+
+// provisioner 压测前准备客户端和群组
+type provisioner interface {
+	AddClient(clientID uint64, password string) error
+	AddGroup(groupID uint64, members []uint64) error
+}
+
+func clientPassword(clientID uint64) string {
+	return "bench" + strconv.FormatUint(clientID, 10)
+}
+
+// latencies 记录耗时并计算百分位
+type latencies struct {
+	values []time.Duration
+	sync.Mutex
+}
+
+func (l *latencies) add(d time.Duration) {
+	l.Lock()
+	l.values = append(l.values, d)
+	l.Unlock()
+}
+
+func (l *latencies) sorted() []time.Duration {
+	l.Lock()
+	values := append([]time.Duration(nil), l.values...)
+	l.Unlock()
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	return values
+}
+
+// percentile 已排序的耗时的百分位 p为0~100
+func percentile(values []time.Duration, p float64) time.Duration {
+	if len(values) == 0 {
+		return 0
+	}
+	index := int(float64(len(values))*p/100+0.5) - 1
+	if index < 0 {
+		index = 0
+	}
+	if index >= len(values) {
+		index = len(values) - 1
+	}
+	return values[index]
+}
+
+// report 压测结果
+type report struct {
+	Clients        int
+	Connected      int64
+	ConnectErrors  int64
+	Disconnects    int64
+	Sent           int64
+	SendErrors     int64
+	Expected       int64 // 应该收到的消息数量（在线的接收者）
+	Delivered      int64
+	SendDuration   time.Duration
+	ConnectLatency []time.Duration // 已排序
+	DeliverLatency []time.Duration // 已排序
+}
+
+func rate(n int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(n) / d.Seconds()
+}
+
+func ratio(n, total int64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return float64(n) * 100 / float64(total)
+}
+
+func formatLatency(values []time.Duration) string {
+	return fmt.Sprintf("p50 %v  p90 %v  p99 %v  max %v",
+		percentile(values, 50), percentile(values, 90), percentile(values, 99), percentile(values, 100))
+}
+
+func (r *report) print(w io.Writer) {
+	fmt.Fprintf(w, "连接: 成功 %d/%d  失败 %d (%.2f%%)  断线 %d\n",
+		r.Connected, r.Clients, r.ConnectErrors, ratio(r.ConnectErrors, int64(r.Clients)), r.Disconnects)
+	fmt.Fprintf(w, "连接耗时: %s\n", formatLatency(r.ConnectLatency))
+	fmt.Fprintf(w, "发送: 成功 %d  失败 %d (%.2f%%)  吞吐 %.1f msg/s\n",
+		r.Sent, r.SendErrors, ratio(r.SendErrors, r.Sent+r.SendErrors), rate(r.Sent, r.SendDuration))
+	fmt.Fprintf(w, "投递: 收到 %d/%d  丢失 %.2f%%  吞吐 %.1f msg/s\n",
+		r.Delivered, r.Expected, ratio(r.Expected-r.Delivered, r.Expected), rate(r.Delivered, r.SendDuration))
+	fmt.Fprintf(w, "投递耗时: %s\n", formatLatency(r.DeliverLatency))
+}
+
+// bench 模拟多个客户端 发送的消息内容前8个字节为发送时间（UnixNano） 收到后计算端到端的投递耗时
+type bench struct {
+	cfg            *config
+	clients        []*client.Client // 下标为clientID-1 连接失败的为nil
+	groups         [][]uint64       // 下标为groupID-groupIDBase
+	connectLatency latencies
+	deliverLatency latencies
+	connectErrors  atomic.Int64
+	disconnects    atomic.Int64
+	sent           atomic.Int64
+	sendErrors     atomic.Int64
+	expected       atomic.Int64
+	delivered      atomic.Int64
+}
+
+func newBench(cfg *config) *bench {
+	b := &bench{cfg: cfg}
+	if cfg.GroupSize > 0 && cfg.GroupRatio > 0 {
+		for start := 1; start <= cfg.Clients; start += cfg.GroupSize {
+			members := make([]uint64, 0, cfg.GroupSize)
+			for clientID := start; clientID < start+cfg.GroupSize && clientID <= cfg.Clients; clientID++ {
+				members = append(members, uint64(clientID))
+			}
+			b.groups = append(b.groups, members)
+		}
+	}
+	return b
+}
+
+func (b *bench) clientGroup(clientID uint64) int {
+	return int(clientID-1) / b.cfg.GroupSize
+}
+
+// provision 添加客户端和群组
+func (b *bench) provision(p provisioner) error {
+	for i := 1; i <= b.cfg.Clients; i++ {
+		if err := p.AddClient(uint64(i), clientPassword(uint64(i))); err != nil {
+			return fmt.Errorf("添加客户端[%d]失败！-> %v", i, err)
+		}
+	}
+	for i, members := range b.groups {
+		if err := p.AddGroup(groupIDBase+uint64(i), members); err != nil {
+			return fmt.Errorf("添加群组[%d]失败！-> %v", groupIDBase+uint64(i), err)
+		}
+	}
+	return nil
+}
+
+// run 按ConnectRate建立连接 然后发送Duration时长的消息 最后等待投递完成
+func (b *bench) run() *report {
+	b.connect()
+	defer b.close()
+
+	start := time.Now()
+	b.send()
+	b.drain()
+	r := &report{
+		Clients:        b.cfg.Clients,
+		ConnectErrors:  b.connectErrors.Load(),
+		Disconnects:    b.disconnects.Load(),
+		Sent:           b.sent.Load(),
+		SendErrors:     b.sendErrors.Load(),
+		Expected:       b.expected.Load(),
+		Delivered:      b.delivered.Load(),
+		SendDuration:   time.Since(start),
+		ConnectLatency: b.connectLatency.sorted(),
+		DeliverLatency: b.deliverLatency.sorted(),
+	}
+	r.Connected = int64(r.Clients) - r.ConnectErrors
+	return r
+}
+
+func (b *bench) connect() {
+	b.clients = make([]*client.Client, b.cfg.Clients)
+	var interval time.Duration
+	if b.cfg.ConnectRate > 0 {
+		interval = time.Second / time.Duration(b.cfg.ConnectRate)
+	}
+	var wg sync.WaitGroup
+	next := time.Now()
+	for i := range b.clients {
+		if interval > 0 {
+			time.Sleep(time.Until(next))
+			next = next.Add(interval)
+		}
+		clientID := uint64(i + 1)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := client.New(&client.Options{
+				Addr:             b.cfg.Addr,
+				ClientID:         clientID,
+				Password:         clientPassword(clientID),
+				Timeout:          b.cfg.Timeout,
+				OnMessage:        func(msg *client.Message) { b.receive(clientID, msg) },
+				OnConnectionLost: func(err error) { b.disconnects.Add(1) },
+			})
+			start := time.Now()
+			if err := c.Connect(); err != nil {
+				b.connectErrors.Add(1)
+				return
+			}
+			b.connectLatency.add(time.Since(start))
+			b.clients[clientID-1] = c
+		}()
+	}
+	wg.Wait()
+}
+
+func (b *bench) receive(clientID uint64, msg *client.Message) {
+	if msg.From == clientID || len(msg.Payload) < 8 { // 群组消息也会投递给发送者自己
+		return
+	}
+	sentAt := int64(binary.BigEndian.Uint64(msg.Payload))
+	b.deliverLatency.add(time.Duration(time.Now().UnixNano() - sentAt))
+	b.delivered.Add(1)
+}
+
+func (b *bench) send() {
+	online := make([]uint64, 0, len(b.clients))
+	for i, c := range b.clients {
+		if c != nil {
+			online = append(online, uint64(i+1))
+		}
+	}
+	if len(online) == 0 {
+		return
+	}
+	var interval time.Duration
+	if b.cfg.Rate > 0 {
+		interval = time.Duration(float64(time.Second) * float64(len(online)) / float64(b.cfg.Rate))
+	}
+	deadline := time.Now().Add(b.cfg.Duration)
+	var wg sync.WaitGroup
+	for _, clientID := range online {
+		wg.Add(1)
+		go func(clientID uint64) {
+			defer wg.Done()
+			random := rand.New(rand.NewSource(int64(clientID) ^ time.Now().UnixNano()))
+			payload := make([]byte, max(b.cfg.PayloadSize, 8))
+			random.Read(payload[8:])
+			// 错开每个客户端第一次发送的时间
+			next := time.Now()
+			if interval > 0 {
+				next = next.Add(time.Duration(random.Int63n(int64(interval))))
+			}
+			for time.Now().Before(deadline) {
+				if interval > 0 {
+					time.Sleep(time.Until(next))
+					next = next.Add(interval)
+				}
+				channelID, expected := b.pickTarget(random, clientID, online)
+				if channelID == 0 {
+					return
+				}
+				binary.BigEndian.PutUint64(payload, uint64(time.Now().UnixNano()))
+				// 先计入应收数量 避免消息比Msgack先到达时丢失率为负
+				b.expected.Add(expected)
+				ctx, cancel := context.WithTimeout(context.Background(), b.cfg.Timeout)
+				_, err := b.clients[clientID-1].Send(ctx, channelID, append([]byte(nil), payload...))
+				cancel()
+				if err != nil {
+					b.expected.Add(-expected)
+					b.sendErrors.Add(1)
+					continue
+				}
+				b.sent.Add(1)
+			}
+		}(clientID)
+	}
+	wg.Wait()
+}
+
+// pickTarget 按GroupRatio选择发送到自己的群组或者随机一个在线的客户端 返回管道ID和应该收到消息的在线客户端数量
+func (b *bench) pickTarget(random *rand.Rand, clientID uint64, online []uint64) (uint64, int64) {
+	if len(b.groups) > 0 && random.Float64() < b.cfg.GroupRatio {
+		group := b.clientGroup(clientID)
+		var expected int64
+		for _, member := range b.groups[group] {
+			if member != clientID && b.clients[member-1] != nil {
+				expected++
+			}
+		}
+		return groupIDBase + uint64(group), expected
+	}
+	if len(online) < 2 {
+		return 0, 0
+	}
+	for {
+		to := online[random.Intn(len(online))]
+		if to != clientID {
+			return to, 1
+		}
+	}
+}
+
+// drain 等待消息全部投递 超过DrainTimeout不再等待（未收到的计为丢失）
+func (b *bench) drain() {
+	deadline := time.Now().Add(b.cfg.DrainTimeout)
+	for b.delivered.Load() < b.expected.Load() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (b *bench) close() {
+	var wg sync.WaitGroup
+	for _, c := range b.clients {
+		if c == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(c *client.Client) {
+			defer wg.Done()
+			c.Close()
+		}(c)
+	}
+	wg.Wait()
+}
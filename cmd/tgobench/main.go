@@ -0,0 +1,208 @@
+// tgobench 模拟多个客户端压测tgo 统计连接耗时、端到端投递耗时、吞吐和错误率
+//
+//	tgobench -clients 1000 -connect-rate 200 -duration 30s -rate 5000 -group-ratio 0.2 -group-size 50
+//
+// 默认在进程内启动一个tgo（监听回环地址 数据保存在临时目录） 指定-addr时压测已经运行的tgo
+// 此时通过管理接口（-admin-addr、-token）添加客户端和群组
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tgo-team/tgo-core/tgo"
+	"github.com/tgo-team/tgo-core/tgo/protocol"
+	"github.com/tgo-team/tgo-core/tgo/server/tcp"
+	"github.com/tgo-team/tgo-core/tgo/storage"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	cfg := &config{}
+	flagSet := flag.NewFlagSet("tgobench", flag.ContinueOnError)
+	flagSet.SetOutput(stderr)
+	flagSet.StringVar(&cfg.Addr, "addr", "", "压测已经运行的tgo的TCP地址 为空时在进程内启动tgo")
+	adminAddr := flagSet.String("admin-addr", "http://127.0.0.1:4444", "指定-addr时 用于添加客户端和群组的管理接口地址")
+	token := flagSet.String("token", os.Getenv("TGO_ADMIN_TOKEN"), "管理接口的token")
+	configPath := flagSet.String("config", "", "进程内启动tgo时使用的配置文件")
+	flagSet.IntVar(&cfg.Clients, "clients", 100, "客户端数量")
+	flagSet.IntVar(&cfg.ConnectRate, "connect-rate", 0, "每秒最多建立多少个连接 0表示不限制")
+	flagSet.DurationVar(&cfg.Duration, "duration", 10*time.Second, "发送消息的时长")
+	flagSet.IntVar(&cfg.Rate, "rate", 1000, "所有客户端每秒一共发送多少条消息 0表示不限制")
+	flagSet.Float64Var(&cfg.GroupRatio, "group-ratio", 0, "群组消息的比例 0~1")
+	flagSet.IntVar(&cfg.GroupSize, "group-size", 10, "每个群组的成员数量")
+	flagSet.IntVar(&cfg.PayloadSize, "payload", 64, "消息内容的大小 单位byte")
+	flagSet.DurationVar(&cfg.Timeout, "timeout", 10*time.Second, "连接和等待Msgack的超时时间")
+	flagSet.DurationVar(&cfg.DrainTimeout, "drain-timeout", 5*time.Second, "发送结束后等待消息投递完成的最长时间")
+	flagSet.Usage = func() {
+		fmt.Fprintf(stderr, "用法: tgobench [参数]\n\n参数:\n")
+		flagSet.PrintDefaults()
+	}
+	if err := flagSet.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if err := cfg.validate(); err != nil {
+		fmt.Fprintf(stderr, "tgobench: %v\n", err)
+		return 2
+	}
+
+	b := newBench(cfg)
+	var err error
+	if cfg.Addr == "" {
+		var stop func()
+		stop, err = startEmbedded(cfg, *configPath, b)
+		if err == nil {
+			defer stop()
+		}
+	} else {
+		err = b.provision(&adminProvisioner{addr: strings.TrimRight(*adminAddr, "/"), token: *token, http: &http.Client{}})
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "tgobench: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "压测 %s: 客户端 %d  时长 %v  速率 %d msg/s  群组比例 %.2f  群组大小 %d  消息大小 %dB\n",
+		cfg.Addr, cfg.Clients, cfg.Duration, cfg.Rate, cfg.GroupRatio, cfg.GroupSize, cfg.PayloadSize)
+	b.run().print(stdout)
+	return 0
+}
+
+func (c *config) validate() error {
+	switch {
+	case c.Clients <= 0:
+		return errors.New("clients必须大于0！")
+	case c.GroupRatio < 0 || c.GroupRatio > 1:
+		return errors.New("group-ratio必须在0~1之间！")
+	case c.GroupRatio > 0 && c.GroupSize < 2:
+		return errors.New("发送群组消息时group-size必须大于1！")
+	case c.ConnectRate < 0 || c.Rate < 0 || c.PayloadSize < 0:
+		return errors.New("connect-rate、rate和payload不能为负数！")
+	case c.Timeout <= 0:
+		return errors.New("timeout必须大于0！")
+	}
+	return nil
+}
+
+// startEmbedded 在进程内启动tgo并直接通过存储添加客户端和群组
+func startEmbedded(cfg *config, configPath string, b *bench) (func(), error) {
+	opts, err := tgo.LoadOptions(configPath)
+	if err != nil {
+		return nil, err
+	}
+	dataPath, err := os.MkdirTemp("", "tgobench")
+	if err != nil {
+		return nil, err
+	}
+	opts.DataPath = dataPath
+	opts.TCPAddress = "127.0.0.1:0"
+	opts.HTTPAddress = ""
+	opts.LogLevel = tgo.ErrorLevel
+	opts.Pro = protocol.New()
+	tg, err := tgo.NewBuilder(opts).Server(tcp.New).Storage(storage.New).Build()
+	if err == nil {
+		tg.MatchDefaultHandlers()
+		err = tg.Start()
+		if err != nil {
+			tg.Stop()
+		}
+	}
+	if err != nil {
+		os.RemoveAll(dataPath)
+		return nil, err
+	}
+	stop := func() {
+		tg.Stop()
+		os.RemoveAll(dataPath)
+	}
+	if err = b.provision(&storageProvisioner{tg: tg}); err != nil {
+		stop()
+		return nil, err
+	}
+	cfg.Addr = tg.Servers[0].(*tcp.Server).Addr().String()
+	return stop, nil
+}
+
+type storageProvisioner struct {
+	tg *tgo.TGO
+}
+
+func (p *storageProvisioner) AddClient(clientID uint64, password string) error {
+	return p.tg.Storage.AddClient(tgo.NewClient(clientID, password))
+}
+
+func (p *storageProvisioner) AddGroup(groupID uint64, members []uint64) error {
+	if err := p.tg.Storage.AddChannel(tgo.NewChannelModel(groupID, tgo.ChannelTypeGroup)); err != nil {
+		return err
+	}
+	for _, clientID := range members {
+		if err := p.tg.Storage.Bind(clientID, groupID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// adminProvisioner 通过管理接口添加客户端和群组
+type adminProvisioner struct {
+	addr  string
+	token string
+	http  *http.Client
+}
+
+func (p *adminProvisioner) AddClient(clientID uint64, password string) error {
+	return p.do("POST", "/clients", &tgo.AdminClient{ClientID: clientID, Password: password})
+}
+
+func (p *adminProvisioner) AddGroup(groupID uint64, members []uint64) error {
+	if err := p.do("POST", "/channels", &tgo.AdminChannel{ChannelID: groupID, ChannelType: tgo.ChannelTypeGroup}); err != nil {
+		return err
+	}
+	path := "/channels/" + strconv.FormatUint(groupID, 10) + "/clients"
+	for _, clientID := range members {
+		if err := p.do("POST", path, &tgo.AdminClient{ClientID: clientID}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *adminProvisioner) do(method, path string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(method, p.addr+"/admin"+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+p.token)
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var adminErr tgo.AdminError
+		if json.NewDecoder(resp.Body).Decode(&adminErr) == nil && adminErr.Error != "" {
+			return fmt.Errorf("%s %s: %s", method, path, adminErr.Error)
+		}
+		return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	values := make([]time.Duration, 100)
+	for i := range values {
+		values[i] = time.Duration(i+1) * time.Millisecond
+	}
+	tests := map[float64]time.Duration{
+		50:  50 * time.Millisecond,
+		99:  99 * time.Millisecond,
+		100: 100 * time.Millisecond,
+		0:   time.Millisecond,
+	}
+	for p, want := range tests {
+		if got := percentile(values, p); got != want {
+			t.Fatalf("p%v应该为%v，实际为%v", p, want, got)
+		}
+	}
+	if percentile(nil, 50) != 0 {
+		t.Fatal("没有数据时百分位应该为0")
+	}
+}
+
+func TestRun_embedded(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := run([]string{
+		"-clients", "6",
+		"-duration", "300ms",
+		"-rate", "200",
+		"-group-ratio", "0.5",
+		"-group-size", "3",
+	}, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("退出码应该为0，实际为%d -> %s", code, stderr.String())
+	}
+	output := stdout.String()
+	for _, want := range []string{"连接: 成功 6/6", "投递耗时: p50"} {
+		if !strings.Contains(output, want) {
+			t.Fatalf("输出应该包含[%s] -> %s", want, output)
+		}
+	}
+	if strings.Contains(output, "发送: 成功 0 ") {
+		t.Fatalf("应该有发送成功的消息 -> %s", output)
+	}
+}
+
+func TestRun_invalidFlags(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-group-ratio", "0.5", "-group-size", "1"}, &stdout, &stderr); code != 2 {
+		t.Fatalf("参数错误退出码应该为2，实际为%d", code)
+	}
+}
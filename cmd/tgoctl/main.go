@@ -0,0 +1,321 @@
+// tgoctl 通过管理接口（/admin）查看和操作运行中的tgo
+//
+//	tgoctl -addr http://127.0.0.1:4444 -token <AdminToken> conns
+//
+// addr和token也可以通过环境变量TGOCTL_ADDR和TGO_ADMIN_TOKEN设置
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tgo-team/tgo-core/tgo"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+var commands = []struct {
+	name  string
+	usage string
+	run   func(c *ctl, args []string) error
+}{
+	{"conns", "conns                                 在线连接", (*ctl).conns},
+	{"client", "client <clientID>                     客户端的管道和未确认的消息数量", (*ctl).client},
+	{"channel", "channel <channelID>                   管道的统计", (*ctl).channel},
+	{"send", "send [-from id] <channelID> <payload> 发送测试消息到管道", (*ctl).send},
+	{"kick", "kick <clientID>                       断开客户端的连接", (*ctl).kick},
+	{"tail", "tail [-client id]                     实时查看收到的包", (*ctl).tail},
+	{"stats", "stats                                 服务统计", (*ctl).stats},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	flagSet := flag.NewFlagSet("tgoctl", flag.ContinueOnError)
+	flagSet.SetOutput(stderr)
+	addr := flagSet.String("addr", envOr("TGOCTL_ADDR", "http://127.0.0.1:4444"), "tgo的HTTP地址")
+	token := flagSet.String("token", os.Getenv("TGO_ADMIN_TOKEN"), "管理接口的token")
+	output := flagSet.String("o", outputTable, "输出格式 table或json")
+	flagSet.Usage = func() {
+		fmt.Fprintf(stderr, "用法: tgoctl [参数] <命令> [命令参数]\n\n命令:\n")
+		for _, command := range commands {
+			fmt.Fprintf(stderr, "  %s\n", command.usage)
+		}
+		fmt.Fprintf(stderr, "\n参数:\n")
+		flagSet.PrintDefaults()
+	}
+	if err := flagSet.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if *output != outputTable && *output != outputJSON {
+		fmt.Fprintf(stderr, "tgoctl: 不支持的输出格式[%s]\n", *output)
+		return 2
+	}
+	if flagSet.NArg() == 0 {
+		flagSet.Usage()
+		return 2
+	}
+	c := &ctl{
+		addr:   strings.TrimRight(*addr, "/"),
+		token:  *token,
+		output: *output,
+		stdout: stdout,
+		stderr: stderr,
+		http:   &http.Client{},
+	}
+	name := flagSet.Arg(0)
+	for _, command := range commands {
+		if command.name != name {
+			continue
+		}
+		if err := command.run(c, flagSet.Args()[1:]); err != nil {
+			fmt.Fprintf(stderr, "tgoctl: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	fmt.Fprintf(stderr, "tgoctl: 不支持的命令[%s]\n", name)
+	flagSet.Usage()
+	return 2
+}
+
+func envOr(key, value string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return value
+}
+
+type ctl struct {
+	addr   string
+	token  string
+	output string
+	stdout io.Writer
+	stderr io.Writer
+	http   *http.Client
+}
+
+// ---------- 命令 ----------
+
+func (c *ctl) conns(args []string) error {
+	var conns []*tgo.AdminConn
+	if err := c.do("GET", "/conns", nil, &conns); err != nil {
+		return err
+	}
+	return c.print(conns, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "CLIENT_ID\tREMOTE_ADDR\tTAGS")
+		for _, conn := range conns {
+			fmt.Fprintf(w, "%d\t%s\t%s\n", conn.ClientID, conn.RemoteAddr, strings.Join(conn.Tags, ","))
+		}
+	})
+}
+
+func (c *ctl) client(args []string) error {
+	clientID, err := parseIDArg(args, "clientID")
+	if err != nil {
+		return err
+	}
+	var client tgo.AdminClient
+	if err = c.do("GET", "/clients/"+clientID, nil, &client); err != nil {
+		return err
+	}
+	return c.print(&client, func(w *tabwriter.Writer) {
+		channelIDs := make([]string, 0, len(client.ChannelIDs))
+		for _, channelID := range client.ChannelIDs {
+			channelIDs = append(channelIDs, strconv.FormatUint(channelID, 10))
+		}
+		fmt.Fprintf(w, "CLIENT_ID\t%d\n", client.ClientID)
+		fmt.Fprintf(w, "ONLINE\t%t\n", client.Online)
+		fmt.Fprintf(w, "TAGS\t%s\n", strings.Join(client.Tags, ","))
+		fmt.Fprintf(w, "CHANNELS\t%s\n", strings.Join(channelIDs, ","))
+		fmt.Fprintf(w, "BACKLOG\t%d\n", client.Backlog)
+	})
+}
+
+func (c *ctl) channel(args []string) error {
+	channelID, err := parseIDArg(args, "channelID")
+	if err != nil {
+		return err
+	}
+	var channel tgo.AdminChannel
+	if err = c.do("GET", "/channels/"+channelID, nil, &channel); err != nil {
+		return err
+	}
+	return c.print(&channel, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "CHANNEL_ID\tTYPE\tLOADED\tMESSAGES\tQUEUE")
+		fmt.Fprintf(w, "%d\t%d\t%t\t%d\t%d\n", channel.ChannelID, channel.ChannelType, channel.Loaded, channel.MessageCount, channel.QueueDepth)
+	})
+}
+
+func (c *ctl) send(args []string) error {
+	flagSet := flag.NewFlagSet("send", flag.ContinueOnError)
+	flagSet.SetOutput(c.stderr)
+	from := flagSet.Uint64("from", 0, "发送者ID 0表示系统")
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+	if flagSet.NArg() != 2 {
+		return errors.New("用法: send [-from id] <channelID> <payload>")
+	}
+	channelID, err := parseIDArg(flagSet.Args()[:1], "channelID")
+	if err != nil {
+		return err
+	}
+	message := &tgo.AdminMessage{From: *from, Payload: flagSet.Arg(1)}
+	if err = c.do("POST", "/channels/"+channelID+"/messages", message, message); err != nil {
+		return err
+	}
+	return c.print(message, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "消息[%d]已发送到管道[%s]\n", message.MessageID, channelID)
+	})
+}
+
+func (c *ctl) kick(args []string) error {
+	clientID, err := parseIDArg(args, "clientID")
+	if err != nil {
+		return err
+	}
+	if err = c.do("DELETE", "/conns/"+clientID, nil, nil); err != nil {
+		return err
+	}
+	return c.print(map[string]string{"kicked": clientID}, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "客户端[%s]已断开\n", clientID)
+	})
+}
+
+func (c *ctl) stats(args []string) error {
+	var stats tgo.AdminStats
+	if err := c.do("GET", "/stats", nil, &stats); err != nil {
+		return err
+	}
+	return c.print(&stats, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "VERSION\t%s\n", stats.Version)
+		fmt.Fprintf(w, "CONNECTIONS\t%d\n", stats.Connections)
+		fmt.Fprintf(w, "CHANNELS\t%d\n", stats.Channels)
+		fmt.Fprintf(w, "QUEUE_DEPTH\t%d\n", stats.QueueDepth)
+	})
+}
+
+// tail 实时输出收到的包 直到连接断开
+func (c *ctl) tail(args []string) error {
+	flagSet := flag.NewFlagSet("tail", flag.ContinueOnError)
+	flagSet.SetOutput(c.stderr)
+	clientID := flagSet.Uint64("client", 0, "只查看此客户端的包 0表示所有客户端")
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+	path := "/packets"
+	if *clientID != 0 {
+		path += "?client_id=" + url.QueryEscape(strconv.FormatUint(*clientID, 10))
+	}
+	resp, err := c.request("GET", path, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if c.output == outputJSON {
+			fmt.Fprintln(c.stdout, scanner.Text())
+			continue
+		}
+		var packet tgo.AdminPacket
+		if err = json.Unmarshal(scanner.Bytes(), &packet); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.stdout, "%s client=%d addr=%s type=%s %s\n", packet.Time.Format(time.RFC3339Nano), packet.ClientID, packet.RemoteAddr, packet.Type, packet.Packet)
+	}
+	return scanner.Err()
+}
+
+// ---------- http ----------
+
+func (c *ctl) request(method, path string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.addr+"/admin"+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		var adminErr tgo.AdminError
+		if json.NewDecoder(resp.Body).Decode(&adminErr) == nil && adminErr.Error != "" {
+			return nil, fmt.Errorf("%s（%d）", adminErr.Error, resp.StatusCode)
+		}
+		return nil, fmt.Errorf("请求失败（%d）", resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// do 发送请求并将返回的JSON解码到out out为nil时忽略返回内容
+func (c *ctl) do(method, path string, body interface{}, out interface{}) error {
+	resp, err := c.request(method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// print 按输出格式输出 table时调用table输出
+func (c *ctl) print(v interface{}, table func(w *tabwriter.Writer)) error {
+	if c.output == outputJSON {
+		encoder := json.NewEncoder(c.stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	}
+	w := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	table(w)
+	return w.Flush()
+}
+
+func parseIDArg(args []string, name string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("需要参数<%s>", name)
+	}
+	if _, err := strconv.ParseUint(args[0], 10, 64); err != nil {
+		return "", fmt.Errorf("%s格式不正确！", name)
+	}
+	return args[0], nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tgo-team/tgo-core/tgo"
+	"github.com/tgo-team/tgo-core/tgo/packets"
+	"github.com/tgo-team/tgo-core/tgo/protocol"
+	"github.com/tgo-team/tgo-core/tgo/server/tcp"
+	"github.com/tgo-team/tgo-core/tgo/storage"
+)
+
+func startTestTGO(t *testing.T) *tgo.TGO {
+	opts := tgo.NewOptions()
+	opts.DataPath = t.TempDir()
+	opts.TCPAddress = "127.0.0.1:0"
+	opts.HTTPAddress = "127.0.0.1:0"
+	opts.LogLevel = tgo.ErrorLevel
+	opts.AdminToken = "token"
+	opts.Pro = protocol.New()
+	tg, err := tgo.NewBuilder(opts).Server(tcp.New).Storage(storage.New).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tg.MatchDefaultHandlers()
+	if err = tg.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return tg
+}
+
+func runCtl(tg *tgo.TGO, args ...string) (string, string, int) {
+	var stdout, stderr bytes.Buffer
+	args = append([]string{"-addr", "http://" + tg.HTTPAddr().String(), "-token", "token"}, args...)
+	code := run(args, &stdout, &stderr)
+	return stdout.String(), stderr.String(), code
+}
+
+func TestRun(t *testing.T) {
+	tg := startTestTGO(t)
+	defer tg.Stop()
+	tg.Storage.AddClient(tgo.NewClient(1, "111"))
+	tg.Storage.AddChannel(tgo.NewChannelModel(1, tgo.ChannelTypePerson))
+	tg.Storage.Bind(1, 1)
+
+	stdout, stderr, code := runCtl(tg, "-o", "json", "stats")
+	var stats tgo.AdminStats
+	if code != 0 || json.Unmarshal([]byte(stdout), &stats) != nil || stats.Version != tgo.Version {
+		t.Fatalf("stats失败！-> %d %s %s", code, stdout, stderr)
+	}
+	stdout, stderr, code = runCtl(tg, "send", "-from", "2", "1", "hello")
+	if code != 0 || !strings.Contains(stdout, "已发送到管道[1]") {
+		t.Fatalf("send失败！-> %d %s %s", code, stdout, stderr)
+	}
+	stdout, stderr, code = runCtl(tg, "client", "1")
+	if code != 0 || !strings.Contains(strings.Join(strings.Fields(stdout), " "), "CHANNELS 1 BACKLOG 1") {
+		t.Fatalf("client应该输出管道[1]和1条未确认的消息！-> %d %s %s", code, stdout, stderr)
+	}
+	stdout, stderr, code = runCtl(tg, "conns")
+	if code != 0 || !strings.HasPrefix(stdout, "CLIENT_ID") {
+		t.Fatalf("conns失败！-> %d %s %s", code, stdout, stderr)
+	}
+	if _, stderr, code = runCtl(tg, "kick", "1"); code != 1 || !strings.Contains(stderr, "不在线") {
+		t.Fatalf("kick不在线的客户端应该失败！-> %d %s", code, stderr)
+	}
+	if _, stderr, code = runCtl(tg, "unknown"); code != 2 {
+		t.Fatalf("不支持的命令应该返回2，实际为%d -> %s", code, stderr)
+	}
+	var stdoutBuf, stderrBuf bytes.Buffer
+	if code = run([]string{"-addr", "http://" + tg.HTTPAddr().String(), "-token", "wrong", "stats"}, &stdoutBuf, &stderrBuf); code != 1 || !strings.Contains(stderrBuf.String(), "401") {
+		t.Fatalf("token错误应该失败！-> %d %s", code, stderrBuf.String())
+	}
+}
+
+func TestRun_tail(t *testing.T) {
+	tg := startTestTGO(t)
+	tg.Storage.AddClient(tgo.NewClient(1, "111"))
+
+	var stdout, stderr bytes.Buffer
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		run([]string{"-addr", "http://" + tg.HTTPAddr().String(), "-token", "token", "tail", "-client", "1"}, &stdout, &stderr)
+	}()
+	time.Sleep(200 * time.Millisecond) // 等待tail开始订阅
+
+	conn, err := net.Dial("tcp", tg.Servers[0].(*tcp.Server).Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for _, packet := range []packets.Packet{packets.NewConnectPacket(1, "111"), packets.NewPingreqPacket()} {
+		data, _ := protocol.Encode(packet)
+		conn.Write(data)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	protocol.Decode(conn) // connack
+	protocol.Decode(conn) // pingresp
+
+	tg.Stop()
+	wg.Wait()
+	output := stdout.String()
+	if !strings.Contains(output, "client=1") || !strings.Contains(output, "type=connect") || !strings.Contains(output, "type=pingreq") {
+		t.Fatalf("tail输出不正确！-> %s %s", output, stderr.String())
+	}
+}
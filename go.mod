@@ -1,3 +1,5 @@
 module github.com/tgo-team/tgo-core
 
+go 1.22
+
 require github.com/zheng-ji/goCuckoo v0.0.0-20160727030056-090e82d0856a
@@ -1,6 +1,149 @@
 package main
 
-func main()  {
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 
-	println("ddd")
+	"github.com/tgo-team/tgo-core/tgo"
+	"github.com/tgo-team/tgo-core/tgo/cluster"
+	_ "github.com/tgo-team/tgo-core/tgo/protocol" // 登记mqtt-im协议
+	"github.com/tgo-team/tgo-core/tgo/server/tcp"
+	"github.com/tgo-team/tgo-core/tgo/server/websocket"
+	"github.com/tgo-team/tgo-core/tgo/storage"
+)
+
+const defaultDataPath = "data"
+
+// started 启动成功并开始监听信号后调用（测试使用）
+var started = func(tg *tgo.TGO) {}
+
+// 命令行参数对应的配置名 只有明确指定的参数才会覆盖配置文件和环境变量
+var flagOptions = map[string]string{
+	"data-path":       "data_path",
+	"tcp-address":     "tcp_address",
+	"ws-address":      "web_socket_address",
+	"http-address":    "http_address",
+	"log-level":       "log_level",
+	"cluster-address": "cluster_address",
+	"cluster-seeds":   "cluster_seeds",
+}
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "version" {
+		fmt.Println(tgo.VersionInfo())
+		return
+	}
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "tgo: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	flagSet := flag.NewFlagSet("tgo", flag.ContinueOnError)
+	configPath := flagSet.String("config", "", "配置文件（.json .yaml .yml .toml）")
+	pidFile := flagSet.String("pid-file", "", "pid文件 默认为 数据目录/tgo.pid")
+	flagSet.String("data-path", "", "数据目录 默认为 "+defaultDataPath)
+	flagSet.String("tcp-address", "", "TCP监听地址")
+	flagSet.String("ws-address", "", "WebSocket监听地址")
+	flagSet.String("http-address", "", "HTTP监听地址")
+	flagSet.String("log-level", "", "日志级别 fatal、error、warn、info、debug、trace")
+	flagSet.String("cluster-address", "", "集群节点之间通信的监听地址 为空表示不开启集群")
+	flagSet.String("cluster-seeds", "", "逗号分隔的集群节点地址")
+	flagSet.Usage = func() {
+		fmt.Fprintf(flagSet.Output(), "用法: tgo [参数]\n       tgo version\n\n参数:\n")
+		flagSet.PrintDefaults()
+	}
+	if err := flagSet.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return err
+	}
+
+	opts, err := loadOptions(flagSet, *configPath)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(opts.DataPath, 0755); err != nil {
+		return err
+	}
+	if *pidFile == "" {
+		*pidFile = filepath.Join(opts.DataPath, "tgo.pid")
+	}
+	if err = writePidFile(*pidFile); err != nil {
+		return err
+	}
+	defer os.Remove(*pidFile)
+
+	tg, err := tgo.NewBuilder(opts).
+		Server(tcp.New).
+		Server(websocket.New).
+		Storage(storage.New).
+		Cluster(cluster.New).
+		Build()
+	if err != nil {
+		return err
+	}
+	tg.MatchDefaultHandlers()
+	if err = tg.Start(); err != nil {
+		tg.Stop()
+		return err
+	}
+	tg.Info("%s 启动成功！", tgo.VersionInfo())
+	// 重新加载时同样应用命令行参数和默认值 没有配置文件时只重新加载环境变量（同时避免SIGHUP的默认行为结束进程）
+	tg.WatchReload(func() (*tgo.Options, error) {
+		return loadOptions(flagSet, *configPath)
+	})
+
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+	started(tg)
+	sig := <-signalChan
+	signal.Stop(signalChan)
+	tg.Info("收到信号[%s]，开始退出...", sig)
+	return tg.Stop()
+}
+
+// loadOptions 加载配置 默认配置 < 配置文件 < 环境变量 < 命令行参数
+func loadOptions(flagSet *flag.FlagSet, configPath string) (*tgo.Options, error) {
+	opts, err := tgo.LoadOptions(configPath)
+	if err != nil {
+		return nil, err
+	}
+	flagSet.Visit(func(f *flag.Flag) {
+		name, ok := flagOptions[f.Name]
+		if !ok || err != nil {
+			return
+		}
+		err = opts.Set(name, f.Value.String())
+	})
+	if err != nil {
+		return nil, err
+	}
+	if opts.DataPath == "" {
+		opts.DataPath = defaultDataPath
+	}
+	return opts, opts.Validate()
+}
+
+// writePidFile 写入pid文件 文件中的进程还在运行时返回错误（避免同一个数据目录启动多个tgo）
+func writePidFile(path string) error {
+	if data, err := ioutil.ReadFile(path); err == nil {
+		pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err == nil && pid != os.Getpid() && processRunning(pid) {
+			return fmt.Errorf("tgo已经在运行（pid: %d, pid文件: %s）", pid, path)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644)
 }
@@ -0,0 +1,115 @@
+//go:build !windows
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/tgo-team/tgo-core/tgo"
+)
+
+// TestRun_reload 通过命令行参数修改的配置在SIGHUP重新加载后保持不变
+func TestRun_reload(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "tgo.json")
+	if err := ioutil.WriteFile(configPath, []byte(`{"log_level": "error"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tgChan := make(chan *tgo.TGO, 1)
+	started = func(tg *tgo.TGO) { tgChan <- tg }
+	defer func() { started = func(tg *tgo.TGO) {} }()
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- run([]string{
+			"-config", configPath,
+			"-data-path", filepath.Join(dir, "data"),
+			"-tcp-address", "127.0.0.1:0",
+			"-ws-address", "127.0.0.1:0",
+			"-http-address", "",
+		})
+	}()
+	var tg *tgo.TGO
+	select {
+	case tg = <-tgChan:
+	case err := <-errChan:
+		t.Fatalf("启动失败！-> %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待启动超时！")
+	}
+
+	if err := ioutil.WriteFile(configPath, []byte(`{"log_level": "fatal"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	syscall.Kill(syscall.Getpid(), syscall.SIGHUP)
+	deadline := time.Now().Add(5 * time.Second)
+	for tg.GetOpts().LogLevel != tgo.FatalLevel {
+		if time.Now().After(deadline) {
+			t.Fatal("重新加载配置超时！")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if opts := tg.GetOpts(); opts.TCPAddress != "127.0.0.1:0" || opts.DataPath != filepath.Join(dir, "data") {
+		t.Fatalf("命令行参数应该保持不变！-> %s %s", opts.TCPAddress, opts.DataPath)
+	}
+
+	syscall.Kill(syscall.Getpid(), syscall.SIGTERM)
+	select {
+	case err := <-errChan:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待退出超时！")
+	}
+}
+
+// TestRun_reloadWithoutConfig 没有配置文件时SIGHUP不会结束进程 TGO正常运行直到SIGTERM
+func TestRun_reloadWithoutConfig(t *testing.T) {
+	dir := t.TempDir()
+	tgChan := make(chan *tgo.TGO, 1)
+	started = func(tg *tgo.TGO) { tgChan <- tg }
+	defer func() { started = func(tg *tgo.TGO) {} }()
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- run([]string{
+			"-data-path", dir,
+			"-tcp-address", "127.0.0.1:0",
+			"-ws-address", "127.0.0.1:0",
+			"-http-address", "",
+			"-log-level", "error",
+		})
+	}()
+	select {
+	case <-tgChan:
+	case err := <-errChan:
+		t.Fatalf("启动失败！-> %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待启动超时！")
+	}
+
+	syscall.Kill(syscall.Getpid(), syscall.SIGHUP)
+	select {
+	case err := <-errChan:
+		t.Fatalf("SIGHUP不应该退出！-> %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	syscall.Kill(syscall.Getpid(), syscall.SIGTERM)
+	select {
+	case err := <-errChan:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待退出超时！")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "tgo.pid")); !os.IsNotExist(err) {
+		t.Fatalf("退出后应该删除pid文件！-> %v", err)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+
+package main
+
+import "syscall"
+
+// processRunning 进程[pid]是否还在运行
+func processRunning(pid int) bool {
+	return syscall.Kill(pid, 0) == nil
+}
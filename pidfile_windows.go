@@ -0,0 +1,15 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// processRunning 进程[pid]是否还在运行（Windows上进程不存在时FindProcess返回错误）
+func processRunning(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	process.Release()
+	return true
+}
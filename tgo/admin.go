@@ -0,0 +1,408 @@
+package tgo
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const adminPrefix = "/admin"
+
+// AdminError 管理接口返回的错误 例如: {"error":"管道不存在！"}
+type AdminError struct {
+	Error string `json:"error"`
+}
+
+// AdminConn 在线连接
+type AdminConn struct {
+	ClientID   uint64   `json:"client_id"`
+	RemoteAddr string   `json:"remote_addr"`
+	Tags       []string `json:"tags,omitempty"`
+}
+
+// AdminChannel 管道及其统计
+type AdminChannel struct {
+	ChannelID    uint64 `json:"channel_id"`
+	ChannelType  int    `json:"channel_type"`
+	FanoutMode   int    `json:"fanout_mode"`
+	Tag          string `json:"tag,omitempty"`
+	Topic        string `json:"topic,omitempty"`
+	Loaded       bool   `json:"loaded"`        // 管道是否已加载到内存（没有加载时统计为0）
+	MessageCount uint64 `json:"message_count"` // 加载后放入管道的消息数量
+	QueueDepth   int    `json:"queue_depth"`   // 待投递的消息数量
+}
+
+// AdminClient 客户端 不返回密码
+type AdminClient struct {
+	ClientID   uint64   `json:"client_id"`
+	Password   string   `json:"password,omitempty"` // 只用于添加和修改
+	Tags       []string `json:"tags,omitempty"`
+	Online     bool     `json:"online"`
+	ChannelIDs []uint64 `json:"channel_ids,omitempty"` // 客户端绑定的管道（存储实现了CursorStorage才有）
+	Backlog    int64    `json:"backlog"`               // 个人管道里还没有确认的消息数量
+}
+
+// AdminMessage 发送到管道的系统消息 MessageID为0时自动生成
+type AdminMessage struct {
+	MessageID uint64 `json:"message_id"`
+	From      uint64 `json:"from"`
+	Payload   string `json:"payload"`
+}
+
+// AdminStats 服务统计
+type AdminStats struct {
+	Version     string `json:"version"`
+	Connections int    `json:"connections"`
+	Channels    int    `json:"channels"`
+	QueueDepth  int    `json:"queue_depth"`
+}
+
+var adminMessageIDSequence = uint64(time.Now().UnixNano())
+
+// mountAdmin 在内置http服务上挂载管理接口 请求需要带上 Authorization: Bearer <AdminToken>
+// AdminToken为空时管理接口不可用
+func (t *TGO) mountAdmin() {
+	handle := func(pattern string, handler func(w http.ResponseWriter, r *http.Request)) {
+		method, path, _ := strings.Cut(pattern, " ")
+		t.http.mux.Handle(method+" "+adminPrefix+path, t.adminAuth(http.HandlerFunc(handler)))
+	}
+	handle("GET /stats", t.handleAdminStats)
+	handle("GET /conns", t.handleAdminConns)
+	handle("DELETE /conns/{clientID}", t.handleAdminKick)
+	handle("POST /channels", t.handleAdminAddChannel)
+	handle("GET /channels/{channelID}", t.handleAdminGetChannel)
+	handle("GET /channels/{channelID}/clients", t.handleAdminGetChannelClients)
+	handle("POST /channels/{channelID}/clients", t.handleAdminBind)
+	handle("POST /channels/{channelID}/messages", t.handleAdminSendMessage)
+	handle("POST /clients", t.handleAdminAddClient)
+	handle("GET /clients/{clientID}", t.handleAdminGetClient)
+	handle("PUT /clients/{clientID}", t.handleAdminUpdateClient)
+	handle("GET /packets", t.handleAdminPackets)
+}
+
+func (t *TGO) adminAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := t.GetOpts().AdminToken
+		if token == "" {
+			writeAdminError(w, http.StatusForbidden, errors.New("没有配置AdminToken，管理接口不可用！"))
+			return
+		}
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") || subtle.ConstantTimeCompare([]byte(auth[len("Bearer "):]), []byte(token)) != 1 {
+			writeAdminError(w, http.StatusUnauthorized, errors.New("AdminToken不正确！"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (t *TGO) handleAdminStats(w http.ResponseWriter, r *http.Request) {
+	writeAdminJSON(w, http.StatusOK, &AdminStats{
+		Version:     Version,
+		Connections: t.ConnManager.Len(),
+		Channels:    t.ChannelCount(),
+		QueueDepth:  t.channels.queueDepth(),
+	})
+}
+
+func (t *TGO) handleAdminConns(w http.ResponseWriter, r *http.Request) {
+	conns := t.ConnManager.Conns()
+	list := make([]*AdminConn, 0, len(conns))
+	for clientID, conn := range conns {
+		list = append(list, &AdminConn{
+			ClientID:   clientID,
+			RemoteAddr: fmt.Sprint(FieldRemoteAddr(conn).Value),
+			Tags:       t.ConnManager.Tags(clientID),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ClientID < list[j].ClientID })
+	writeAdminJSON(w, http.StatusOK, list)
+}
+
+// handleAdminKick 断开客户端的连接
+func (t *TGO) handleAdminKick(w http.ResponseWriter, r *http.Request) {
+	clientID, ok := adminPathID(w, r, "clientID")
+	if !ok {
+		return
+	}
+	conn := t.ConnManager.GetConn(clientID)
+	if conn == nil {
+		writeAdminError(w, http.StatusNotFound, fmt.Errorf("客户端[%d]不在线！", clientID))
+		return
+	}
+	if !closeConn(conn) {
+		writeAdminError(w, http.StatusNotImplemented, errors.New("连接不支持关闭！"))
+		return
+	}
+	t.Info("管理接口断开客户端[%d]的连接。", clientID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (t *TGO) handleAdminAddChannel(w http.ResponseWriter, r *http.Request) {
+	var channel AdminChannel
+	if !readAdminJSON(w, r, &channel) {
+		return
+	}
+	if channel.ChannelID == 0 {
+		writeAdminError(w, http.StatusBadRequest, errors.New("channel_id不能为0！"))
+		return
+	}
+	model := NewChannelModel(channel.ChannelID, channel.ChannelType)
+	model.FanoutMode = channel.FanoutMode
+	model.Tag = channel.Tag
+	model.Topic = channel.Topic
+	if err := t.Storage.AddChannel(model); err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeAdminJSON(w, http.StatusCreated, t.adminChannel(model))
+}
+
+func (t *TGO) handleAdminGetChannel(w http.ResponseWriter, r *http.Request) {
+	model, ok := t.adminGetChannelModel(w, r)
+	if !ok {
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, t.adminChannel(model))
+}
+
+func (t *TGO) handleAdminGetChannelClients(w http.ResponseWriter, r *http.Request) {
+	model, ok := t.adminGetChannelModel(w, r)
+	if !ok {
+		return
+	}
+	clientIDs, err := t.Storage.GetClientIDs(model.ChannelID)
+	if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if clientIDs == nil {
+		clientIDs = []uint64{}
+	}
+	writeAdminJSON(w, http.StatusOK, clientIDs)
+}
+
+// handleAdminBind 绑定客户端到管道 {"client_id":1}
+func (t *TGO) handleAdminBind(w http.ResponseWriter, r *http.Request) {
+	model, ok := t.adminGetChannelModel(w, r)
+	if !ok {
+		return
+	}
+	var client AdminClient
+	if !readAdminJSON(w, r, &client) {
+		return
+	}
+	if client.ClientID == 0 {
+		writeAdminError(w, http.StatusBadRequest, errors.New("client_id不能为0！"))
+		return
+	}
+	if err := t.Bind(client.ClientID, model.ChannelID); err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAdminSendMessage 发送系统消息到管道 和客户端发送的消息一样存储并投递
+func (t *TGO) handleAdminSendMessage(w http.ResponseWriter, r *http.Request) {
+	model, ok := t.adminGetChannelModel(w, r)
+	if !ok {
+		return
+	}
+	var message AdminMessage
+	if !readAdminJSON(w, r, &message) {
+		return
+	}
+	if message.MessageID == 0 {
+		message.MessageID = atomic.AddUint64(&adminMessageIDSequence, 1)
+	}
+	channel, err := t.GetChannel(model.ChannelID)
+	if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if channel == nil {
+		writeAdminError(w, http.StatusNotFound, ErrChannelNotExist)
+		return
+	}
+	if err = channel.PutMsg(NewMsg(message.MessageID, message.From, []byte(message.Payload))); err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeAdminJSON(w, http.StatusCreated, &message)
+}
+
+func (t *TGO) handleAdminAddClient(w http.ResponseWriter, r *http.Request) {
+	var client AdminClient
+	if !readAdminJSON(w, r, &client) {
+		return
+	}
+	if client.ClientID == 0 {
+		writeAdminError(w, http.StatusBadRequest, errors.New("client_id不能为0！"))
+		return
+	}
+	c := NewClient(client.ClientID, client.Password)
+	c.Tags = client.Tags
+	if err := t.Storage.AddClient(c); err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return
+	}
+	client.Password = ""
+	client.Online = t.ConnManager.GetConn(client.ClientID) != nil
+	writeAdminJSON(w, http.StatusCreated, &client)
+}
+
+func (t *TGO) handleAdminGetClient(w http.ResponseWriter, r *http.Request) {
+	client, ok := t.adminGetClient(w, r)
+	if !ok {
+		return
+	}
+	adminClient := &AdminClient{
+		ClientID: client.ClientID,
+		Tags:     client.Tags,
+		Online:   t.ConnManager.GetConn(client.ClientID) != nil,
+	}
+	var err error
+	if cursorStorage, ok := t.Storage.(CursorStorage); ok {
+		if adminClient.ChannelIDs, err = cursorStorage.GetChannelIDs(client.ClientID); err != nil {
+			writeAdminError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	if adminClient.Backlog, err = t.countBacklog(client.ClientID); err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, adminClient)
+}
+
+// countBacklog 统计客户端个人管道里还没有确认的消息数量（最多统计maxBacklogPages页）
+func (t *TGO) countBacklog(clientID uint64) (int64, error) {
+	const pageSize, maxBacklogPages = 100, 1000
+	var count int64
+	for pageIndex := int64(1); pageIndex <= maxBacklogPages; pageIndex++ {
+		msgList, err := t.Storage.GetMsgInChannel(clientID, pageIndex, pageSize)
+		if err != nil {
+			return 0, err
+		}
+		count += int64(len(msgList))
+		if int64(len(msgList)) < pageSize {
+			break
+		}
+	}
+	return count, nil
+}
+
+// handleAdminUpdateClient 修改客户端密码 {"password":"123456"} 只支持修改密码
+func (t *TGO) handleAdminUpdateClient(w http.ResponseWriter, r *http.Request) {
+	client, ok := t.adminGetClient(w, r)
+	if !ok {
+		return
+	}
+	var update AdminClient
+	if !readAdminJSON(w, r, &update) {
+		return
+	}
+	if update.Password == "" {
+		writeAdminError(w, http.StatusBadRequest, errors.New("password不能为空！"))
+		return
+	}
+	if update.Tags != nil {
+		writeAdminError(w, http.StatusBadRequest, errors.New("不支持修改tags！"))
+		return
+	}
+	if err := t.Storage.UpdateClient(client.ClientID, update.Password); err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (t *TGO) adminGetChannelModel(w http.ResponseWriter, r *http.Request) (*ChannelModel, bool) {
+	channelID, ok := adminPathID(w, r, "channelID")
+	if !ok {
+		return nil, false
+	}
+	model, err := t.Storage.GetChannel(channelID)
+	if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	if model == nil {
+		writeAdminError(w, http.StatusNotFound, ErrChannelNotExist)
+		return nil, false
+	}
+	return model, true
+}
+
+func (t *TGO) adminGetClient(w http.ResponseWriter, r *http.Request) (*Client, bool) {
+	clientID, ok := adminPathID(w, r, "clientID")
+	if !ok {
+		return nil, false
+	}
+	client, err := t.Storage.GetClient(clientID)
+	if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	if client == nil {
+		writeAdminError(w, http.StatusNotFound, fmt.Errorf("客户端[%d]不存在！", clientID))
+		return nil, false
+	}
+	return client, true
+}
+
+// adminChannel 管道的统计只读取已加载的管道，不会加载管道
+func (t *TGO) adminChannel(model *ChannelModel) *AdminChannel {
+	channel := &AdminChannel{
+		ChannelID:   model.ChannelID,
+		ChannelType: model.ChannelType,
+		FanoutMode:  model.FanoutMode,
+		Tag:         model.Tag,
+		Topic:       model.Topic,
+	}
+	if entry, ok := t.channels.get(model.ChannelID, false); ok {
+		channel.Loaded = true
+		channel.QueueDepth = len(entry.channel.DeliveryMsgChan())
+		if counter, ok := entry.channel.(MessageCounter); ok {
+			channel.MessageCount = counter.GetMessageCount()
+		}
+	}
+	return channel
+}
+
+func adminPathID(w http.ResponseWriter, r *http.Request, name string) (uint64, bool) {
+	id, err := strconv.ParseUint(r.PathValue(name), 10, 64)
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, fmt.Errorf("%s格式不正确！", name))
+		return 0, false
+	}
+	return id, true
+}
+
+func readAdminJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		writeAdminError(w, http.StatusBadRequest, fmt.Errorf("请求格式不正确！-> %v", err))
+		return false
+	}
+	return true
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeAdminError(w http.ResponseWriter, status int, err error) {
+	writeAdminJSON(w, status, &AdminError{Error: err.Error()})
+}
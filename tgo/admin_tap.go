@@ -0,0 +1,151 @@
+package tgo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tgo-team/tgo-core/tgo/packets"
+)
+
+const packetTapBufferSize = 256 // 每个订阅者缓存的包数量 读取不及时的包会被丢弃
+
+// AdminPacket 收到的包（管理接口实时查看）
+type AdminPacket struct {
+	Time       time.Time `json:"time"`
+	ClientID   uint64    `json:"client_id"`
+	RemoteAddr string    `json:"remote_addr"`
+	Type       string    `json:"type"`
+	Packet     string    `json:"packet"`
+}
+
+// packetTaps 收到的包的订阅者
+type packetTaps struct {
+	taps  map[*packetTap]struct{}
+	count int32 // 订阅者数量 没有订阅者时跳过
+	sync.RWMutex
+}
+
+type packetTap struct {
+	clientID uint64 // 0表示所有客户端
+	ch       chan *AdminPacket
+	dropped  uint64
+}
+
+func newPacketTaps() *packetTaps {
+	return &packetTaps{taps: map[*packetTap]struct{}{}}
+}
+
+func (p *packetTaps) add(clientID uint64) *packetTap {
+	tap := &packetTap{clientID: clientID, ch: make(chan *AdminPacket, packetTapBufferSize)}
+	p.Lock()
+	p.taps[tap] = struct{}{}
+	atomic.StoreInt32(&p.count, int32(len(p.taps)))
+	p.Unlock()
+	return tap
+}
+
+func (p *packetTaps) remove(tap *packetTap) {
+	p.Lock()
+	delete(p.taps, tap)
+	atomic.StoreInt32(&p.count, int32(len(p.taps)))
+	p.Unlock()
+}
+
+// publish 将收到的包发给订阅者 不会阻塞
+func (p *packetTaps) publish(packetContext *PacketContext) {
+	if atomic.LoadInt32(&p.count) == 0 {
+		return
+	}
+	packet := &AdminPacket{
+		Time:       time.Now(),
+		ClientID:   packetClientID(packetContext),
+		RemoteAddr: fmt.Sprint(FieldRemoteAddr(packetContext.Conn).Value),
+		Type:       packetTypeName(packetContext.Packet.GetFixedHeader().PacketType),
+		Packet:     fmt.Sprint(redactPacket(packetContext.Packet)),
+	}
+	p.RLock()
+	defer p.RUnlock()
+	for tap := range p.taps {
+		if tap.clientID != 0 && tap.clientID != packet.ClientID {
+			continue
+		}
+		select {
+		case tap.ch <- packet:
+		default:
+			atomic.AddUint64(&tap.dropped, 1)
+		}
+	}
+}
+
+// redactPacket 隐藏包里的密码和token 返回的是复制的包
+func redactPacket(packet packets.Packet) packets.Packet {
+	switch p := packet.(type) {
+	case *packets.ConnectPacket:
+		if p.Password != "" {
+			redacted := *p
+			redacted.Password = "******"
+			return &redacted
+		}
+	case *packets.CmdPacket:
+		if p.Token != "" {
+			redacted := *p
+			redacted.Token = "******"
+			return &redacted
+		}
+	}
+	return packet
+}
+
+// packetClientID 包所属的客户端 Connect包使用包里的客户端ID
+func packetClientID(packetContext *PacketContext) uint64 {
+	if connectPacket, ok := packetContext.Packet.(*packets.ConnectPacket); ok {
+		return connectPacket.ClientID
+	}
+	if statefulConn, ok := packetContext.Conn.(StatefulConn); ok {
+		return statefulConn.GetID()
+	}
+	return 0
+}
+
+// handleAdminPackets 实时输出收到的包 每行一个JSON GET /admin/packets?client_id=1
+func (t *TGO) handleAdminPackets(w http.ResponseWriter, r *http.Request) {
+	var clientID uint64
+	if value := r.URL.Query().Get("client_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			writeAdminError(w, http.StatusBadRequest, fmt.Errorf("client_id格式不正确！"))
+			return
+		}
+		clientID = id
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeAdminError(w, http.StatusNotImplemented, fmt.Errorf("不支持实时输出！"))
+		return
+	}
+	tap := t.packetTaps.add(clientID)
+	defer t.packetTaps.remove(tap)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	encoder := json.NewEncoder(w)
+	for {
+		select {
+		case packet := <-tap.ch:
+			if err := encoder.Encode(packet); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-t.exitChan:
+			return
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package tgo
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tgo-team/tgo-core/tgo/packets"
+)
+
+func adminRequest(tg *TGO, token, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, adminPrefix+path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	tg.HTTPMux().ServeHTTP(w, req)
+	return w
+}
+
+func TestAdmin_auth(t *testing.T) {
+	tg := startTGO(NewOptions())
+	defer tg.Stop()
+	if w := adminRequest(tg, "token", "GET", "/stats", ""); w.Code != http.StatusForbidden {
+		t.Fatalf("没有配置AdminToken应该返回403，实际为%d", w.Code)
+	}
+	opts := *tg.GetOpts()
+	opts.AdminToken = "token"
+	if err := tg.Reload(&opts); err != nil {
+		t.Fatal(err)
+	}
+	if w := adminRequest(tg, "wrong", "GET", "/stats", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("token错误应该返回401，实际为%d", w.Code)
+	}
+	if w := adminRequest(tg, "token", "GET", "/stats", ""); w.Code != http.StatusOK {
+		t.Fatalf("应该返回200，实际为%d", w.Code)
+	}
+}
+
+func TestAdmin_channelAndClient(t *testing.T) {
+	opts := NewOptions()
+	opts.AdminToken = "token"
+	tg := startTGO(opts)
+	defer tg.Stop()
+
+	expectStatus := func(w *httptest.ResponseRecorder, status int) {
+		t.Helper()
+		if w.Code != status {
+			t.Fatalf("应该返回%d，实际为%d -> %s", status, w.Code, w.Body.String())
+		}
+	}
+	expectStatus(adminRequest(tg, "token", "POST", "/clients", `{"client_id":1,"password":"123","tags":["vip"]}`), http.StatusCreated)
+	expectStatus(adminRequest(tg, "token", "PUT", "/clients/1", `{"tags":["svip"]}`), http.StatusBadRequest)
+	expectStatus(adminRequest(tg, "token", "PUT", "/clients/1", `{"password":""}`), http.StatusBadRequest)
+	if err := tg.Authenticate(1, ""); err == nil {
+		t.Fatal("没有password的修改不能清空密码！")
+	}
+	expectStatus(adminRequest(tg, "token", "PUT", "/clients/1", `{"password":"456","tags":["svip"]}`), http.StatusBadRequest)
+	expectStatus(adminRequest(tg, "token", "PUT", "/clients/1", `{"password":"456"}`), http.StatusNoContent)
+	if err := tg.Authenticate(1, "456"); err != nil {
+		t.Fatalf("修改密码后应该认证成功！-> %v", err)
+	}
+	w := adminRequest(tg, "token", "GET", "/clients/1", "")
+	expectStatus(w, http.StatusOK)
+	if strings.Contains(w.Body.String(), "456") {
+		t.Fatalf("不应该返回密码！-> %s", w.Body.String())
+	}
+	expectStatus(adminRequest(tg, "token", "GET", "/clients/2", ""), http.StatusNotFound)
+
+	expectStatus(adminRequest(tg, "token", "POST", "/channels", `{"channel_id":10,"channel_type":1}`), http.StatusCreated)
+	expectStatus(adminRequest(tg, "token", "POST", "/channels/10/clients", `{"client_id":1}`), http.StatusNoContent)
+	w = adminRequest(tg, "token", "GET", "/channels/10/clients", "")
+	expectStatus(w, http.StatusOK)
+	if strings.TrimSpace(w.Body.String()) != "[1]" {
+		t.Fatalf("管道的客户端应该为[1]，实际为%s", w.Body.String())
+	}
+
+	w = adminRequest(tg, "token", "POST", "/channels/10/messages", `{"payload":"系统消息"}`)
+	expectStatus(w, http.StatusCreated)
+	var message AdminMessage
+	json.Unmarshal(w.Body.Bytes(), &message)
+	if message.MessageID == 0 {
+		t.Fatal("应该自动生成消息ID！")
+	}
+	w = adminRequest(tg, "token", "GET", "/channels/10", "")
+	expectStatus(w, http.StatusOK)
+	var channel AdminChannel
+	json.Unmarshal(w.Body.Bytes(), &channel)
+	if !channel.Loaded || channel.MessageCount != 1 || channel.ChannelType != 1 {
+		t.Fatalf("管道统计不正确！-> %s", w.Body.String())
+	}
+	expectStatus(adminRequest(tg, "token", "GET", "/channels/11", ""), http.StatusNotFound)
+	expectStatus(adminRequest(tg, "token", "GET", "/channels/abc", ""), http.StatusBadRequest)
+	expectStatus(adminRequest(tg, "token", "POST", "/channels", `{"channel_id":12,"unknown":1}`), http.StatusBadRequest)
+
+	w = adminRequest(tg, "token", "GET", "/conns", "")
+	expectStatus(w, http.StatusOK)
+	if strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Fatalf("不应该有在线连接！-> %s", w.Body.String())
+	}
+	expectStatus(adminRequest(tg, "token", "DELETE", "/conns/1", ""), http.StatusNotFound)
+}
+
+func TestPacketTaps_redact(t *testing.T) {
+	taps := newPacketTaps()
+	tap := taps.add(0)
+	connectPacket := packets.NewConnectPacket(1, "secret")
+	cmdPacket := packets.NewCmdPacket("device/info", nil)
+	cmdPacket.TokenFlag = true
+	cmdPacket.Token = "secret"
+	for _, packet := range []packets.Packet{connectPacket, cmdPacket} {
+		taps.publish(NewPacketContext(packet, &ServerConnTest{}))
+		adminPacket := <-tap.ch
+		if strings.Contains(adminPacket.Packet, "secret") {
+			t.Fatalf("输出的包不应该包含密码和token！-> %s", adminPacket.Packet)
+		}
+	}
+	if connectPacket.Password != "secret" || cmdPacket.Token != "secret" {
+		t.Fatal("不应该修改原来的包！")
+	}
+}
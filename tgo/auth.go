@@ -0,0 +1,38 @@
+package tgo
+
+import "errors"
+
+var ErrAuthFailed = errors.New("客户端认证失败！")
+
+// Authenticator 认证客户端的连接
+type Authenticator interface {
+	Authenticate(clientID uint64, password string) error
+}
+
+// AuthenticatorFunc 函数形式的Authenticator
+type AuthenticatorFunc func(clientID uint64, password string) error
+
+func (f AuthenticatorFunc) Authenticate(clientID uint64, password string) error {
+	return f(clientID, password)
+}
+
+// storageAuthenticator 默认的认证 对比存储中客户端的密码
+type storageAuthenticator struct {
+	ctx *Context
+}
+
+func (a *storageAuthenticator) Authenticate(clientID uint64, password string) error {
+	client, err := a.ctx.TGO.Storage.GetClient(clientID)
+	if err != nil {
+		return err
+	}
+	if client == nil || client.Password != password {
+		return ErrAuthFailed
+	}
+	return nil
+}
+
+// Authenticate 认证客户端 使用Builder指定或登记的Authenticator，都没有则对比存储中客户端的密码
+func (t *TGO) Authenticate(clientID uint64, password string) error {
+	return t.auth.Authenticate(clientID, password)
+}
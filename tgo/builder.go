@@ -0,0 +1,189 @@
+package tgo
+
+import (
+	"errors"
+	"net/http"
+)
+
+var (
+	ErrNoServer  = errors.New("请先配置Server！")
+	ErrNoStorage = errors.New("请先配置存储！")
+)
+
+// Builder 创建TGO 通过Builder指定的server、存储、协议、日志、认证、监控和管道类型只属于创建出来的TGO，
+// 没有指定的使用全局登记的（RegistryServer、RegistryStorage等）
+type Builder struct {
+	opts         *Options
+	servers      []newServerFunc
+	storage      newStorageFunc
+	protocol     Protocol
+	log          Log
+	auth         Authenticator
+	monitor      Monitor
+	cluster      func(ctx *Context) Cluster
+	channelTypes map[int]newChannelFunc
+}
+
+func NewBuilder(opts *Options) *Builder {
+	if opts == nil {
+		opts = NewOptions()
+	}
+	return &Builder{
+		opts:         opts,
+		channelTypes: map[int]newChannelFunc{},
+	}
+}
+
+// Server 添加server 指定后不再使用全局登记的server
+func (b *Builder) Server(newFunc func(ctx *Context) Server) *Builder {
+	b.servers = append(b.servers, newFunc)
+	return b
+}
+
+func (b *Builder) Storage(newFunc func(ctx *Context) Storage) *Builder {
+	b.storage = newFunc
+	return b
+}
+
+func (b *Builder) Protocol(pro Protocol) *Builder {
+	b.protocol = pro
+	return b
+}
+
+func (b *Builder) Log(lg Log) *Builder {
+	b.log = lg
+	return b
+}
+
+func (b *Builder) Auth(auth Authenticator) *Builder {
+	b.auth = auth
+	return b
+}
+
+func (b *Builder) Monitor(monitor Monitor) *Builder {
+	b.monitor = monitor
+	return b
+}
+
+// Cluster 指定集群 例如: builder.Cluster(cluster.New)
+func (b *Builder) Cluster(newFunc func(ctx *Context) Cluster) *Builder {
+	b.cluster = newFunc
+	return b
+}
+
+// ChannelType 指定管道类型 优先于RegistryChannelType登记的
+func (b *Builder) ChannelType(typ int, newFunc func(model *ChannelModel, ctx *Context) Channel) *Builder {
+	b.channelTypes[typ] = newFunc
+	return b
+}
+
+// Build 创建TGO
+func (b *Builder) Build() (*TGO, error) {
+	tg, err := b.build()
+	if err != nil {
+		return nil, err
+	}
+	tg.startLoops()
+	return tg, nil
+}
+
+// build 创建TGO但不启动内部循环 出错时返回已创建的部分
+func (b *Builder) build() (*TGO, error) {
+	copiedOpts := *b.opts // 复制配置 多个Builder共用同一个Options时不会互相覆盖日志、监控等
+	opts := &copiedOpts
+	tg := &TGO{
+		exitChan:                make(chan int, 0),
+		channels:                newChannelRegistry(),
+		channelTypes:            b.channelTypes,
+		topics:                  newTopicManager(),
+		rpc:                     newRPCManager(),
+		http:                    newHTTPServer(),
+		limiter:                 newPacketLimiter(),
+		packetTaps:              newPacketTaps(),
+		syncing:                 newSyncingClients(),
+		retainMsgMap:            map[uint64]*Msg{},
+		AcceptPacketChan:        make(chan *PacketContext, 1024),
+		AcceptConnChan:          make(chan Conn, 1024),
+		AcceptConnExitChan:      make(chan Conn, 1024),
+		AcceptAuthenticatedChan: make(chan *AuthenticatedContext, 1024),
+		ConnManager:             newConnManager(),
+	}
+
+	// log
+	if b.log != nil {
+		opts.Log = b.log
+	} else if lg := NewLog(opts.LogLevel); lg != nil {
+		opts.Log = lg
+	} else if _, ok := opts.Log.(*DefaultLog); ok || opts.Log == nil { // 默认日志按配置的级别、格式和文件重新创建
+		defaultLog, err := newDefaultLogWithOptions(opts)
+		if err != nil {
+			return tg, err
+		}
+		opts.Log = defaultLog
+	}
+	if b.protocol != nil {
+		opts.Pro = b.protocol
+	}
+	if b.monitor != nil {
+		opts.Monitor = b.monitor
+	}
+	if opts.Monitor == nil {
+		opts.Monitor = NewPrometheusMonitor()
+	}
+	if handler, ok := opts.Monitor.(http.Handler); ok {
+		tg.http.mux.Handle("/metrics", tg.adminAuth(handler))
+	}
+	if opts.TraceExporter == nil && opts.TraceBufferSize > 0 {
+		opts.TraceExporter = NewRingTraceExporter(opts.TraceBufferSize)
+	}
+	tg.http.mux.Handle("/debug/traces", tg.adminAuth(http.HandlerFunc(tg.handleTraces)))
+	tg.mountAdmin()
+	tg.storeOpts(opts)
+
+	ctx := &Context{
+		TGO: tg,
+	}
+
+	// route
+	tg.Route = NewRoute(ctx)
+	tg.Use(Recovery())
+	tg.Match("cmd:"+CmdTopicSubscribe, tg.handleTopicSubscribe)
+	tg.Match("cmd:"+CmdTopicUnsubscribe, tg.handleTopicUnsubscribe)
+
+	// server
+	if len(b.servers) > 0 {
+		for _, newServer := range b.servers {
+			tg.Servers = append(tg.Servers, newServer(ctx))
+		}
+	} else {
+		tg.Servers = GetServers(ctx)
+	}
+	if tg.Servers == nil {
+		return tg, ErrNoServer
+	}
+
+	// storage
+	if b.storage != nil {
+		tg.Storage = b.storage(ctx)
+	} else {
+		tg.Storage = NewStorage(ctx)
+	}
+	if tg.Storage == nil {
+		return tg, ErrNoStorage
+	}
+
+	// cluster
+	if b.cluster != nil {
+		tg.cluster = b.cluster(ctx)
+	}
+
+	// auth
+	tg.auth = b.auth
+	if tg.auth == nil {
+		tg.auth = NewAuth(ctx)
+	}
+	if tg.auth == nil {
+		tg.auth = &storageAuthenticator{ctx: ctx}
+	}
+	return tg, nil
+}
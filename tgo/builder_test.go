@@ -0,0 +1,79 @@
+package tgo
+
+import (
+	"testing"
+)
+
+func TestBuilder_instanceScoped(t *testing.T) {
+	tg1 := startTGO(NewOptions())
+	defer tg1.Stop()
+	tg2 := startBuilder(newTestBuilder(NewOptions()).
+		ChannelType(ChannelTypePerson, func(model *ChannelModel, ctx *Context) Channel {
+			return NewGroupChannel(model.ChannelID, model, ctx)
+		}).
+		Auth(AuthenticatorFunc(func(clientID uint64, password string) error {
+			if password != "token" {
+				return ErrAuthFailed
+			}
+			return nil
+		})))
+	defer tg2.Stop()
+
+	if tg1.Storage == tg2.Storage {
+		t.Fatal("两个TGO不应该共用存储！")
+	}
+	if len(tg1.Servers) != 1 || len(tg2.Servers) != 1 {
+		t.Fatalf("每个TGO应该只有1个server，实际为%d、%d个", len(tg1.Servers), len(tg2.Servers))
+	}
+
+	var clientID uint64 = 100
+	for _, tg := range []*TGO{tg1, tg2} {
+		tg.Storage.AddClient(NewClient(clientID, "123456"))
+		tg.Storage.AddChannel(NewChannelModel(clientID, ChannelTypePerson))
+	}
+	channel1, _ := tg1.GetChannel(clientID)
+	if _, ok := channel1.(*PersonChannel); !ok {
+		t.Fatalf("tg1应该使用默认的管道类型，实际为%T", channel1)
+	}
+	channel2, _ := tg2.GetChannel(clientID)
+	if _, ok := channel2.(*GroupChannel); !ok {
+		t.Fatalf("tg2应该使用Builder指定的管道类型，实际为%T", channel2)
+	}
+
+	if err := tg1.Authenticate(clientID, "123456"); err != nil {
+		t.Fatalf("默认认证应该对比存储中的密码！-> %v", err)
+	}
+	if err := tg1.Authenticate(clientID, "token"); err != ErrAuthFailed {
+		t.Fatal("密码错误应该认证失败！")
+	}
+	if err := tg2.Authenticate(clientID, "token"); err != nil {
+		t.Fatalf("应该使用Builder指定的认证！-> %v", err)
+	}
+}
+
+func TestBuilder_noStorage(t *testing.T) {
+	_, err := NewBuilder(NewOptions()).Server(func(context *Context) Server {
+		return &ServerTest{}
+	}).Storage(func(context *Context) Storage {
+		return nil
+	}).Build()
+	if err != ErrNoStorage {
+		t.Fatalf("没有存储应该返回ErrNoStorage，实际为%v", err)
+	}
+}
+
+// TestBuilder_sharedOptions 多个Builder共用同一个Options时各自创建日志、监控和链路导出
+func TestBuilder_sharedOptions(t *testing.T) {
+	opts := NewOptions()
+	opts.Monitor = nil
+	tg1 := startTGO(opts)
+	defer tg1.Stop()
+	tg2 := startTGO(opts)
+	defer tg2.Stop()
+	if opts.Monitor != nil || opts.TraceExporter != nil {
+		t.Fatal("Build不应该修改传入的Options！")
+	}
+	if tg1.GetOpts().Monitor == tg2.GetOpts().Monitor || tg1.GetOpts().TraceExporter == tg2.GetOpts().TraceExporter {
+		t.Fatal("每个TGO应该使用自己的监控和链路导出！")
+	}
+}
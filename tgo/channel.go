@@ -2,7 +2,6 @@ package tgo
 
 import (
 	"fmt"
-	"github.com/tgo-team/tgo-core/tgo/packets"
 	"github.com/tgo-team/tgo-core/tgo/pqueue"
 	"math"
 	"sync"
@@ -13,33 +12,46 @@ import (
 // ------------ channel ----------------
 
 const (
-	ChannelTypePerson int = iota // 个人管道
-	ChannelTypeGroup                     // 群组管道
+	ChannelTypePerson    int = iota // 个人管道
+	ChannelTypeGroup                // 群组管道
+	ChannelTypeBroadcast            // 广播管道
+	ChannelTypeTopic                // 主题管道
+)
+
+const (
+	FanoutModeAuto  int = iota // 根据成员数量自动选择（成员数量达到Options.GroupReadFanoutThreshold使用读扩散）
+	FanoutModeWrite            // 写扩散 消息复制到每个成员的个人管道
+	FanoutModeRead             // 读扩散 消息只存储在群组管道，在线成员直接推送，离线成员同步时按读取游标拉取（只支持单机，集群模式下使用写扩散）
 )
 
 type ChannelModel struct {
-	ChannelID uint64
+	ChannelID   uint64
 	ChannelType int
+	FanoutMode  int    // 群组管道的消息扩散模式
+	Tag         string // 广播管道的目标标签 为空表示所有客户端
+	Topic       string // 主题管道的主题 例如 building/3/1/temperature
 }
 
-func NewChannelModel(channelID uint64,channelType int) *ChannelModel  {
+func NewChannelModel(channelID uint64, channelType int) *ChannelModel {
 
 	return &ChannelModel{
-		ChannelID: channelID,
-		ChannelType:channelType,
+		ChannelID:   channelID,
+		ChannelType: channelType,
 	}
 }
 
-func (cm *ChannelModel) NewChannel(ctx *Context) Channel  {
-	switch cm.ChannelType {
-	case ChannelTypePerson:
-		return NewPersonChannel(cm.ChannelID,cm,ctx)
-	case ChannelTypeGroup:
-		return NewGroupChannel(cm.ChannelID,cm,ctx)
-	default:
-		ctx.TGO.GetOpts().Log.Warn("不支持的通道类型[%d]",cm.ChannelType)
+// NewChannel 通过Builder指定或登记的管道类型创建管道（见RegistryChannelType）
+func (cm *ChannelModel) NewChannel(ctx *Context) Channel {
+	var channel Channel
+	if newFunc, ok := ctx.TGO.channelTypes[cm.ChannelType]; ok {
+		channel = newFunc(cm, ctx)
+	} else {
+		channel = NewChannelByType(cm, ctx)
 	}
-	return nil
+	if channel == nil {
+		logf(ctx.TGO.GetOpts().Log, WarnLevel, []Field{FieldChannelID(cm.ChannelID)}, "不支持的通道类型[%d]", cm.ChannelType)
+	}
+	return channel
 }
 
 type Channel interface {
@@ -48,6 +60,24 @@ type Channel interface {
 	PutMsg(msg *Msg) error
 	// DeliveryMsgChan 投递消息的chan （只投递不存储消息）
 	DeliveryMsgChan() chan *Msg
+	// Close 关闭管道（停止投递协程，关闭后的管道不能再使用）
+	Close() error
+}
+
+// PinnedChannel 常驻内存的管道 Pinned返回true时不会被空闲淘汰
+type PinnedChannel interface {
+	Pinned() bool
+}
+
+// MessageCounter 可以统计消息数量的管道（管理接口使用）
+type MessageCounter interface {
+	GetMessageCount() uint64
+}
+
+// MsgSyncer 客户端连接后需要主动同步消息的管道（例如读扩散的群组管道）
+type MsgSyncer interface {
+	// SyncMsg 将客户端未读的消息推送到连接
+	SyncMsg(clientID uint64, conn Conn) error
 }
 
 // 群组管道
@@ -55,7 +85,7 @@ type GroupChannel struct {
 	channelID    uint64
 	MessageCount uint64
 	sync.RWMutex
-	Ctx *Context
+	Ctx   *Context
 	model *ChannelModel
 
 	inFlightMessages map[uint64]*Msg
@@ -65,17 +95,26 @@ type GroupChannel struct {
 	connMap map[uint64]*Conn
 
 	deliveryMsgChan chan *Msg
+	exitChan        chan int
+	closeOnce       sync.Once
 	waitGroup       WaitGroupWrapper
 	started         bool // 是否已开始
+
+	cursorMap   map[uint64]uint64 // 读扩散时成员的读取游标（最后投递的消息ID） 定时持久化到存储
+	cursorDirty map[uint64]bool   // 还未持久化的游标
+	cursorLock  sync.Mutex
 }
 
-func NewGroupChannel(channelID uint64,model *ChannelModel,ctx *Context) *GroupChannel {
+func NewGroupChannel(channelID uint64, model *ChannelModel, ctx *Context) *GroupChannel {
 	c := &GroupChannel{
 		connMap:         map[uint64]*Conn{},
+		cursorMap:       map[uint64]uint64{},
+		cursorDirty:     map[uint64]bool{},
 		channelID:       channelID,
 		deliveryMsgChan: make(chan *Msg, 1024),
-		Ctx:ctx,
-		model:model,
+		exitChan:        make(chan int, 0),
+		Ctx:             ctx,
+		model:           model,
 	}
 	c.waitGroup.Wrap(func() {
 		c.startDeliveryMsg()
@@ -97,7 +136,18 @@ func (c *GroupChannel) SetContext(ctx *Context) {
 }
 
 func (c *GroupChannel) PutMsg(msg *Msg) error {
-	err := c.Ctx.TGO.Storage.AddMsgInChannel(msg,c.channelID)
+	cleared, err := c.Ctx.TGO.putRetainMsg(c.channelID, msg)
+	if err != nil || cleared {
+		return err
+	}
+	if msg.ReadFanout, err = c.readFanout(); err != nil {
+		return err
+	}
+	span := c.Ctx.TGO.startMsgSpan(SpanStorageAddMsg, msg, c.channelID)
+	start := time.Now()
+	err = c.Ctx.TGO.Storage.AddMsgInChannel(msg, c.channelID)
+	c.Ctx.TGO.monitorStorage("add_msg", start)
+	c.Ctx.TGO.finishSpan(span, err)
 	if err != nil {
 		return err
 	}
@@ -113,19 +163,52 @@ func (c *GroupChannel) Model() *ChannelModel {
 	return c.model
 }
 
+// GetMessageCount 放入管道的消息数量
+func (c *GroupChannel) GetMessageCount() uint64 {
+	return atomic.LoadUint64(&c.MessageCount)
+}
+
+// Close 关闭管道 通知投递协程投递完队列中的消息后退出，不等待投递完成
+func (c *GroupChannel) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.exitChan)
+	})
+	return nil
+}
+
 // DeliveryMsg 投递消息
 func (c *GroupChannel) startDeliveryMsg() {
+	flushInterval := c.Ctx.TGO.GetOpts().SyncTimeout
+	if flushInterval <= 0 {
+		flushInterval = 2 * time.Second
+	}
+	flushTicker := time.NewTicker(flushInterval)
+	defer flushTicker.Stop()
 	for {
 		select {
 		case msg := <-c.deliveryMsgChan:
+			span := c.Ctx.TGO.startSpan(SpanChannelDelivery, msg, c.channelID)
 			c.deliveryMsg(msg)
+			c.Ctx.TGO.finishSpan(span, nil)
+		case <-flushTicker.C:
+			c.flushCursor()
+		case <-c.exitChan:
+			goto exit
 		}
 	}
+exit:
+	for len(c.deliveryMsgChan) > 0 { // 投递关闭前已经放入队列的消息
+		c.deliveryMsg(<-c.deliveryMsgChan)
+	}
+	c.flushCursor()
+	c.Debug("停止投递消息。")
 }
 
 func (c *GroupChannel) deliveryMsg(msg *Msg) {
 	c.Debug("开始投递消息[%d]！", msg.MessageID)
+	start := time.Now()
 	clientIDs, err := c.Ctx.TGO.Storage.GetClientIDs(c.channelID)
+	c.Ctx.TGO.monitorStorage("get_client_ids", start)
 	if err != nil {
 		c.Error("获取管道[%d]的客户端ID集合失败！ -> %v", c.channelID, err)
 		return
@@ -134,6 +217,10 @@ func (c *GroupChannel) deliveryMsg(msg *Msg) {
 		c.Warn("Channel[%d]里没有客户端！", c.channelID)
 		return
 	}
+	if msg.ReadFanout {
+		c.deliveryMsgByRead(msg, clientIDs)
+		return
+	}
 	for _, clientID := range clientIDs {
 		personChannel, err := c.Ctx.TGO.GetChannel(clientID)
 		if err != nil {
@@ -144,7 +231,10 @@ func (c *GroupChannel) deliveryMsg(msg *Msg) {
 			c.Warn("没有查询到通道Channel[%d]！", clientID)
 			continue
 		}
-		err = personChannel.PutMsg(msg)
+		personMsg := *msg
+		personMsg.Retain = false // 保留消息只属于群组管道
+		personMsg.ReadFanout = false
+		err = personChannel.PutMsg(&personMsg)
 		//TODO PutMsg 发生错误 怎么处理 (暂时不考虑，后面可以进行重新同步之类的反正消息是收到了存储到了管道内，只是没下发到用户的管道内)
 		// TODO 出现这种情况会出现客户端丢消息情况
 		if err != nil {
@@ -170,13 +260,11 @@ func (c *GroupChannel) String() string {
 	return fmt.Sprintf("ChannelID: %d MessageCount: %d", c.channelID, c.MessageCount)
 }
 
-
-
 type PersonChannel struct {
 	channelID    uint64
 	MessageCount uint64
 	sync.RWMutex
-	Ctx *Context
+	Ctx   *Context
 	model *ChannelModel
 
 	inFlightMessages map[uint64]*Msg
@@ -186,16 +274,19 @@ type PersonChannel struct {
 	connMap map[uint64]*Conn
 
 	deliveryMsgChan chan *Msg
+	exitChan        chan int
+	closeOnce       sync.Once
 	waitGroup       WaitGroupWrapper
 }
 
-func NewPersonChannel(channelID uint64,model *ChannelModel,ctx *Context) *PersonChannel {
+func NewPersonChannel(channelID uint64, model *ChannelModel, ctx *Context) *PersonChannel {
 	c := &PersonChannel{
 		connMap:         map[uint64]*Conn{},
 		channelID:       channelID,
 		deliveryMsgChan: make(chan *Msg, 1024),
-		Ctx:ctx,
-		model:model,
+		exitChan:        make(chan int, 0),
+		Ctx:             ctx,
+		model:           model,
 	}
 	c.waitGroup.Wrap(func() {
 		c.startDeliveryMsg()
@@ -213,7 +304,15 @@ func (c *PersonChannel) initPQ() {
 }
 
 func (c *PersonChannel) PutMsg(msg *Msg) error {
-	err := c.Ctx.TGO.Storage.AddMsgInChannel(msg,c.channelID)
+	cleared, err := c.Ctx.TGO.putRetainMsg(c.channelID, msg)
+	if err != nil || cleared {
+		return err
+	}
+	span := c.Ctx.TGO.startMsgSpan(SpanStorageAddMsg, msg, c.channelID)
+	start := time.Now()
+	err = c.Ctx.TGO.Storage.AddMsgInChannel(msg, c.channelID)
+	c.Ctx.TGO.monitorStorage("add_msg", start)
+	c.Ctx.TGO.finishSpan(span, err)
 	if err != nil {
 		return err
 	}
@@ -229,19 +328,43 @@ func (c *PersonChannel) Model() *ChannelModel {
 	return c.model
 }
 
+// GetMessageCount 放入管道的消息数量
+func (c *PersonChannel) GetMessageCount() uint64 {
+	return atomic.LoadUint64(&c.MessageCount)
+}
+
+// Close 关闭管道 通知投递协程投递完队列中的消息后退出，不等待投递完成
+func (c *PersonChannel) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.exitChan)
+	})
+	return nil
+}
+
 // DeliveryMsg 投递消息
 func (c *PersonChannel) startDeliveryMsg() {
 	for {
 		select {
 		case msg := <-c.deliveryMsgChan:
+			span := c.Ctx.TGO.startSpan(SpanChannelDelivery, msg, c.channelID)
 			c.deliveryMsg(msg)
+			c.Ctx.TGO.finishSpan(span, nil)
+		case <-c.exitChan:
+			goto exit
 		}
 	}
+exit:
+	for len(c.deliveryMsgChan) > 0 { // 投递关闭前已经放入队列的消息
+		c.deliveryMsg(<-c.deliveryMsgChan)
+	}
+	c.Debug("停止投递消息。")
 }
 
 func (c *PersonChannel) deliveryMsg(msg *Msg) {
 	c.Debug("开始投递消息[%d]！", msg.MessageID)
+	start := time.Now()
 	clientIDs, err := c.Ctx.TGO.Storage.GetClientIDs(c.channelID)
+	c.Ctx.TGO.monitorStorage("get_client_ids", start)
 	if err != nil {
 		c.Error("获取管道[%d]的客户端ID集合失败！ -> %v", c.channelID, err)
 		return
@@ -256,18 +379,13 @@ func (c *PersonChannel) deliveryMsg(msg *Msg) {
 		}
 		conn := c.Ctx.TGO.ConnManager.GetConn(clientID)
 		if conn != nil {
-			msgPacket := packets.NewMessagePacket(msg.MessageID, c.channelID, msg.Payload)
-			msgPacket.From = msg.From
-			msgPacketData, err := c.Ctx.TGO.GetOpts().Pro.EncodePacket(msgPacket)
-			if err != nil {
-				c.Error("编码消息[%d]数据失败！-> %v", msg.MessageID, err)
-				continue
-			}
-			_, err = conn.Write(msgPacketData)
+			err = c.Ctx.TGO.WriteMsg(conn, c.channelID, msg)
 			if err != nil {
 				c.Error("写入消息[%d]数据失败！-> %v", msg.MessageID, err)
 				continue
 			}
+		} else if c.Ctx.TGO.forwardMsg(clientID, c.channelID, msg) {
+			c.Debug("消息[%d]已转发到客户端[%d]所在的节点！", msg.MessageID, clientID)
 		} else {
 			c.Debug("客户端[%d]不在线！", clientID)
 		}
@@ -294,27 +412,27 @@ func (c *PersonChannel) String() string {
 // ---------- log --------------
 
 func (c *GroupChannel) Info(f string, args ...interface{}) {
-	c.Ctx.TGO.GetOpts().Log.Info(fmt.Sprintf("%s[%d] -> ", c.getLogPrefix(), c.channelID)+f, args...)
+	logf(c.Ctx.TGO.GetOpts().Log, InfoLevel, []Field{FieldChannelID(c.channelID)}, c.getLogPrefix()+" -> "+f, args...)
 	return
 }
 
 func (c *GroupChannel) Error(f string, args ...interface{}) {
-	c.Ctx.TGO.GetOpts().Log.Error(fmt.Sprintf("%s[%d] -> ", c.getLogPrefix(), c.channelID)+f, args...)
+	logf(c.Ctx.TGO.GetOpts().Log, ErrorLevel, []Field{FieldChannelID(c.channelID)}, c.getLogPrefix()+" -> "+f, args...)
 	return
 }
 
 func (c *GroupChannel) Debug(f string, args ...interface{}) {
-	c.Ctx.TGO.GetOpts().Log.Debug(fmt.Sprintf("%s[%d] -> ", c.getLogPrefix(), c.channelID)+f, args...)
+	logf(c.Ctx.TGO.GetOpts().Log, DebugLevel, []Field{FieldChannelID(c.channelID)}, c.getLogPrefix()+" -> "+f, args...)
 	return
 }
 
 func (c *GroupChannel) Warn(f string, args ...interface{}) {
-	c.Ctx.TGO.GetOpts().Log.Warn(fmt.Sprintf("%s[%d] -> ", c.getLogPrefix(), c.channelID)+f, args...)
+	logf(c.Ctx.TGO.GetOpts().Log, WarnLevel, []Field{FieldChannelID(c.channelID)}, c.getLogPrefix()+" -> "+f, args...)
 	return
 }
 
 func (c *GroupChannel) Fatal(f string, args ...interface{}) {
-	c.Ctx.TGO.GetOpts().Log.Fatal(fmt.Sprintf("%s[%d] -> ", c.getLogPrefix(), c.channelID)+f, args...)
+	logf(c.Ctx.TGO.GetOpts().Log, FatalLevel, []Field{FieldChannelID(c.channelID)}, c.getLogPrefix()+" -> "+f, args...)
 	return
 }
 
@@ -323,27 +441,27 @@ func (c *GroupChannel) getLogPrefix() string {
 }
 
 func (c *PersonChannel) Info(f string, args ...interface{}) {
-	c.Ctx.TGO.GetOpts().Log.Info(fmt.Sprintf("%s[%d] -> ", c.getLogPrefix(), c.channelID)+f, args...)
+	logf(c.Ctx.TGO.GetOpts().Log, InfoLevel, []Field{FieldChannelID(c.channelID)}, c.getLogPrefix()+" -> "+f, args...)
 	return
 }
 
 func (c *PersonChannel) Error(f string, args ...interface{}) {
-	c.Ctx.TGO.GetOpts().Log.Error(fmt.Sprintf("%s[%d] -> ", c.getLogPrefix(), c.channelID)+f, args...)
+	logf(c.Ctx.TGO.GetOpts().Log, ErrorLevel, []Field{FieldChannelID(c.channelID)}, c.getLogPrefix()+" -> "+f, args...)
 	return
 }
 
 func (c *PersonChannel) Debug(f string, args ...interface{}) {
-	c.Ctx.TGO.GetOpts().Log.Debug(fmt.Sprintf("%s[%d] -> ", c.getLogPrefix(), c.channelID)+f, args...)
+	logf(c.Ctx.TGO.GetOpts().Log, DebugLevel, []Field{FieldChannelID(c.channelID)}, c.getLogPrefix()+" -> "+f, args...)
 	return
 }
 
 func (c *PersonChannel) Warn(f string, args ...interface{}) {
-	c.Ctx.TGO.GetOpts().Log.Warn(fmt.Sprintf("%s[%d] -> ", c.getLogPrefix(), c.channelID)+f, args...)
+	logf(c.Ctx.TGO.GetOpts().Log, WarnLevel, []Field{FieldChannelID(c.channelID)}, c.getLogPrefix()+" -> "+f, args...)
 	return
 }
 
 func (c *PersonChannel) Fatal(f string, args ...interface{}) {
-	c.Ctx.TGO.GetOpts().Log.Fatal(fmt.Sprintf("%s[%d] -> ", c.getLogPrefix(), c.channelID)+f, args...)
+	logf(c.Ctx.TGO.GetOpts().Log, FatalLevel, []Field{FieldChannelID(c.channelID)}, c.getLogPrefix()+" -> "+f, args...)
 	return
 }
 
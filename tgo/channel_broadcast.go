@@ -0,0 +1,191 @@
+package tgo
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BroadcastChannel 广播管道 消息只存储一次，投递给所有在线连接（或带有管道标签的在线连接），离线客户端连接后按读取游标同步
+type BroadcastChannel struct {
+	channelID     uint64
+	MessageCount  uint64
+	lastMessageID uint64 // 最后投递的消息ID（原子操作）
+	Ctx           *Context
+	model         *ChannelModel
+
+	deliveryMsgChan chan *Msg
+	exitChan        chan int
+	closeOnce       sync.Once
+	waitGroup       WaitGroupWrapper
+}
+
+func NewBroadcastChannel(channelID uint64, model *ChannelModel, ctx *Context) *BroadcastChannel {
+	c := &BroadcastChannel{
+		channelID:       channelID,
+		deliveryMsgChan: make(chan *Msg, 1024),
+		exitChan:        make(chan int, 0),
+		Ctx:             ctx,
+		model:           model,
+	}
+	c.waitGroup.Wrap(func() {
+		c.startDeliveryMsg()
+	})
+	return c
+}
+
+func (c *BroadcastChannel) PutMsg(msg *Msg) error {
+	cleared, err := c.Ctx.TGO.putRetainMsg(c.channelID, msg)
+	if err != nil || cleared {
+		return err
+	}
+	span := c.Ctx.TGO.startMsgSpan(SpanStorageAddMsg, msg, c.channelID)
+	start := time.Now()
+	err = c.Ctx.TGO.Storage.AddMsgInChannel(msg, c.channelID)
+	c.Ctx.TGO.monitorStorage("add_msg", start)
+	c.Ctx.TGO.finishSpan(span, err)
+	if err != nil {
+		return err
+	}
+	atomic.AddUint64(&c.MessageCount, 1)
+	return nil
+}
+
+func (c *BroadcastChannel) DeliveryMsgChan() chan *Msg {
+	return c.deliveryMsgChan
+}
+
+func (c *BroadcastChannel) Model() *ChannelModel {
+	return c.model
+}
+
+// GetMessageCount 放入管道的消息数量
+func (c *BroadcastChannel) GetMessageCount() uint64 {
+	return atomic.LoadUint64(&c.MessageCount)
+}
+
+// Close 关闭管道 通知投递协程投递完队列中的消息后退出，不等待投递完成
+func (c *BroadcastChannel) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.exitChan)
+	})
+	return nil
+}
+
+// Pinned 广播管道需要记录最后投递的消息，常驻内存不被空闲淘汰
+func (c *BroadcastChannel) Pinned() bool {
+	return true
+}
+
+func (c *BroadcastChannel) startDeliveryMsg() {
+	for {
+		select {
+		case msg := <-c.deliveryMsgChan:
+			span := c.Ctx.TGO.startSpan(SpanChannelDelivery, msg, c.channelID)
+			c.deliveryMsg(msg)
+			c.Ctx.TGO.finishSpan(span, nil)
+		case <-c.exitChan:
+			goto exit
+		}
+	}
+exit:
+	for len(c.deliveryMsgChan) > 0 { // 投递关闭前已经放入队列的消息
+		c.deliveryMsg(<-c.deliveryMsgChan)
+	}
+	c.Debug("停止投递消息。")
+}
+
+func (c *BroadcastChannel) deliveryMsg(msg *Msg) {
+	c.Debug("开始投递消息[%d]！", msg.MessageID)
+	for clientID, conn := range c.Ctx.TGO.ConnManager.Conns() {
+		if clientID == msg.From || !c.targeted(clientID) {
+			continue
+		}
+		err := c.Ctx.TGO.WriteMsg(conn, c.channelID, msg)
+		if err != nil {
+			c.Error("写入消息[%d]到客户端[%d]失败！-> %v", msg.MessageID, clientID, err)
+		}
+	}
+	atomic.StoreUint64(&c.lastMessageID, msg.MessageID)
+}
+
+// targeted 客户端是否为广播的目标
+func (c *BroadcastChannel) targeted(clientID uint64) bool {
+	return c.model.Tag == "" || c.Ctx.TGO.ConnManager.HasTag(clientID, c.model.Tag)
+}
+
+// SyncMsg 将客户端读取游标之后的广播消息推送给客户端
+func (c *BroadcastChannel) SyncMsg(clientID uint64, conn Conn) error {
+	cursorStorage, ok := c.Ctx.TGO.Storage.(CursorStorage)
+	if !ok || !c.targeted(clientID) {
+		return nil
+	}
+	cursor, err := cursorStorage.GetReadCursor(clientID, c.channelID)
+	if err != nil {
+		return err
+	}
+	lastCursor := cursor
+	var pageSize int64 = 100
+	for {
+		msgList, err := cursorStorage.GetMsgInChannelAfter(c.channelID, cursor, pageSize)
+		if err != nil {
+			return err
+		}
+		for _, msg := range msgList {
+			if msg.From != clientID {
+				err = c.Ctx.TGO.WriteMsg(conn, c.channelID, msg)
+				if err != nil {
+					return err
+				}
+			}
+			cursor = msg.MessageID
+		}
+		if int64(len(msgList)) < pageSize {
+			break
+		}
+	}
+	if cursor != lastCursor {
+		return cursorStorage.UpdateReadCursor(clientID, c.channelID, cursor)
+	}
+	return nil
+}
+
+// MarkRead 客户端下线时将读取游标移动到最后投递的消息（在线期间的广播已经直接推送）
+func (c *BroadcastChannel) MarkRead(clientID uint64) error {
+	cursorStorage, ok := c.Ctx.TGO.Storage.(CursorStorage)
+	if !ok {
+		return nil
+	}
+	lastMessageID := atomic.LoadUint64(&c.lastMessageID)
+	if lastMessageID == 0 {
+		return nil
+	}
+	return cursorStorage.UpdateReadCursor(clientID, c.channelID, lastMessageID)
+}
+
+func (c *BroadcastChannel) String() string {
+	return fmt.Sprintf("ChannelID: %d MessageCount: %d", c.channelID, c.MessageCount)
+}
+
+// ---------- log --------------
+
+func (c *BroadcastChannel) Info(f string, args ...interface{}) {
+	logf(c.Ctx.TGO.GetOpts().Log, InfoLevel, []Field{FieldChannelID(c.channelID)}, c.getLogPrefix()+" -> "+f, args...)
+}
+
+func (c *BroadcastChannel) Error(f string, args ...interface{}) {
+	logf(c.Ctx.TGO.GetOpts().Log, ErrorLevel, []Field{FieldChannelID(c.channelID)}, c.getLogPrefix()+" -> "+f, args...)
+}
+
+func (c *BroadcastChannel) Debug(f string, args ...interface{}) {
+	logf(c.Ctx.TGO.GetOpts().Log, DebugLevel, []Field{FieldChannelID(c.channelID)}, c.getLogPrefix()+" -> "+f, args...)
+}
+
+func (c *BroadcastChannel) Warn(f string, args ...interface{}) {
+	logf(c.Ctx.TGO.GetOpts().Log, WarnLevel, []Field{FieldChannelID(c.channelID)}, c.getLogPrefix()+" -> "+f, args...)
+}
+
+func (c *BroadcastChannel) getLogPrefix() string {
+	return "【Chanel-Broadcast】"
+}
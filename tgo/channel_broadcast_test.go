@@ -0,0 +1,59 @@
+package tgo
+
+import (
+	"testing"
+)
+
+func TestBroadcastChannel_deliveryMsg(t *testing.T) {
+	opts := NewOptions()
+	opts.Pro = &ProtocolTest{}
+	tg := startTGO(opts)
+	defer tg.Stop()
+
+	var broadcastID uint64 = 500
+	broadcastModel := NewChannelModel(broadcastID, ChannelTypeBroadcast)
+	broadcastModel.Tag = "vip"
+	tg.Storage.AddChannel(broadcastModel)
+
+	vipConn := &ServerConnTest{}
+	tg.ConnManager.AddConn(1, vipConn)
+	tg.ConnManager.SetTags(1, []string{"vip"})
+	normalConn := &ServerConnTest{}
+	tg.ConnManager.AddConn(2, normalConn)
+
+	channel, err := tg.GetChannel(broadcastID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(1); i <= 2; i++ {
+		if err = channel.PutMsg(NewMsg(i, 0, []byte("announcement"))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, func() bool { return len(vipConn.Writes()) == 2 })
+	if len(normalConn.Writes()) != 0 {
+		t.Fatalf("没有标签的客户端不应该收到定向广播")
+	}
+
+	// 离线的客户端连接后同步广播
+	offlineConn := &ServerConnTest{}
+	tg.ConnManager.AddConn(3, offlineConn)
+	tg.ConnManager.SetTags(3, []string{"vip"})
+	if err = channel.(MsgSyncer).SyncMsg(3, offlineConn); err != nil {
+		t.Fatal(err)
+	}
+	if len(offlineConn.Writes()) != 2 {
+		t.Fatalf("离线客户端应该同步到2条广播，实际为%d条", len(offlineConn.Writes()))
+	}
+	cursor, _ := tg.Storage.(CursorStorage).GetReadCursor(3, broadcastID)
+	if cursor != 2 {
+		t.Fatalf("读取游标应该为2，实际为%d", cursor)
+	}
+
+	// 在线期间收到的广播下线后记录为已读
+	tg.markBroadcastRead(1)
+	cursor, _ = tg.Storage.(CursorStorage).GetReadCursor(1, broadcastID)
+	if cursor != 2 {
+		t.Fatalf("下线后读取游标应该为2，实际为%d", cursor)
+	}
+}
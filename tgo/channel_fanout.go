@@ -0,0 +1,193 @@
+package tgo
+
+import (
+	"sync"
+	"time"
+)
+
+// readFanout 放入群组管道的消息是否使用读扩散 存储没有实现CursorStorage时离线成员无法同步，总是使用写扩散
+// 集群模式下群组消息只保存在发送者所在的节点，其他节点的成员无法推送和同步，也总是使用写扩散（个人管道会转发）
+// 扩散模式记录在消息上（Msg.ReadFanout），成员数量之后变化不影响已经放入的消息
+func (c *GroupChannel) readFanout() (bool, error) {
+	if _, ok := c.cursorStorage(); !ok || c.Ctx.TGO.cluster != nil {
+		return false, nil
+	}
+	switch c.model.FanoutMode {
+	case FanoutModeRead:
+		return true, nil
+	case FanoutModeWrite:
+		return false, nil
+	}
+	threshold := c.Ctx.TGO.GetOpts().GroupReadFanoutThreshold
+	if threshold <= 0 {
+		return false, nil
+	}
+	start := time.Now()
+	clientIDs, err := c.Ctx.TGO.Storage.GetClientIDs(c.channelID)
+	c.Ctx.TGO.monitorStorage("get_client_ids", start)
+	if err != nil {
+		return false, err
+	}
+	return len(clientIDs) >= threshold, nil
+}
+
+// cursorStorage 读扩散需要存储支持读取游标
+func (c *GroupChannel) cursorStorage() (CursorStorage, bool) {
+	cursorStorage, ok := c.Ctx.TGO.Storage.(CursorStorage)
+	return cursorStorage, ok
+}
+
+// syncingClients 已经连接但还没有同步完读扩散消息的客户端
+// 同步完成前在线投递不移动游标，避免游标越过还没有同步的消息（同步期间的消息可能重复推送，客户端按MessageID去重）
+type syncingClients struct {
+	counts map[uint64]int // 同一个客户端可能同时有多个连接在同步
+	sync.Mutex
+}
+
+func newSyncingClients() *syncingClients {
+	return &syncingClients{counts: map[uint64]int{}}
+}
+
+func (s *syncingClients) add(clientID uint64) {
+	s.Lock()
+	s.counts[clientID]++
+	s.Unlock()
+}
+
+func (s *syncingClients) remove(clientID uint64) {
+	s.Lock()
+	if s.counts[clientID]--; s.counts[clientID] <= 0 {
+		delete(s.counts, clientID)
+	}
+	s.Unlock()
+}
+
+func (s *syncingClients) contains(clientID uint64) bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.counts[clientID] > 0
+}
+
+// deliveryMsgByRead 读扩散投递消息 只推送给在线成员，离线成员同步时按游标拉取
+func (c *GroupChannel) deliveryMsgByRead(msg *Msg, clientIDs []uint64) {
+	for _, clientID := range clientIDs {
+		if clientID == msg.From { // 不发送给自己
+			c.advanceCursor(clientID, msg.MessageID)
+			continue
+		}
+		conn := c.Ctx.TGO.ConnManager.GetConn(clientID)
+		if conn == nil {
+			continue
+		}
+		err := c.Ctx.TGO.WriteMsg(conn, c.channelID, msg)
+		if err != nil {
+			c.Error("写入消息[%d]数据失败！-> %v", msg.MessageID, err)
+			continue
+		}
+		c.advanceCursor(clientID, msg.MessageID)
+	}
+}
+
+// advanceCursor 在线投递后移动游标 成员还没有同步完成时游标由同步移动
+func (c *GroupChannel) advanceCursor(clientID uint64, messageID uint64) {
+	if c.Ctx.TGO.syncing.contains(clientID) {
+		return
+	}
+	c.updateCursor(clientID, messageID)
+}
+
+// startCursorAtHead 新成员的游标从管道最新的消息开始 不同步加入之前的消息
+func (c *GroupChannel) startCursorAtHead(clientID uint64) error {
+	cursorStorage, ok := c.cursorStorage()
+	if !ok {
+		return nil
+	}
+	head, err := cursorStorage.GetLastMsgID(c.channelID)
+	if err != nil {
+		return err
+	}
+	if head != 0 {
+		c.updateCursor(clientID, head)
+	}
+	return nil
+}
+
+// SyncMsg 将成员读取游标之后读扩散的消息推送给成员 写扩散的消息由个人管道推送，只移动游标
+func (c *GroupChannel) SyncMsg(clientID uint64, conn Conn) error {
+	cursorStorage, ok := c.cursorStorage()
+	if !ok || c.model.FanoutMode == FanoutModeWrite {
+		return nil
+	}
+	cursor, err := c.getCursor(cursorStorage, clientID)
+	if err != nil {
+		return err
+	}
+	var pageSize int64 = 100
+	for {
+		msgList, err := cursorStorage.GetMsgInChannelAfter(c.channelID, cursor, pageSize)
+		if err != nil {
+			return err
+		}
+		for _, msg := range msgList {
+			if msg.ReadFanout && msg.From != clientID {
+				err = c.Ctx.TGO.WriteMsg(conn, c.channelID, msg)
+				if err != nil {
+					return err
+				}
+			}
+			cursor = msg.MessageID
+			c.updateCursor(clientID, cursor)
+		}
+		if int64(len(msgList)) < pageSize {
+			break
+		}
+	}
+	return nil
+}
+
+// getCursor 获取成员的读取游标 优先使用内存中还未持久化的游标
+func (c *GroupChannel) getCursor(cursorStorage CursorStorage, clientID uint64) (uint64, error) {
+	c.cursorLock.Lock()
+	cursor, ok := c.cursorMap[clientID]
+	c.cursorLock.Unlock()
+	if ok {
+		return cursor, nil
+	}
+	return cursorStorage.GetReadCursor(clientID, c.channelID)
+}
+
+func (c *GroupChannel) updateCursor(clientID uint64, messageID uint64) {
+	c.cursorLock.Lock()
+	c.cursorMap[clientID] = messageID
+	c.cursorDirty[clientID] = true
+	c.cursorLock.Unlock()
+}
+
+// flushCursor 持久化读取游标
+func (c *GroupChannel) flushCursor() {
+	cursorStorage, ok := c.cursorStorage()
+	if !ok {
+		return
+	}
+	c.cursorLock.Lock()
+	if len(c.cursorDirty) == 0 {
+		c.cursorLock.Unlock()
+		return
+	}
+	dirtyCursorMap := make(map[uint64]uint64, len(c.cursorDirty))
+	for clientID := range c.cursorDirty {
+		dirtyCursorMap[clientID] = c.cursorMap[clientID]
+	}
+	c.cursorDirty = map[uint64]bool{}
+	c.cursorLock.Unlock()
+
+	for clientID, messageID := range dirtyCursorMap {
+		err := cursorStorage.UpdateReadCursor(clientID, c.channelID, messageID)
+		if err != nil {
+			c.Warn("保存客户端[%d]的读取游标失败！-> %v", clientID, err)
+			c.cursorLock.Lock()
+			c.cursorDirty[clientID] = true
+			c.cursorLock.Unlock()
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package tgo
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGroupChannel_readFanout(t *testing.T) {
+	opts := NewOptions()
+	opts.Pro = &ProtocolTest{}
+	tg := startTGO(opts)
+	defer tg.Stop()
+
+	var groupID uint64 = 1000
+	groupModel := NewChannelModel(groupID, ChannelTypeGroup)
+	groupModel.FanoutMode = FanoutModeRead
+	tg.Storage.AddChannel(groupModel)
+	for clientID := uint64(1); clientID <= 3; clientID++ {
+		tg.Storage.AddChannel(NewChannelModel(clientID, ChannelTypePerson))
+		tg.Storage.Bind(clientID, clientID)
+		tg.Storage.Bind(clientID, groupID)
+	}
+	onlineConn := &ServerConnTest{}
+	tg.ConnManager.AddConn(1, onlineConn)
+
+	groupChannel, err := tg.GetChannel(groupID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(1); i <= 3; i++ {
+		if err = groupChannel.PutMsg(NewMsg(i, 3, []byte("hello"))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, func() bool { return len(onlineConn.Writes()) == 3 })
+
+	// 读扩散不写入成员的个人管道
+	msgList, _ := tg.Storage.GetMsgInChannel(2, 1, 100)
+	if len(msgList) != 0 {
+		t.Fatalf("读扩散不应该写入个人管道，实际写入了%d条", len(msgList))
+	}
+
+	// 离线成员同步时按游标拉取
+	offlineConn := &ServerConnTest{}
+	if err = groupChannel.(MsgSyncer).SyncMsg(2, offlineConn); err != nil {
+		t.Fatal(err)
+	}
+	if len(offlineConn.Writes()) != 3 {
+		t.Fatalf("离线成员应该同步到3条消息，实际为%d条", len(offlineConn.Writes()))
+	}
+	groupChannel.(*GroupChannel).flushCursor()
+	cursor, _ := tg.Storage.(CursorStorage).GetReadCursor(2, groupID)
+	if cursor != 3 {
+		t.Fatalf("读取游标应该为3，实际为%d", cursor)
+	}
+	groupChannel.PutMsg(NewMsg(4, 3, []byte("hello")))
+	waitFor(t, func() bool { return len(onlineConn.Writes()) == 4 })
+	offlineConn = &ServerConnTest{}
+	groupChannel.(MsgSyncer).SyncMsg(2, offlineConn)
+	if len(offlineConn.Writes()) != 1 {
+		t.Fatalf("再次同步应该只同步到1条消息，实际为%d条", len(offlineConn.Writes()))
+	}
+}
+
+// TestGroupChannel_readFanout_reconnect 成员同步完成前在线投递的消息不移动游标 新成员从最新的消息开始
+func TestGroupChannel_readFanout_reconnect(t *testing.T) {
+	opts := NewOptions()
+	opts.Pro = &ProtocolTest{}
+	tg := startTGO(opts)
+	defer tg.Stop()
+
+	var groupID uint64 = 1000
+	groupModel := NewChannelModel(groupID, ChannelTypeGroup)
+	groupModel.FanoutMode = FanoutModeRead
+	tg.Storage.AddChannel(groupModel)
+	for clientID := uint64(1); clientID <= 3; clientID++ {
+		tg.Storage.AddChannel(NewChannelModel(clientID, ChannelTypePerson))
+		tg.Storage.Bind(clientID, clientID)
+	}
+	tg.Storage.Bind(2, groupID)
+	tg.Storage.Bind(1, groupID)
+	groupChannel, err := tg.GetChannel(groupID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(1); i <= 2; i++ {
+		groupChannel.PutMsg(NewMsg(i, 1, []byte("hello")))
+	}
+	waitFor(t, func() bool { // 发送者的游标在成员2之后移动 说明离线消息已经投递完
+		cursor, _ := groupChannel.(*GroupChannel).getCursor(tg.Storage.(CursorStorage), 1)
+		return cursor == 2
+	})
+
+	// 成员2重新连接 同步之前收到在线消息
+	conn := &ServerConnTest{}
+	tg.syncing.add(2)
+	tg.ConnManager.AddConn(2, conn)
+	groupChannel.PutMsg(NewMsg(3, 1, []byte("hello")))
+	waitFor(t, func() bool { return len(conn.Writes()) == 1 })
+	if err = groupChannel.(MsgSyncer).SyncMsg(2, conn); err != nil {
+		t.Fatal(err)
+	}
+	tg.syncing.remove(2)
+	if len(conn.Writes()) != 4 {
+		t.Fatalf("同步应该推送在线消息之前的离线消息，实际推送了%d条", len(conn.Writes()))
+	}
+
+	// 新成员不同步加入之前的消息
+	if err = tg.Bind(3, groupID); err != nil {
+		t.Fatal(err)
+	}
+	newConn := &ServerConnTest{}
+	groupChannel.(MsgSyncer).SyncMsg(3, newConn)
+	if len(newConn.Writes()) != 0 {
+		t.Fatalf("新成员不应该同步到加入之前的消息，实际为%d条", len(newConn.Writes()))
+	}
+	if err = groupChannel.PutMsg(NewMsg(4, 1, []byte("hello"))); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return len(conn.Writes()) == 5 })
+	groupChannel.(MsgSyncer).SyncMsg(3, newConn)
+	if len(newConn.Writes()) != 1 {
+		t.Fatalf("新成员应该同步到加入之后的1条消息，实际为%d条", len(newConn.Writes()))
+	}
+}
+
+// TestGroupChannel_readFanout_auto 扩散模式在放入消息时确定 成员数量之后变化时同步只推送读扩散的消息
+func TestGroupChannel_readFanout_auto(t *testing.T) {
+	opts := NewOptions()
+	opts.Pro = &ProtocolTest{}
+	opts.GroupReadFanoutThreshold = 3
+	tg := startTGO(opts)
+	defer tg.Stop()
+
+	var groupID uint64 = 1000
+	tg.Storage.AddChannel(NewChannelModel(groupID, ChannelTypeGroup))
+	for clientID := uint64(1); clientID <= 3; clientID++ {
+		tg.Storage.AddChannel(NewChannelModel(clientID, ChannelTypePerson))
+		tg.Storage.Bind(clientID, clientID)
+	}
+	tg.Storage.Bind(1, groupID)
+	tg.Storage.Bind(2, groupID)
+	groupChannel, err := tg.GetChannel(groupID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	groupChannel.PutMsg(NewMsg(1, 1, []byte("write")))
+	waitFor(t, func() bool { // 写扩散 复制到成员的个人管道
+		msgList, _ := tg.Storage.GetMsgInChannel(2, 1, 100)
+		return len(msgList) == 1
+	})
+	tg.Storage.Bind(3, groupID)
+	groupChannel.PutMsg(NewMsg(2, 1, []byte("read")))
+	waitFor(t, func() bool {
+		cursor, _ := groupChannel.(*GroupChannel).getCursor(tg.Storage.(CursorStorage), 1)
+		return cursor == 2
+	})
+
+	tg.GetOpts().GroupReadFanoutThreshold = 10 // 成员数量低于阈值后 读扩散的消息仍然需要同步
+	conn := &ServerConnTest{}
+	if err = groupChannel.(MsgSyncer).SyncMsg(2, conn); err != nil {
+		t.Fatal(err)
+	}
+	if writes := conn.Writes(); len(writes) != 1 || !strings.Contains(writes[0], "read") {
+		t.Fatalf("同步应该只推送读扩散的消息！-> %v", writes)
+	}
+}
+
+// TestGroupChannel_readFanout_plainStorage 存储没有实现CursorStorage时使用写扩散 离线成员从个人管道收到消息
+func TestGroupChannel_readFanout_plainStorage(t *testing.T) {
+	opts := NewOptions()
+	opts.Pro = &ProtocolTest{}
+	opts.GroupReadFanoutThreshold = 1
+	tg := startBuilder(newTestBuilder(opts).Storage(func(context *Context) Storage {
+		return struct{ Storage }{NewMemoryStorage(context)}
+	}))
+	defer tg.Stop()
+
+	var groupID uint64 = 1000
+	groupModel := NewChannelModel(groupID, ChannelTypeGroup)
+	groupModel.FanoutMode = FanoutModeRead
+	tg.Storage.AddChannel(groupModel)
+	for clientID := uint64(1); clientID <= 2; clientID++ {
+		tg.Storage.AddChannel(NewChannelModel(clientID, ChannelTypePerson))
+		tg.Storage.Bind(clientID, clientID)
+		tg.Storage.Bind(clientID, groupID)
+	}
+	groupChannel, err := tg.GetChannel(groupID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = groupChannel.PutMsg(NewMsg(1, 1, []byte("hello"))); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		msgList, _ := tg.Storage.GetMsgInChannel(2, 1, 100)
+		return len(msgList) == 1
+	})
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("等待超时！")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,151 @@
+package tgo
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrChannelNotExist = errors.New("管道不存在！")
+
+// GetChannel 通过[channelID]获取管道信息
+// 已加载的管道只需要分片读锁，未加载的管道在锁外从存储加载，同一个管道的并发查询只会加载一次
+// 返回的管道之后可能被淘汰（关闭），需要向投递队列放入消息时使用acquireChannel
+func (t *TGO) GetChannel(channelID uint64) (Channel, error) {
+	entry, err := t.getChannelEntry(channelID, false)
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	return entry.channel, nil
+}
+
+// acquireChannel 获取并固定管道 固定期间管道不会被淘汰 使用完成后需要调用release
+// 管道不存在时返回的管道为nil
+func (t *TGO) acquireChannel(channelID uint64) (channel Channel, release func(), err error) {
+	entry, err := t.getChannelEntry(channelID, true)
+	if err != nil || entry == nil {
+		return nil, func() {}, err
+	}
+	return entry.channel, entry.release, nil
+}
+
+func (t *TGO) getChannelEntry(channelID uint64, pin bool) (*channelEntry, error) {
+	entry, loaded, err := t.channels.getOrLoad(channelID, pin, func() (Channel, error) {
+		start := time.Now()
+		channelModel, err := t.Storage.GetChannel(channelID)
+		t.monitorStorage("get_channel", start)
+		if err != nil {
+			return nil, err
+		}
+		if channelModel == nil {
+			return nil, nil
+		}
+		return channelModel.NewChannel(t.ctx), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if loaded {
+		t.monitorCounter(metricChannelsCreated, nil, 1)
+		t.monitorGaugeAdd(metricChannels, nil, 1)
+		t.evictOverflowChannel()
+	}
+	return entry, nil
+}
+
+// ChannelCount 当前已加载（存活）的管道数量
+func (t *TGO) ChannelCount() int {
+	return t.channels.len()
+}
+
+// evictOverflowChannel 管道数量超过MaxChannelNum时淘汰最久未使用的管道
+func (t *TGO) evictOverflowChannel() {
+	maxChannelNum := t.GetOpts().MaxChannelNum
+	if maxChannelNum <= 0 {
+		return
+	}
+	for t.channels.len() > maxChannelNum {
+		channelID, entry := t.channels.oldest()
+		if entry == nil {
+			return
+		}
+		if !t.channels.remove(channelID, entry) { // 管道刚被固定或者放入了消息 下次再淘汰
+			return
+		}
+		t.closeChannel(entry.channel)
+		t.monitorCounter(metricChannelsEvicted, nil, 1)
+	}
+}
+
+// closeChannel 关闭管道
+func (t *TGO) closeChannel(channel Channel) {
+	err := channel.Close()
+	if err != nil {
+		t.Warn("关闭管道[%d]失败！-> %v", channel.Model().ChannelID, err)
+	}
+	t.monitorGaugeAdd(metricChannels, nil, -1)
+}
+
+// channelEvictLoop 定时淘汰空闲的管道
+func (t *TGO) channelEvictLoop() {
+	scanInterval := t.GetOpts().ChannelScanInterval
+	if scanInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(scanInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.evictIdleChannel()
+		case <-t.exitChan:
+			goto exit
+		}
+	}
+exit:
+	t.Debug("停止淘汰空闲管道。")
+}
+
+// evictIdleChannel 淘汰超过ChannelIdleTimeout没有使用、没有在线成员并且投递队列为空的管道
+func (t *TGO) evictIdleChannel() {
+	idleTimeout := t.GetOpts().ChannelIdleTimeout
+	if idleTimeout <= 0 {
+		return
+	}
+	idleBefore := time.Now().Add(-idleTimeout).UnixNano()
+	for channelID, entry := range t.channels.idleEntries(idleBefore) {
+		online, err := t.hasOnlineMember(channelID) // 查询在线成员需要访问存储，不能持有锁
+		if err != nil {
+			t.Warn("查询管道[%d]的在线成员失败！-> %v", channelID, err)
+			continue
+		}
+		if online || entry.getLastActive() > idleBefore {
+			continue
+		}
+		if t.channels.remove(channelID, entry) {
+			t.closeChannel(entry.channel)
+			t.monitorCounter(metricChannelsEvicted, nil, 1)
+			t.Debug("管道[%d]空闲已被淘汰！", channelID)
+		}
+	}
+}
+
+// hasOnlineMember 管道内是否有在线的客户端
+func (t *TGO) hasOnlineMember(channelID uint64) (bool, error) {
+	clientIDs, err := t.Storage.GetClientIDs(channelID)
+	if err != nil {
+		return false, err
+	}
+	for _, clientID := range clientIDs {
+		if t.ConnManager.GetConn(clientID) != nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// closeAllChannel 关闭所有已加载的管道
+func (t *TGO) closeAllChannel() {
+	for _, channel := range t.channels.removeAll() {
+		t.closeChannel(channel)
+	}
+}
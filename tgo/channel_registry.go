@@ -0,0 +1,237 @@
+package tgo
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	channelRegistryShardNum    = 32 // 管道注册表分片数量
+	channelRegistryEvictSample = 5  // 淘汰时每个分片抽样的管道数量（近似LRU）
+)
+
+// channelEntry 已加载管道的记录
+type channelEntry struct {
+	channel    Channel
+	lastActive int64 // 最后一次被使用的时间 纳秒（原子操作）
+	refs       int32 // 固定管道的协程数量（原子操作） 大于0时不会被淘汰
+}
+
+func (e *channelEntry) touch() {
+	atomic.StoreInt64(&e.lastActive, time.Now().UnixNano())
+}
+
+func (e *channelEntry) getLastActive() int64 {
+	return atomic.LoadInt64(&e.lastActive)
+}
+
+// release 取消固定管道
+func (e *channelEntry) release() {
+	atomic.AddInt32(&e.refs, -1)
+}
+
+// evictable 管道没有被固定并且投递队列为空 在分片的写锁内检查结果才是确定的
+func (e *channelEntry) evictable() bool {
+	return atomic.LoadInt32(&e.refs) == 0 && len(e.channel.DeliveryMsgChan()) == 0
+}
+
+// channelLoadCall 正在从存储加载的管道，同一个管道的并发查询只会加载一次
+type channelLoadCall struct {
+	wg      sync.WaitGroup
+	channel Channel
+	err     error
+}
+
+type channelShard struct {
+	sync.RWMutex
+	entries map[uint64]*channelEntry
+	loading map[uint64]*channelLoadCall
+}
+
+// channelRegistry 分片的管道注册表 读多写少，查询已加载的管道只需要分片的读锁
+type channelRegistry struct {
+	shards [channelRegistryShardNum]*channelShard
+	count  int64 // 已加载的管道数量（原子操作）
+}
+
+func newChannelRegistry() *channelRegistry {
+	r := &channelRegistry{}
+	for i := 0; i < channelRegistryShardNum; i++ {
+		r.shards[i] = &channelShard{
+			entries: map[uint64]*channelEntry{},
+			loading: map[uint64]*channelLoadCall{},
+		}
+	}
+	return r
+}
+
+func (r *channelRegistry) shard(channelID uint64) *channelShard {
+	return r.shards[channelID%channelRegistryShardNum]
+}
+
+// get 获取已加载的管道 pin为true时固定管道（持有锁时增加引用，淘汰在写锁内检查引用）
+func (r *channelRegistry) get(channelID uint64, pin bool) (*channelEntry, bool) {
+	shard := r.shard(channelID)
+	shard.RLock()
+	entry, ok := shard.entries[channelID]
+	if ok && pin {
+		atomic.AddInt32(&entry.refs, 1)
+	}
+	shard.RUnlock()
+	return entry, ok
+}
+
+// getOrLoad 获取管道，不存在则调用load加载（在锁外执行），loaded表示管道是否为本次新加载
+// pin为true时返回的entry已被固定，使用完成后需要调用entry.release
+func (r *channelRegistry) getOrLoad(channelID uint64, pin bool, load func() (Channel, error)) (entry *channelEntry, loaded bool, err error) {
+	if entry, ok := r.get(channelID, pin); ok {
+		entry.touch()
+		return entry, false, nil
+	}
+	shard := r.shard(channelID)
+	shard.Lock()
+	if entry, ok := shard.entries[channelID]; ok {
+		if pin {
+			atomic.AddInt32(&entry.refs, 1)
+		}
+		shard.Unlock()
+		entry.touch()
+		return entry, false, nil
+	}
+	if call, ok := shard.loading[channelID]; ok { // 已经有协程在加载，等待加载结果
+		shard.Unlock()
+		call.wg.Wait()
+		if call.err != nil || call.channel == nil {
+			return nil, false, call.err
+		}
+		return r.getOrLoad(channelID, pin, load) // 加载完成后可能已被淘汰 重新获取
+	}
+	call := &channelLoadCall{}
+	call.wg.Add(1)
+	shard.loading[channelID] = call
+	shard.Unlock()
+
+	defer func() { // load发生panic时也要唤醒等待的协程 否则之后查询这个管道会一直阻塞
+		shard.Lock()
+		delete(shard.loading, channelID)
+		if call.err == nil && call.channel != nil {
+			entry = &channelEntry{channel: call.channel}
+			if pin {
+				entry.refs = 1
+			}
+			entry.touch()
+			shard.entries[channelID] = entry
+			atomic.AddInt64(&r.count, 1)
+			loaded = true
+		}
+		shard.Unlock()
+		call.wg.Done()
+	}()
+	call.channel, call.err = callLoad(load)
+	return nil, false, call.err // 由defer设置entry和loaded
+}
+
+// callLoad 调用load 将panic（例如自定义管道类型的构造函数）转换为错误
+func callLoad(load func() (Channel, error)) (channel Channel, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			channel, err = nil, fmt.Errorf("加载管道发生panic！-> %v", r)
+		}
+	}()
+	return load()
+}
+
+// remove 淘汰管道，只有当前记录仍为entry并且管道没有被固定、投递队列为空时才移除
+func (r *channelRegistry) remove(channelID uint64, entry *channelEntry) bool {
+	shard := r.shard(channelID)
+	shard.Lock()
+	defer shard.Unlock()
+	current, ok := shard.entries[channelID]
+	if !ok || current != entry || !entry.evictable() {
+		return false
+	}
+	delete(shard.entries, channelID)
+	atomic.AddInt64(&r.count, -1)
+	return true
+}
+
+// len 已加载的管道数量
+func (r *channelRegistry) len() int {
+	return int(atomic.LoadInt64(&r.count))
+}
+
+// oldest 抽样找出最久未使用并且没有被固定、投递队列为空的管道（近似LRU）
+func (r *channelRegistry) oldest() (uint64, *channelEntry) {
+	var oldestID uint64
+	var oldestEntry *channelEntry
+	for _, shard := range r.shards {
+		shard.RLock()
+		sampled := 0
+		for channelID, entry := range shard.entries {
+			if sampled >= channelRegistryEvictSample {
+				break
+			}
+			sampled++
+			if !entry.evictable() { // 正在使用或者还有待投递消息的管道不淘汰
+				continue
+			}
+			if pinned, ok := entry.channel.(PinnedChannel); ok && pinned.Pinned() {
+				continue
+			}
+			if oldestEntry == nil || entry.getLastActive() < oldestEntry.getLastActive() {
+				oldestID = channelID
+				oldestEntry = entry
+			}
+		}
+		shard.RUnlock()
+	}
+	return oldestID, oldestEntry
+}
+
+// idleEntries 找出在idleBefore之前最后使用并且没有被固定、投递队列为空的管道
+func (r *channelRegistry) idleEntries(idleBefore int64) map[uint64]*channelEntry {
+	idleMap := map[uint64]*channelEntry{}
+	for _, shard := range r.shards {
+		shard.RLock()
+		for channelID, entry := range shard.entries {
+			if pinned, ok := entry.channel.(PinnedChannel); ok && pinned.Pinned() {
+				continue
+			}
+			if entry.getLastActive() <= idleBefore && entry.evictable() {
+				idleMap[channelID] = entry
+			}
+		}
+		shard.RUnlock()
+	}
+	return idleMap
+}
+
+// removeAll 移除所有管道并返回
+func (r *channelRegistry) removeAll() []Channel {
+	channels := make([]Channel, 0, r.len())
+	for _, shard := range r.shards {
+		shard.Lock()
+		for channelID, entry := range shard.entries {
+			channels = append(channels, entry.channel)
+			delete(shard.entries, channelID)
+			atomic.AddInt64(&r.count, -1)
+		}
+		shard.Unlock()
+	}
+	return channels
+}
+
+// queueDepth 所有已加载管道待投递的消息数量
+func (r *channelRegistry) queueDepth() int {
+	depth := 0
+	for _, shard := range r.shards {
+		shard.RLock()
+		for _, entry := range shard.entries {
+			depth += len(entry.channel.DeliveryMsgChan())
+		}
+		shard.RUnlock()
+	}
+	return depth
+}
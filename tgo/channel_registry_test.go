@@ -0,0 +1,99 @@
+package tgo
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowStorage 查询管道比较慢的存储 用于测试并发加载
+type slowStorage struct {
+	*MemoryStorage
+	getChannelCount int64
+}
+
+func (s *slowStorage) GetChannel(channelID uint64) (*ChannelModel, error) {
+	atomic.AddInt64(&s.getChannelCount, 1)
+	time.Sleep(20 * time.Millisecond)
+	return s.MemoryStorage.GetChannel(channelID)
+}
+
+func TestTGO_GetChannelSingleFlight(t *testing.T) {
+	var storage *slowStorage
+	tg := startBuilder(newTestBuilder(NewOptions()).Storage(func(context *Context) Storage {
+		storage = &slowStorage{MemoryStorage: NewMemoryStorage(context)}
+		return storage
+	}))
+	defer tg.Stop()
+
+	var channelID uint64 = 100
+	tg.Storage.AddChannel(NewChannelModel(channelID, ChannelTypePerson))
+
+	var wg sync.WaitGroup
+	channels := make([]Channel, 50)
+	for i := 0; i < len(channels); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			channel, err := tg.GetChannel(channelID)
+			if err != nil {
+				t.Error(err)
+			}
+			channels[i] = channel
+		}(i)
+	}
+	wg.Wait()
+
+	if atomic.LoadInt64(&storage.getChannelCount) != 1 {
+		t.Fatalf("管道应该只从存储加载一次，实际加载了%d次", storage.getChannelCount)
+	}
+	for _, channel := range channels {
+		if channel == nil || channel != channels[0] {
+			t.Fatalf("并发获取的管道应该为同一个")
+		}
+	}
+}
+
+func BenchmarkTGO_GetChannelParallel(b *testing.B) {
+	opts := NewOptions()
+	opts.LogLevel = ErrorLevel
+	tg := startTGO(opts)
+	defer tg.Stop()
+
+	var channelNum uint64 = 10000
+	for i := uint64(0); i < channelNum; i++ {
+		tg.Storage.AddChannel(NewChannelModel(i, ChannelTypePerson))
+		tg.GetChannel(i)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var i uint64
+		for pb.Next() {
+			i++
+			tg.GetChannel(i % channelNum)
+		}
+	})
+}
+
+// TestChannelRegistry_loadPanic 加载发生panic时返回错误 之后的查询不会阻塞
+func TestChannelRegistry_loadPanic(t *testing.T) {
+	r := newChannelRegistry()
+	_, _, err := r.getOrLoad(1, false, func() (Channel, error) {
+		panic("new channel")
+	})
+	if err == nil {
+		t.Fatal("加载发生panic应该返回错误！")
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.getOrLoad(1, false, func() (Channel, error) { return nil, nil })
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("加载发生panic后查询管道不应该阻塞！")
+	}
+}
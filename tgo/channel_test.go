@@ -1,9 +1,228 @@
 package tgo
 
 import (
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestPersonChannel_AddConsumer(t *testing.T) {
 
 }
+
+func TestTGO_evictIdleChannel(t *testing.T) {
+	opts := NewOptions()
+	opts.ChannelScanInterval = 0
+	opts.ChannelIdleTimeout = 10 * time.Millisecond
+	tg := startTGO(opts)
+	defer tg.Stop()
+
+	var clientID uint64 = 100
+	tg.Storage.AddChannel(NewChannelModel(clientID, ChannelTypePerson))
+	tg.Storage.Bind(clientID, clientID)
+
+	channel, err := tg.GetChannel(clientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if channel == nil || tg.ChannelCount() != 1 {
+		t.Fatalf("管道数量应该为1，实际为%d", tg.ChannelCount())
+	}
+
+	// 有在线成员不淘汰
+	conn := &ServerConnTest{}
+	tg.ConnManager.AddConn(clientID, conn)
+	time.Sleep(20 * time.Millisecond)
+	tg.evictIdleChannel()
+	if tg.ChannelCount() != 1 {
+		t.Fatalf("有在线成员的管道不应该被淘汰")
+	}
+
+	tg.ConnManager.RemoveConn(clientID, conn)
+	tg.evictIdleChannel()
+	if tg.ChannelCount() != 0 {
+		t.Fatalf("空闲管道应该被淘汰，实际管道数量为%d", tg.ChannelCount())
+	}
+}
+
+func TestTGO_evictOverflowChannel(t *testing.T) {
+	opts := NewOptions()
+	opts.MaxChannelNum = 2
+	tg := startTGO(opts)
+	defer tg.Stop()
+
+	for i := uint64(1); i <= 3; i++ {
+		tg.Storage.AddChannel(NewChannelModel(i, ChannelTypePerson))
+		if _, err := tg.GetChannel(i); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if tg.ChannelCount() != 2 {
+		t.Fatalf("管道数量应该为2，实际为%d", tg.ChannelCount())
+	}
+	if _, ok := tg.channels.get(1, false); ok {
+		t.Fatalf("最久未使用的管道[1]应该被淘汰")
+	}
+}
+
+// TestTGO_evictPinnedChannel 固定的管道不会被淘汰 关闭管道时投递完队列中的消息
+func TestTGO_evictPinnedChannel(t *testing.T) {
+	opts := NewOptions()
+	opts.ChannelScanInterval = 0
+	opts.ChannelIdleTimeout = time.Millisecond
+	opts.Pro = &ProtocolTest{}
+	tg := startTGO(opts)
+	defer tg.Stop()
+
+	var clientID uint64 = 100
+	tg.Storage.AddChannel(NewChannelModel(clientID, ChannelTypePerson))
+	tg.Storage.Bind(clientID, clientID)
+	channel, release, err := tg.acquireChannel(clientID)
+	if err != nil || channel == nil {
+		t.Fatalf("获取管道失败！-> %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	tg.evictIdleChannel()
+	if tg.ChannelCount() != 1 {
+		t.Fatalf("固定的管道不应该被淘汰")
+	}
+	release()
+	tg.evictIdleChannel()
+	if tg.ChannelCount() != 0 {
+		t.Fatalf("取消固定后空闲管道应该被淘汰，实际管道数量为%d", tg.ChannelCount())
+	}
+
+	// 关闭前放入队列的消息在投递协程退出前投递
+	personChannel := NewPersonChannel(clientID, NewChannelModel(clientID, ChannelTypePerson), tg.ctx)
+	conn := &countConn{}
+	tg.ConnManager.AddConn(clientID, conn)
+	personChannel.DeliveryMsgChan() <- NewMsg(1, 2, []byte("hello"))
+	personChannel.Close()
+	personChannel.waitGroup.Wait()
+	if conn.count.Load() != 1 {
+		t.Fatalf("关闭前放入队列的消息应该被投递，实际投递%d条", conn.count.Load())
+	}
+}
+
+// countChannel 只记录放入消息数量的自定义管道
+type countChannel struct {
+	model           *ChannelModel
+	putCount        int
+	deliveryMsgChan chan *Msg
+}
+
+func (c *countChannel) Model() *ChannelModel {
+	return c.model
+}
+
+func (c *countChannel) PutMsg(msg *Msg) error {
+	c.putCount++
+	return nil
+}
+
+func (c *countChannel) DeliveryMsgChan() chan *Msg {
+	return c.deliveryMsgChan
+}
+
+func (c *countChannel) Close() error {
+	return nil
+}
+
+func TestBuilder_ChannelType(t *testing.T) {
+	var channelTypeCount = 99
+	tg := startBuilder(newTestBuilder(NewOptions()).ChannelType(channelTypeCount, func(model *ChannelModel, ctx *Context) Channel {
+		return &countChannel{model: model, deliveryMsgChan: make(chan *Msg, 1)}
+	}))
+	defer tg.Stop()
+
+	tg.Storage.AddChannel(NewChannelModel(1, channelTypeCount))
+	channel, err := tg.GetChannel(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc, ok := channel.(*countChannel)
+	if !ok {
+		t.Fatalf("管道类型应该为countChannel")
+	}
+	cc.PutMsg(NewMsg(1, 2, []byte("hello")))
+	if cc.putCount != 1 {
+		t.Fatalf("放入消息数量应该为1")
+	}
+
+	tg.Storage.AddChannel(NewChannelModel(2, 98))
+	channel, err = tg.GetChannel(2)
+	if err != nil || channel != nil {
+		t.Fatalf("未登记的管道类型应该返回nil")
+	}
+}
+
+// countConn 统计写入次数
+type countConn struct {
+	ServerConnTest
+	count atomic.Int64
+}
+
+func (c *countConn) Write(b []byte) (int, error) {
+	c.count.Add(1)
+	return len(b), nil
+}
+
+// waitCount 等待写入次数达到n
+func (c *countConn) waitCount(b *testing.B, n int64) {
+	deadline := time.Now().Add(10 * time.Second)
+	for c.count.Load() < n {
+		if time.Now().After(deadline) {
+			b.Fatalf("投递超时，只收到%d/%d条消息", c.count.Load(), n)
+		}
+		time.Sleep(10 * time.Microsecond)
+	}
+}
+
+// deliveryWindow 投递中的消息数量上限
+// 群组投递时存储管道（StorageMsgChan）依赖msgLoop读取 msgLoop又会阻塞在已满的群组投递管道上 所以堆积的消息不能超过投递管道的容量
+const deliveryWindow = 512
+
+func benchmarkDelivery(b *testing.B, channelType int, members uint64) {
+	opts := NewOptions()
+	opts.Pro = &ProtocolTest{}
+	opts.LogLevel = ErrorLevel
+	tg := startTGO(opts)
+	defer tg.Stop()
+
+	var channelID uint64 = 1000
+	tg.Storage.AddChannel(NewChannelModel(channelID, channelType))
+	conns := make([]*countConn, 0, members)
+	for clientID := uint64(1); clientID <= members; clientID++ {
+		tg.Storage.AddChannel(NewChannelModel(clientID, ChannelTypePerson))
+		tg.Storage.Bind(clientID, clientID)
+		tg.Storage.Bind(clientID, channelID)
+		conn := &countConn{}
+		tg.ConnManager.AddConn(clientID, conn)
+		conns = append(conns, conn)
+	}
+	channel, err := tg.GetChannel(channelID)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 1; i <= b.N; i++ {
+		if err = channel.PutMsg(NewMsg(uint64(i), 0, []byte("hello"))); err != nil {
+			b.Fatal(err)
+		}
+		if i%deliveryWindow == 0 || i == b.N {
+			for _, conn := range conns {
+				conn.waitCount(b, int64(i))
+			}
+		}
+	}
+}
+
+func BenchmarkPersonChannel_delivery(b *testing.B) {
+	benchmarkDelivery(b, ChannelTypePerson, 1)
+}
+
+func BenchmarkGroupChannel_delivery(b *testing.B) {
+	benchmarkDelivery(b, ChannelTypeGroup, 10)
+}
@@ -0,0 +1,157 @@
+package tgo
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TopicChannel 主题管道 消息投递给订阅了匹配主题过滤器的在线客户端
+type TopicChannel struct {
+	channelID    uint64
+	MessageCount uint64
+	Ctx          *Context
+	model        *ChannelModel
+
+	deliveryMsgChan chan *Msg
+	exitChan        chan int
+	closeOnce       sync.Once
+	waitGroup       WaitGroupWrapper
+}
+
+func NewTopicChannel(channelID uint64, model *ChannelModel, ctx *Context) *TopicChannel {
+	c := &TopicChannel{
+		channelID:       channelID,
+		deliveryMsgChan: make(chan *Msg, 1024),
+		exitChan:        make(chan int, 0),
+		Ctx:             ctx,
+		model:           model,
+	}
+	c.loadRetainMsg()
+	c.waitGroup.Wrap(func() {
+		c.startDeliveryMsg()
+	})
+	return c
+}
+
+// loadRetainMsg 已存储保留消息的主题加入主题索引（订阅时按主题过滤器匹配保留消息）
+func (c *TopicChannel) loadRetainMsg() {
+	msg, err := c.Ctx.TGO.GetRetainMsg(c.channelID)
+	if err != nil {
+		c.Warn("加载保留消息失败！-> %v", err)
+		return
+	}
+	if msg != nil {
+		c.Ctx.TGO.topics.setRetained(c.model.Topic, c.channelID, true)
+	}
+}
+
+// PutMsg 存储并投递消息 保留消息会替换主题当前的保留消息，内容为空的保留消息只清除保留消息
+func (c *TopicChannel) PutMsg(msg *Msg) error {
+	if err := ValidateTopic(c.model.Topic); err != nil {
+		return err
+	}
+	cleared, err := c.Ctx.TGO.putRetainMsg(c.channelID, msg)
+	if err != nil {
+		return err
+	}
+	if msg.Retain { // 保留消息保存在putRetainMsg中 这里只记录主题的索引
+		c.Ctx.TGO.topics.setRetained(c.model.Topic, c.channelID, !cleared)
+	}
+	if cleared {
+		return nil
+	}
+	span := c.Ctx.TGO.startMsgSpan(SpanStorageAddMsg, msg, c.channelID)
+	start := time.Now()
+	err = c.Ctx.TGO.Storage.AddMsgInChannel(msg, c.channelID)
+	c.Ctx.TGO.monitorStorage("add_msg", start)
+	c.Ctx.TGO.finishSpan(span, err)
+	if err != nil {
+		return err
+	}
+	atomic.AddUint64(&c.MessageCount, 1)
+	return nil
+}
+
+func (c *TopicChannel) DeliveryMsgChan() chan *Msg {
+	return c.deliveryMsgChan
+}
+
+func (c *TopicChannel) Model() *ChannelModel {
+	return c.model
+}
+
+// GetMessageCount 放入管道的消息数量
+func (c *TopicChannel) GetMessageCount() uint64 {
+	return atomic.LoadUint64(&c.MessageCount)
+}
+
+// Close 关闭管道 通知投递协程投递完队列中的消息后退出，不等待投递完成
+func (c *TopicChannel) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.exitChan)
+	})
+	return nil
+}
+
+func (c *TopicChannel) startDeliveryMsg() {
+	for {
+		select {
+		case msg := <-c.deliveryMsgChan:
+			span := c.Ctx.TGO.startSpan(SpanChannelDelivery, msg, c.channelID)
+			c.deliveryMsg(msg)
+			c.Ctx.TGO.finishSpan(span, nil)
+		case <-c.exitChan:
+			goto exit
+		}
+	}
+exit:
+	for len(c.deliveryMsgChan) > 0 { // 投递关闭前已经放入队列的消息
+		c.deliveryMsg(<-c.deliveryMsgChan)
+	}
+	c.Debug("停止投递消息。")
+}
+
+func (c *TopicChannel) deliveryMsg(msg *Msg) {
+	c.Debug("开始投递消息[%d]！", msg.MessageID)
+	for _, clientID := range c.Ctx.TGO.topics.trie.Match(c.model.Topic) {
+		if clientID == msg.From {
+			continue
+		}
+		conn := c.Ctx.TGO.ConnManager.GetConn(clientID)
+		if conn == nil {
+			continue
+		}
+		err := c.Ctx.TGO.WriteMsg(conn, c.channelID, msg)
+		if err != nil {
+			c.Error("写入消息[%d]到客户端[%d]失败！-> %v", msg.MessageID, clientID, err)
+		}
+	}
+}
+
+func (c *TopicChannel) String() string {
+	return fmt.Sprintf("ChannelID: %d Topic: %s MessageCount: %d", c.channelID, c.model.Topic, c.MessageCount)
+}
+
+// ---------- log --------------
+
+func (c *TopicChannel) Info(f string, args ...interface{}) {
+	logf(c.Ctx.TGO.GetOpts().Log, InfoLevel, []Field{FieldChannelID(c.channelID)}, c.getLogPrefix()+" -> "+f, args...)
+}
+
+func (c *TopicChannel) Error(f string, args ...interface{}) {
+	logf(c.Ctx.TGO.GetOpts().Log, ErrorLevel, []Field{FieldChannelID(c.channelID)}, c.getLogPrefix()+" -> "+f, args...)
+}
+
+func (c *TopicChannel) Debug(f string, args ...interface{}) {
+	logf(c.Ctx.TGO.GetOpts().Log, DebugLevel, []Field{FieldChannelID(c.channelID)}, c.getLogPrefix()+" -> "+f, args...)
+}
+
+func (c *TopicChannel) Warn(f string, args ...interface{}) {
+	logf(c.Ctx.TGO.GetOpts().Log, WarnLevel, []Field{FieldChannelID(c.channelID)}, c.getLogPrefix()+" -> "+f, args...)
+}
+
+func (c *TopicChannel) getLogPrefix() string {
+	return "【Chanel-Topic】"
+}
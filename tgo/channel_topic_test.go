@@ -0,0 +1,102 @@
+package tgo
+
+import (
+	"testing"
+)
+
+func TestTopicChannel_deliveryMsg(t *testing.T) {
+	opts := NewOptions()
+	opts.Pro = &ProtocolTest{}
+	tg := startTGO(opts)
+	defer tg.Stop()
+
+	var topicChannelID uint64 = 700
+	topicModel := NewChannelModel(topicChannelID, ChannelTypeTopic)
+	topicModel.Topic = "building/3/1/temperature"
+	tg.Storage.AddChannel(topicModel)
+
+	subscriberConn := &ServerConnTest{}
+	tg.ConnManager.AddConn(1, subscriberConn)
+	if err := tg.SubscribeTopic(1, "building/3/+/temperature"); err != nil {
+		t.Fatal(err)
+	}
+	otherConn := &ServerConnTest{}
+	tg.ConnManager.AddConn(2, otherConn)
+	tg.SubscribeTopic(2, "building/4/#")
+
+	channel, err := tg.GetChannel(topicChannelID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := NewMsg(1, 9, []byte("26.5"))
+	msg.Retain = true
+	if err = channel.PutMsg(msg); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return len(subscriberConn.Writes()) == 1 })
+	if len(otherConn.Writes()) != 0 {
+		t.Fatalf("没有订阅匹配主题的客户端不应该收到消息")
+	}
+
+	// 后订阅的客户端立即收到保留消息
+	lateConn := &ServerConnTest{}
+	tg.ConnManager.AddConn(3, lateConn)
+	tg.SubscribeTopic(3, "building/#")
+	if len(lateConn.Writes()) != 1 {
+		t.Fatalf("订阅后应该收到1条保留消息，实际为%d条", len(lateConn.Writes()))
+	}
+
+	// 内容为空的保留消息清除保留消息
+	clearMsg := NewMsg(2, 9, nil)
+	clearMsg.Retain = true
+	channel.PutMsg(clearMsg)
+	clearConn := &ServerConnTest{}
+	tg.ConnManager.AddConn(4, clearConn)
+	tg.SubscribeTopic(4, "building/#")
+	if len(clearConn.Writes()) != 0 {
+		t.Fatalf("保留消息清除后订阅不应该收到消息")
+	}
+}
+
+// retainMemoryStorage 保存保留消息的内存存储（模拟重启后存储中已有保留消息）
+type retainMemoryStorage struct {
+	*MemoryStorage
+	retainMsgMap map[uint64]*Msg
+}
+
+func (s *retainMemoryStorage) SetRetainMsg(channelID uint64, msg *Msg) error {
+	s.Lock()
+	defer s.Unlock()
+	s.retainMsgMap[channelID] = msg
+	return nil
+}
+
+func (s *retainMemoryStorage) GetRetainMsg(channelID uint64) (*Msg, error) {
+	s.RLock()
+	defer s.RUnlock()
+	return s.retainMsgMap[channelID], nil
+}
+
+// TestTopicChannel_retainedAfterRestart 启动时从存储重建主题索引 主题管道没有加载也能推送保留消息
+func TestTopicChannel_retainedAfterRestart(t *testing.T) {
+	opts := NewOptions()
+	opts.Pro = &ProtocolTest{}
+	tg := startBuilder(newTestBuilder(opts).Storage(func(context *Context) Storage {
+		s := &retainMemoryStorage{MemoryStorage: NewMemoryStorage(context), retainMsgMap: map[uint64]*Msg{}}
+		topicModel := NewChannelModel(700, ChannelTypeTopic)
+		topicModel.Topic = "building/3/1/temperature"
+		s.AddChannel(topicModel)
+		s.SetRetainMsg(700, NewMsg(1, 9, []byte("26.5")))
+		return s
+	}))
+	defer tg.Stop()
+
+	conn := &ServerConnTest{}
+	tg.ConnManager.AddConn(1, conn)
+	if err := tg.SubscribeTopic(1, "building/#"); err != nil {
+		t.Fatal(err)
+	}
+	if len(conn.Writes()) != 1 {
+		t.Fatalf("订阅后应该收到1条保留消息，实际为%d条", len(conn.Writes()))
+	}
+}
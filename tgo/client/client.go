@@ -0,0 +1,548 @@
+// Package client tgo的Go客户端 使用内置的mqtt-im协议
+//
+// 连接断开后自动重连（退避），重连后服务端会推送离线消息，没有收到Msgack的消息会重新发送。
+//
+//	c := client.New(&client.Options{Addr: "127.0.0.1:6666", ClientID: 1, Password: "123456"})
+//	if err := c.Connect(); err != nil { ... }
+//	defer c.Close()
+//	messageID, err := c.Send(ctx, 2, []byte("hello"))
+//	for msg := range c.Messages() { ... }
+package client
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tgo-team/tgo-core/tgo/packets"
+	"github.com/tgo-team/tgo-core/tgo/protocol"
+)
+
+var (
+	ErrClosed  = errors.New("客户端已关闭！")
+	ErrTimeout = errors.New("等待回复超时！")
+)
+
+// ConnackError 服务端拒绝连接
+type ConnackError struct {
+	Code packets.ConnReturnCode
+}
+
+func (e *ConnackError) Error() string {
+	return fmt.Sprintf("服务端拒绝连接！-> %d", e.Code)
+}
+
+// Options 客户端配置 没有设置的使用默认值
+type Options struct {
+	Addr         string        // 服务端地址 例如: 127.0.0.1:6666
+	ClientID     uint64        // 客户端ID
+	Password     string        // 密码
+	Keepalive    time.Duration // 心跳间隔 超过2倍心跳间隔没有收到数据认为连接断开 默认30s
+	Timeout      time.Duration // 连接、等待Msgack和Cmdack的超时时间（ctx没有deadline时使用） 默认10s
+	ReconnectMin time.Duration // 重连的最小等待时间 默认500ms
+	ReconnectMax time.Duration // 重连的最大等待时间 默认30s
+	ManualAck    bool          // 是否手动确认收到的消息（调用Ack） 默认收到后自动确认
+	// Dial 建立连接 默认为TCP连接
+	Dial func(addr string) (net.Conn, error)
+	// OnMessage 收到消息的回调 设置后消息不再放入Messages()
+	OnMessage func(msg *Message)
+	// OnCmd 处理服务端发起的命令 返回回复的状态和内容 没有设置回复CmdackStatusNotFound
+	OnCmd func(cmd *packets.CmdPacket) (uint16, []byte)
+	// OnConnectionLost 连接断开的回调 之后会自动重连
+	OnConnectionLost func(err error)
+	// OnReconnect 重连成功的回调
+	OnReconnect func()
+}
+
+func (o *Options) withDefaults() *Options {
+	opts := *o
+	if opts.Keepalive <= 0 {
+		opts.Keepalive = 30 * time.Second
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.ReconnectMin <= 0 {
+		opts.ReconnectMin = 500 * time.Millisecond
+	}
+	if opts.ReconnectMax < opts.ReconnectMin {
+		opts.ReconnectMax = 30 * time.Second
+		if opts.ReconnectMax < opts.ReconnectMin {
+			opts.ReconnectMax = opts.ReconnectMin
+		}
+	}
+	if opts.Dial == nil {
+		opts.Dial = func(addr string) (net.Conn, error) {
+			return net.DialTimeout("tcp", addr, opts.Timeout)
+		}
+	}
+	return &opts
+}
+
+// Message 收到的消息
+type Message struct {
+	ChannelID uint64
+	MessageID uint64
+	From      uint64
+	Timestamp int64 // 毫秒
+	Payload   []byte
+	Retain    bool
+}
+
+// pendingMsg 等待Msgack的消息 重连后重新发送
+type pendingMsg struct {
+	packet *packets.MessagePacket
+	done   chan struct{}
+}
+
+type Client struct {
+	opts        *Options
+	conn        net.Conn
+	connected   chan struct{} // 连接成功时关闭 断开后重新创建
+	writeLock   sync.Mutex
+	pendingMsgs map[uint64]*pendingMsg
+	pendingCmds map[uint64]chan *packets.CmdackPacket
+	received    *recentIDs // 最近收到的消息 重连后重复推送的消息只确认不再投递
+	messages    chan *Message
+	sequence    uint64 // 命令的请求编号
+	closeOnce   sync.Once
+	exitChan    chan struct{}
+	waitGroup   sync.WaitGroup
+	err         error // 客户端关闭的原因
+	sync.Mutex
+}
+
+func New(opts *Options) *Client {
+	return &Client{
+		opts:        opts.withDefaults(),
+		connected:   make(chan struct{}),
+		pendingMsgs: map[uint64]*pendingMsg{},
+		pendingCmds: map[uint64]chan *packets.CmdackPacket{},
+		received:    newRecentIDs(1024),
+		messages:    make(chan *Message, 1024),
+		exitChan:    make(chan struct{}),
+	}
+}
+
+// Connect 连接并认证 成功后在后台读取、发送心跳和自动重连 只能调用一次
+func (c *Client) Connect() error {
+	select {
+	case <-c.exitChan:
+		return c.closeErr()
+	default:
+	}
+	conn, reader, err := c.dial()
+	if err != nil {
+		return err
+	}
+	c.setConn(conn)
+	c.waitGroup.Add(1)
+	go c.run(conn, reader)
+	return nil
+}
+
+// dial 建立连接并完成认证
+func (c *Client) dial() (net.Conn, *bufio.Reader, error) {
+	conn, err := c.opts.Dial(c.opts.Addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	connectPacket := packets.NewConnectPacket(c.opts.ClientID, c.opts.Password)
+	connectPacket.Keepalive = uint16(c.opts.Keepalive / time.Second)
+	data, err := protocol.Encode(connectPacket)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	conn.SetDeadline(time.Now().Add(c.opts.Timeout))
+	if _, err = conn.Write(data); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	reader := bufio.NewReader(conn)
+	packet, err := protocol.Decode(reader)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	connackPacket, ok := packet.(*packets.ConnackPacket)
+	if !ok {
+		conn.Close()
+		return nil, nil, fmt.Errorf("连接后的第一个包应该为Connack，实际为%v", packet)
+	}
+	if connackPacket.ReturnCode != packets.ConnReturnCodeSuccess {
+		conn.Close()
+		return nil, nil, &ConnackError{Code: connackPacket.ReturnCode}
+	}
+	return conn, reader, nil
+}
+
+// setConn 设置当前连接并重新发送没有确认的消息
+func (c *Client) setConn(conn net.Conn) {
+	c.Lock()
+	c.conn = conn
+	close(c.connected)
+	resend := make([]*packets.MessagePacket, 0, len(c.pendingMsgs))
+	for _, pending := range c.pendingMsgs {
+		resend = append(resend, pending.packet)
+	}
+	c.Unlock()
+	for _, packet := range resend {
+		c.writePacket(conn, packet)
+	}
+}
+
+// run 读取连接 断开后重连直到客户端关闭
+func (c *Client) run(conn net.Conn, reader *bufio.Reader) {
+	defer c.waitGroup.Done()
+	for {
+		err := c.serve(conn, reader)
+		c.Lock()
+		c.conn = nil
+		c.connected = make(chan struct{})
+		c.Unlock()
+		conn.Close()
+		select {
+		case <-c.exitChan:
+			return
+		default:
+		}
+		if c.opts.OnConnectionLost != nil {
+			c.opts.OnConnectionLost(err)
+		}
+		conn, reader, err = c.reconnect()
+		if err != nil {
+			c.close(err)
+			return
+		}
+		c.setConn(conn)
+		if c.opts.OnReconnect != nil {
+			c.opts.OnReconnect()
+		}
+	}
+}
+
+// reconnect 按退避时间重连 客户端关闭或服务端拒绝连接时返回错误
+func (c *Client) reconnect() (net.Conn, *bufio.Reader, error) {
+	backoff := c.opts.ReconnectMin
+	for {
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		select {
+		case <-time.After(wait):
+		case <-c.exitChan:
+			return nil, nil, ErrClosed
+		}
+		conn, reader, err := c.dial()
+		if err == nil {
+			return conn, reader, nil
+		}
+		var connackErr *ConnackError
+		if errors.As(err, &connackErr) && connackErr.Code == packets.ConnReturnCodePasswordOrUnameError {
+			return nil, nil, err
+		}
+		if backoff *= 2; backoff > c.opts.ReconnectMax {
+			backoff = c.opts.ReconnectMax
+		}
+	}
+}
+
+// serve 读取连接上的包并定时发送心跳 连接断开或客户端关闭时返回
+func (c *Client) serve(conn net.Conn, reader *bufio.Reader) error {
+	stopPing := make(chan struct{})
+	defer close(stopPing)
+	go c.pingLoop(conn, stopPing)
+	for {
+		conn.SetReadDeadline(time.Now().Add(2 * c.opts.Keepalive))
+		packet, err := protocol.Decode(reader)
+		if err != nil {
+			return err
+		}
+		c.handlePacket(conn, packet)
+	}
+}
+
+func (c *Client) pingLoop(conn net.Conn, stop chan struct{}) {
+	ticker := time.NewTicker(c.opts.Keepalive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.writePacket(conn, packets.NewPingreqPacket()); err != nil {
+				conn.Close()
+				return
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (c *Client) handlePacket(conn net.Conn, packet packets.Packet) {
+	switch p := packet.(type) {
+	case *packets.MessagePacket:
+		duplicate := !c.received.add(p.MessageID)
+		if !c.opts.ManualAck || duplicate {
+			c.writePacket(conn, packets.NewMsgackPacket([]uint64{p.MessageID}))
+		}
+		if duplicate {
+			return
+		}
+		msg := &Message{
+			ChannelID: p.ChannelID,
+			MessageID: p.MessageID,
+			From:      p.From,
+			Timestamp: p.Timestamp,
+			Payload:   p.Payload,
+			Retain:    p.Retain,
+		}
+		if c.opts.OnMessage != nil {
+			c.opts.OnMessage(msg)
+			return
+		}
+		select {
+		case c.messages <- msg:
+		case <-c.exitChan:
+		}
+	case *packets.MsgackPacket:
+		c.Lock()
+		for _, messageID := range p.MessageIDs {
+			if pending, ok := c.pendingMsgs[messageID]; ok {
+				delete(c.pendingMsgs, messageID)
+				close(pending.done)
+			}
+		}
+		c.Unlock()
+	case *packets.CmdackPacket:
+		c.Lock()
+		replyChan, ok := c.pendingCmds[p.RequestID]
+		delete(c.pendingCmds, p.RequestID)
+		c.Unlock()
+		if ok {
+			replyChan <- p
+		}
+	case *packets.CmdPacket:
+		status, payload := packets.CmdackStatusNotFound, []byte(nil)
+		if c.opts.OnCmd != nil {
+			status, payload = c.opts.OnCmd(p)
+		}
+		cmdackPacket := packets.NewCmdackPacket(p.CMD, status, payload)
+		cmdackPacket.RequestID = p.RequestID
+		c.writePacket(conn, cmdackPacket)
+	}
+}
+
+func (c *Client) writePacket(conn net.Conn, packet packets.Packet) error {
+	data, err := protocol.Encode(packet)
+	if err != nil {
+		return err
+	}
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	conn.SetWriteDeadline(time.Now().Add(c.opts.Timeout))
+	_, err = conn.Write(data)
+	return err
+}
+
+// currentConn 等待连接可用 重连中会等到重连成功、ctx结束或客户端关闭
+func (c *Client) currentConn(ctx context.Context) (net.Conn, error) {
+	for {
+		c.Lock()
+		conn, connected := c.conn, c.connected
+		c.Unlock()
+		if conn != nil {
+			return conn, nil
+		}
+		select {
+		case <-connected:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-c.exitChan:
+			return nil, c.closeErr()
+		}
+	}
+}
+
+func (c *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.opts.Timeout)
+}
+
+// Send 发送消息到管道并等待服务端的Msgack 返回消息ID
+// 等待期间连接断开，消息会在重连后重新发送
+func (c *Client) Send(ctx context.Context, channelID uint64, payload []byte) (uint64, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	messageID := newMessageID()
+	packet := packets.NewMessagePacket(messageID, channelID, payload)
+	packet.From = c.opts.ClientID
+	pending := &pendingMsg{packet: packet, done: make(chan struct{})}
+	c.Lock()
+	c.pendingMsgs[messageID] = pending
+	c.Unlock()
+	defer func() {
+		c.Lock()
+		delete(c.pendingMsgs, messageID)
+		c.Unlock()
+	}()
+
+	conn, err := c.currentConn(ctx)
+	if err != nil {
+		return 0, c.ctxErr(err)
+	}
+	c.writePacket(conn, packet) // 写入失败时等待重连后重新发送
+	select {
+	case <-pending.done:
+		return messageID, nil
+	case <-ctx.Done():
+		return 0, c.ctxErr(ctx.Err())
+	case <-c.exitChan:
+		return 0, c.closeErr()
+	}
+}
+
+// Ack 确认收到的消息（ManualAck时使用） 确认后服务端从离线消息中移除
+func (c *Client) Ack(messageIDs ...uint64) error {
+	c.Lock()
+	conn := c.conn
+	c.Unlock()
+	if conn == nil {
+		return errors.New("连接已断开！")
+	}
+	return c.writePacket(conn, packets.NewMsgackPacket(messageIDs))
+}
+
+// Cmd 发送命令并等待回复
+func (c *Client) Cmd(ctx context.Context, cmd string, payload []byte) (*packets.CmdackPacket, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	conn, err := c.currentConn(ctx)
+	if err != nil {
+		return nil, c.ctxErr(err)
+	}
+	requestID := atomic.AddUint64(&c.sequence, 1)
+	replyChan := make(chan *packets.CmdackPacket, 1)
+	c.Lock()
+	c.pendingCmds[requestID] = replyChan
+	c.Unlock()
+	defer func() {
+		c.Lock()
+		delete(c.pendingCmds, requestID)
+		c.Unlock()
+	}()
+	cmdPacket := packets.NewCmdPacket(cmd, payload)
+	cmdPacket.RequestID = requestID
+	if err = c.writePacket(conn, cmdPacket); err != nil {
+		return nil, err
+	}
+	select {
+	case cmdackPacket := <-replyChan:
+		return cmdackPacket, nil
+	case <-ctx.Done():
+		return nil, c.ctxErr(ctx.Err())
+	case <-c.exitChan:
+		return nil, c.closeErr()
+	}
+}
+
+// Messages 收到的消息（没有设置OnMessage时使用） 客户端关闭后不再有新消息
+func (c *Client) Messages() <-chan *Message {
+	return c.messages
+}
+
+// Connected 当前是否已连接
+func (c *Client) Connected() bool {
+	c.Lock()
+	defer c.Unlock()
+	return c.conn != nil
+}
+
+// Done 客户端关闭时Done Err返回关闭的原因
+func (c *Client) Done() <-chan struct{} {
+	return c.exitChan
+}
+
+// Err 客户端关闭的原因 Close关闭的为ErrClosed，重连被拒绝的为*ConnackError
+func (c *Client) Err() error {
+	select {
+	case <-c.exitChan:
+		return c.closeErr()
+	default:
+		return nil
+	}
+}
+
+func (c *Client) Close() error {
+	c.close(ErrClosed)
+	c.waitGroup.Wait()
+	return nil
+}
+
+func (c *Client) close(err error) {
+	c.closeOnce.Do(func() {
+		c.Lock()
+		c.err = err
+		conn := c.conn
+		c.Unlock()
+		close(c.exitChan)
+		if conn != nil {
+			conn.Close()
+		}
+	})
+}
+
+func (c *Client) closeErr() error {
+	c.Lock()
+	defer c.Unlock()
+	return c.err
+}
+
+func (c *Client) ctxErr(err error) error {
+	if err == context.DeadlineExceeded {
+		return ErrTimeout
+	}
+	return err
+}
+
+// newMessageID 随机的消息ID 多个客户端生成的ID几乎不会重复
+func newMessageID() uint64 {
+	for {
+		if id := rand.Uint64(); id != 0 {
+			return id
+		}
+	}
+}
+
+// recentIDs 最近的消息ID（固定数量 先进先出）
+type recentIDs struct {
+	ids   map[uint64]struct{}
+	order []uint64
+	next  int
+	sync.Mutex
+}
+
+func newRecentIDs(size int) *recentIDs {
+	return &recentIDs{ids: make(map[uint64]struct{}, size), order: make([]uint64, size)}
+}
+
+// add 添加消息ID 已存在返回false
+func (r *recentIDs) add(id uint64) bool {
+	r.Lock()
+	defer r.Unlock()
+	if _, ok := r.ids[id]; ok {
+		return false
+	}
+	delete(r.ids, r.order[r.next])
+	r.order[r.next] = id
+	r.next = (r.next + 1) % len(r.order)
+	r.ids[id] = struct{}{}
+	return true
+}
@@ -0,0 +1,159 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tgo-team/tgo-core/tgo"
+	"github.com/tgo-team/tgo-core/tgo/packets"
+	"github.com/tgo-team/tgo-core/tgo/protocol"
+	"github.com/tgo-team/tgo-core/tgo/server/tcp"
+	"github.com/tgo-team/tgo-core/tgo/storage"
+)
+
+func startTestTGO(t *testing.T) (*tgo.TGO, string) {
+	opts := tgo.NewOptions()
+	opts.DataPath = t.TempDir()
+	opts.TCPAddress = "127.0.0.1:0"
+	opts.HTTPAddress = ""
+	opts.LogLevel = tgo.ErrorLevel
+	opts.AdminToken = "token"
+	opts.Pro = protocol.New()
+	tg, err := tgo.NewBuilder(opts).Server(tcp.New).Storage(storage.New).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tg.MatchDefaultHandlers()
+	tg.Match("cmd:echo", func(m *tgo.MContext) {
+		m.Reply(packets.CmdackStatusSuccess, m.CmdPacket().Payload)
+	})
+	if err = tg.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tg.Stop() })
+	tg.Storage.AddClient(tgo.NewClient(1, "111"))
+	tg.Storage.AddClient(tgo.NewClient(2, "222"))
+	return tg, tg.Servers[0].(*tcp.Server).Addr().String()
+}
+
+func connectClient(t *testing.T, opts *Options) *Client {
+	c := New(opts)
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func receive(t *testing.T, c *Client) *Message {
+	select {
+	case msg := <-c.Messages():
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待消息超时！")
+	}
+	return nil
+}
+
+func TestClient_SendAndCmd(t *testing.T) {
+	_, addr := startTestTGO(t)
+	c1 := connectClient(t, &Options{Addr: addr, ClientID: 1, Password: "111"})
+	c2 := connectClient(t, &Options{Addr: addr, ClientID: 2, Password: "222"})
+
+	messageID, err := c1.Send(context.Background(), 2, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := receive(t, c2)
+	if msg.MessageID != messageID || msg.From != 1 || msg.ChannelID != 2 || string(msg.Payload) != "hello" {
+		t.Fatalf("收到的消息不正确！-> %+v", msg)
+	}
+
+	cmdack, err := c1.Cmd(context.Background(), "echo", []byte("ping"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmdack.Status != packets.CmdackStatusSuccess || string(cmdack.Payload) != "ping" {
+		t.Fatalf("命令回复不正确！-> %v", cmdack)
+	}
+	cmdack, err = c1.Cmd(context.Background(), "unknown", nil)
+	if err != nil || cmdack.Status != packets.CmdackStatusNotFound {
+		t.Fatalf("不存在的命令应该回复%d！-> %v %v", packets.CmdackStatusNotFound, cmdack, err)
+	}
+}
+
+func TestClient_AuthFailed(t *testing.T) {
+	_, addr := startTestTGO(t)
+	err := New(&Options{Addr: addr, ClientID: 1, Password: "wrong"}).Connect()
+	var connackErr *ConnackError
+	if !errors.As(err, &connackErr) || connackErr.Code != packets.ConnReturnCodePasswordOrUnameError {
+		t.Fatalf("密码错误应该返回ConnackError！-> %v", err)
+	}
+}
+
+// TestClient_Reconnect 连接被断开后自动重连 断开期间的消息重连后作为离线消息收到
+func TestClient_Reconnect(t *testing.T) {
+	tg, addr := startTestTGO(t)
+	lost := make(chan error, 1)
+	reconnected := make(chan struct{}, 1)
+	c1 := connectClient(t, &Options{Addr: addr, ClientID: 1, Password: "111"})
+	c2 := connectClient(t, &Options{
+		Addr:             addr,
+		ClientID:         2,
+		Password:         "222",
+		ReconnectMin:     200 * time.Millisecond,
+		OnConnectionLost: func(err error) { lost <- err },
+		OnReconnect:      func() { reconnected <- struct{}{} },
+	})
+
+	req := httptest.NewRequest("DELETE", "/admin/conns/2", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	w := httptest.NewRecorder()
+	tg.HTTPMux().ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("断开客户端失败！-> %d %s", w.Code, w.Body.String())
+	}
+	select {
+	case <-lost:
+	case <-time.After(5 * time.Second):
+		t.Fatal("应该检测到连接断开！")
+	}
+	messageID, err := c1.Send(context.Background(), 2, []byte("offline"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("应该自动重连！")
+	}
+	msg := receive(t, c2)
+	if msg.MessageID != messageID || string(msg.Payload) != "offline" {
+		t.Fatalf("重连后应该收到离线消息！-> %+v", msg)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		msgList, _ := tg.Storage.GetMsgInChannel(2, 1, 10)
+		if len(msgList) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("自动确认后离线消息应该被移除！")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRecentIDs(t *testing.T) {
+	r := newRecentIDs(2)
+	if !r.add(1) || r.add(1) || !r.add(2) || !r.add(3) {
+		t.Fatal("添加结果不正确！")
+	}
+	if !r.add(1) { // 1已经被淘汰
+		t.Fatal("淘汰后的ID应该可以重新添加！")
+	}
+}
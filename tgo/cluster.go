@@ -0,0 +1,90 @@
+package tgo
+
+import "time"
+
+// Cluster 集群 ConnManager只知道本节点的连接，客户端连接在其他节点时个人管道通过Cluster把消息转发到客户端所在的节点
+// 其他节点的客户端上线时Cluster调用TGO.ForwardOfflineMsg转发本节点保存的离线消息
+// 通过Builder.Cluster指定 没有指定时为单机
+type Cluster interface {
+	Start() error
+	Stop() error
+	ClientOnline(clientID uint64)  // 本节点的客户端上线
+	ClientOffline(clientID uint64) // 本节点的客户端下线
+	// Forward 把管道[channelID]的消息转发给连接在其他节点的客户端[clientID] 客户端不在其他节点时返回false
+	// 返回true表示对方节点已经接收（保存并投递）了消息
+	Forward(clientID uint64, channelID uint64, msg *Msg) (bool, error)
+}
+
+// Cluster 集群 单机时为nil
+func (t *TGO) Cluster() Cluster {
+	return t.cluster
+}
+
+// forwardMsg 客户端不在本节点时通过集群转发消息 转发成功后消息由对方节点保存和投递，从本节点的管道中移除
+func (t *TGO) forwardMsg(clientID uint64, channelID uint64, msg *Msg) bool {
+	if t.cluster == nil {
+		return false
+	}
+	forwarded, err := t.cluster.Forward(clientID, channelID, msg)
+	if err != nil {
+		t.Warn("转发消息[%d]给客户端[%d]失败！-> %v", msg.MessageID, clientID, err)
+		return false
+	}
+	if !forwarded {
+		return false
+	}
+	if err = t.Storage.RemoveMsgInChannel([]uint64{msg.MessageID}, channelID); err != nil {
+		t.Warn("移除已转发的消息[%d]失败！-> %v", msg.MessageID, err)
+	}
+	return true
+}
+
+// ForwardOfflineMsg 客户端连接到其他节点后 把本节点保存的客户端个人管道的离线消息按顺序转发到该节点
+// 转发失败（客户端又下线、节点不可用）时停止，剩下的消息留在本节点，客户端下次上线时再转发
+func (t *TGO) ForwardOfflineMsg(clientID uint64) {
+	if t.cluster == nil {
+		return
+	}
+	var pageSize int64 = 100
+	startMill := time.Now().UnixNano() / (1000 * 1000)
+	msgList := make([]*Msg, 0)
+	for pageIndex := int64(1); ; pageIndex++ { // 先读取全部离线消息 转发成功的消息会从管道中移除
+		page, err := t.Storage.GetMsgInChannel(clientID, pageIndex, pageSize)
+		if err != nil {
+			t.Error("获取管道[%d]的消息失败！-> %v", clientID, err)
+			return
+		}
+		for _, msg := range page {
+			if msg.Timestamp <= startMill { // 之后的消息由管道投递时转发
+				msgList = append(msgList, msg)
+			}
+		}
+		if int64(len(page)) < pageSize {
+			break
+		}
+	}
+	for _, msg := range msgList {
+		if !t.forwardMsg(clientID, clientID, msg) {
+			return
+		}
+	}
+	if len(msgList) > 0 {
+		t.Debug("客户端[%d]的%d条离线消息已转发！", clientID, len(msgList))
+	}
+}
+
+// AcceptForwardMsg 接收其他节点转发的消息 放入管道[channelID]保存并投递
+// 客户端不在本节点时返回ErrClientOffline（消息留在转发的节点）
+func (t *TGO) AcceptForwardMsg(clientID uint64, channelID uint64, msg *Msg) error {
+	if t.ConnManager.GetConn(clientID) == nil {
+		return ErrClientOffline
+	}
+	channel, err := t.GetChannel(channelID)
+	if err != nil {
+		return err
+	}
+	if channel == nil {
+		return ErrChannelNotExist
+	}
+	return channel.PutMsg(msg)
+}
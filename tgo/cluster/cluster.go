@@ -0,0 +1,485 @@
+// Package cluster 集群 节点之间通过ClusterAddress上的内部连接同步在线状态并转发消息
+//
+// 节点之间握手时校验共享的ClusterToken，没有通过握手的连接不处理任何帧。
+// 每个节点以ClusterAdvertiseAddress（默认为实际监听的地址）作为节点ID，启动时连接ClusterSeeds中的节点，
+// 连接过来的节点也会被加入集群；ClusterGossipInterval大于0时定时与其他节点交换成员列表，只需要配置部分节点作为种子。
+// 每个节点把本节点客户端的上线、下线通知其他节点，组成客户端ID到节点的在线表。
+// 个人管道投递时客户端连接在其他节点，消息转发到该节点保存并投递，对方接收后从本节点的管道中移除。
+//
+// 每个节点的存储是独立的：客户端离线期间的消息保存在发送时所在的节点，得知客户端在其他节点上线（握手或者上线通知）后，
+// 按顺序转发到客户端所在的节点
+package cluster
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tgo-team/tgo-core/tgo"
+)
+
+// Cluster 实现tgo.Cluster
+type Cluster struct {
+	ctx         *tgo.Context
+	listener    net.Listener
+	self        string                         // 本节点ID
+	peers       map[string]*peer               // 其他节点
+	presence    map[uint64]string              // 客户端ID -> 节点（不包括本节点的客户端）
+	nodeClients map[string]map[uint64]struct{} // 节点 -> 客户端ID
+	inbound     map[string]*frameConn          // 节点 -> 对方连接过来的连接（在线状态来自这个连接）
+	conns       map[*frameConn]struct{}        // 连接过来的连接 停止时关闭
+	events      chan *frame                    // 本节点客户端的上线、下线
+	forwarding  map[uint64]struct{}            // 正在转发离线消息的客户端
+	started     bool
+	exitChan    chan struct{}
+	waitGroup   sync.WaitGroup
+	sync.RWMutex
+}
+
+// New 创建集群 ClusterAddress为空时不启动 例如: builder.Cluster(cluster.New)
+func New(ctx *tgo.Context) tgo.Cluster {
+	return &Cluster{
+		ctx:         ctx,
+		peers:       map[string]*peer{},
+		presence:    map[uint64]string{},
+		nodeClients: map[string]map[uint64]struct{}{},
+		inbound:     map[string]*frameConn{},
+		conns:       map[*frameConn]struct{}{},
+		events:      make(chan *frame, 1024),
+		forwarding:  map[uint64]struct{}{},
+		exitChan:    make(chan struct{}),
+	}
+}
+
+func (c *Cluster) Start() error {
+	opts := c.ctx.TGO.GetOpts()
+	if opts.ClusterAddress == "" {
+		return nil
+	}
+	if opts.ClusterToken == "" {
+		return &tgo.OptionError{Field: "cluster_token", Err: errors.New("开启集群时不能为空")}
+	}
+	if opts.ClusterTimeout <= 0 {
+		return &tgo.OptionError{Field: "cluster_timeout", Err: errors.New("开启集群时必须大于0")}
+	}
+	listener, err := net.Listen("tcp", opts.ClusterAddress)
+	if err != nil {
+		return err
+	}
+	c.Lock()
+	c.listener = listener
+	c.self = opts.ClusterAdvertiseAddress
+	if c.self == "" {
+		c.self = listener.Addr().String()
+	}
+	c.started = true
+	c.waitGroup.Add(2)
+	go c.acceptLoop()
+	go c.broadcastLoop()
+	if opts.ClusterGossipInterval > 0 {
+		c.waitGroup.Add(1)
+		go c.gossipLoop(opts.ClusterGossipInterval)
+	}
+	c.Unlock()
+	c.ctx.TGO.Info("集群节点[%s] -> %s", c.self, listener.Addr())
+	for _, seed := range strings.Split(opts.ClusterSeeds, ",") {
+		if seed = strings.TrimSpace(seed); seed != "" {
+			c.addPeer(seed, true)
+		}
+	}
+	return nil
+}
+
+func (c *Cluster) Stop() error {
+	c.Lock()
+	if !c.started {
+		c.Unlock()
+		return nil
+	}
+	c.started = false
+	close(c.exitChan)
+	err := c.listener.Close()
+	for fc := range c.conns {
+		fc.Close()
+	}
+	c.Unlock()
+	for _, p := range c.peerList() { // 握手时持有peer的锁再获取集群的锁 不能在持有集群的锁时关闭peer
+		p.close()
+	}
+	c.waitGroup.Wait()
+	return err
+}
+
+// Node 本节点ID 没有启动时为空
+func (c *Cluster) Node() string {
+	c.RLock()
+	defer c.RUnlock()
+	return c.self
+}
+
+// Nodes 已连接的其他节点
+func (c *Cluster) Nodes() []string {
+	c.RLock()
+	peers := make(map[string]*peer, len(c.peers))
+	for node, p := range c.peers {
+		peers[node] = p
+	}
+	c.RUnlock()
+	nodes := make([]string, 0, len(peers))
+	for node, p := range peers {
+		if p.connected() {
+			nodes = append(nodes, node)
+		}
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// Locate 客户端连接的节点 客户端不在其他节点时为空
+func (c *Cluster) Locate(clientID uint64) string {
+	c.RLock()
+	defer c.RUnlock()
+	return c.presence[clientID]
+}
+
+// ---------- 在线状态 ----------
+
+func (c *Cluster) ClientOnline(clientID uint64) {
+	c.pushEvent(&frame{Type: framePresence, Online: true, ClientIDs: []uint64{clientID}})
+}
+
+func (c *Cluster) ClientOffline(clientID uint64) {
+	c.pushEvent(&frame{Type: framePresence, Online: false, ClientIDs: []uint64{clientID}})
+}
+
+func (c *Cluster) pushEvent(f *frame) {
+	c.RLock()
+	started := c.started
+	c.RUnlock()
+	if !started {
+		return
+	}
+	select {
+	case c.events <- f:
+	case <-c.exitChan:
+	}
+}
+
+// broadcastLoop 按顺序把本节点客户端的上线、下线通知已连接的节点
+// 没有连接的节点在连接时通过hello得到最新的在线客户端
+func (c *Cluster) broadcastLoop() {
+	defer c.waitGroup.Done()
+	for {
+		select {
+		case f := <-c.events:
+			for _, p := range c.peerList() {
+				if err := p.send(f); err != nil && err != errPeerNotConnected {
+					c.ctx.TGO.Debug("通知集群节点[%s]在线状态失败！-> %v", p.node, err)
+				}
+			}
+		case <-c.exitChan:
+			return
+		}
+	}
+}
+
+func (c *Cluster) localClientIDs() []uint64 {
+	conns := c.ctx.TGO.ConnManager.Conns()
+	clientIDs := make([]uint64, 0, len(conns))
+	for clientID := range conns {
+		clientIDs = append(clientIDs, clientID)
+	}
+	return clientIDs
+}
+
+// setPresence 更新节点[node]的客户端在线状态（调用方需持有锁）
+func (c *Cluster) setPresence(node string, clientIDs []uint64, online bool) {
+	clients := c.nodeClients[node]
+	if clients == nil {
+		clients = map[uint64]struct{}{}
+		c.nodeClients[node] = clients
+	}
+	for _, clientID := range clientIDs {
+		if online {
+			if oldNode, ok := c.presence[clientID]; ok && oldNode != node {
+				delete(c.nodeClients[oldNode], clientID)
+			}
+			c.presence[clientID] = node
+			clients[clientID] = struct{}{}
+		} else if c.presence[clientID] == node {
+			delete(c.presence, clientID)
+			delete(clients, clientID)
+		}
+	}
+}
+
+// forwardOffline 客户端在其他节点上线 转发本节点保存的离线消息（同一个客户端同时只有一个转发）
+func (c *Cluster) forwardOffline(clientIDs []uint64) {
+	c.Lock()
+	defer c.Unlock()
+	if !c.started {
+		return
+	}
+	forwardIDs := make([]uint64, 0, len(clientIDs))
+	for _, clientID := range clientIDs {
+		if _, ok := c.forwarding[clientID]; !ok {
+			c.forwarding[clientID] = struct{}{}
+			forwardIDs = append(forwardIDs, clientID)
+		}
+	}
+	if len(forwardIDs) == 0 {
+		return
+	}
+	c.waitGroup.Add(1)
+	go func() {
+		defer c.waitGroup.Done()
+		for _, clientID := range forwardIDs {
+			c.ctx.TGO.ForwardOfflineMsg(clientID)
+			c.Lock()
+			delete(c.forwarding, clientID)
+			c.Unlock()
+		}
+	}()
+}
+
+// clearPresence 移除节点[node]的所有客户端（调用方需持有锁）
+func (c *Cluster) clearPresence(node string) {
+	for clientID := range c.nodeClients[node] {
+		if c.presence[clientID] == node {
+			delete(c.presence, clientID)
+		}
+	}
+	delete(c.nodeClients, node)
+}
+
+// ---------- 成员 ----------
+
+func (c *Cluster) peerList() []*peer {
+	c.RLock()
+	defer c.RUnlock()
+	peers := make([]*peer, 0, len(c.peers))
+	for _, p := range c.peers {
+		peers = append(peers, p)
+	}
+	return peers
+}
+
+// addPeer 添加节点并开始连接 已存在或者是本节点时忽略
+func (c *Cluster) addPeer(node string, seed bool) {
+	c.Lock()
+	defer c.Unlock()
+	if !c.started || node == c.self || c.peers[node] != nil {
+		return
+	}
+	p := newPeer(c, node, seed)
+	c.peers[node] = p
+	c.waitGroup.Add(1)
+	go p.run()
+}
+
+func (c *Cluster) removePeer(p *peer) {
+	c.Lock()
+	defer c.Unlock()
+	if c.peers[p.node] == p {
+		delete(c.peers, p.node)
+	}
+}
+
+// renamePeer 握手时得知节点的ID与连接的地址不同 节点已存在或者是本节点时返回false
+func (c *Cluster) renamePeer(p *peer, node string) bool {
+	c.Lock()
+	defer c.Unlock()
+	if node == c.self || c.peers[node] != nil {
+		return false
+	}
+	if c.peers[p.node] == p {
+		delete(c.peers, p.node)
+	}
+	p.node = node
+	c.peers[node] = p
+	return true
+}
+
+// members 本节点和已知的其他节点
+func (c *Cluster) members() []string {
+	c.RLock()
+	defer c.RUnlock()
+	nodes := []string{c.self}
+	for node := range c.peers {
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+func (c *Cluster) mergeMembers(nodes []string) {
+	for _, node := range nodes {
+		c.addPeer(node, false)
+	}
+}
+
+// gossipLoop 定时与一个随机的已连接节点交换成员列表
+func (c *Cluster) gossipLoop(interval time.Duration) {
+	defer c.waitGroup.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.exitChan:
+			return
+		}
+		peers := c.peerList()
+		connected := peers[:0]
+		for _, p := range peers {
+			if p.connected() {
+				connected = append(connected, p)
+			}
+		}
+		if len(connected) == 0 {
+			continue
+		}
+		p := connected[rand.Intn(len(connected))]
+		reply, err := p.request(&frame{Type: frameGossip, Node: c.self, Nodes: c.members()})
+		if err != nil {
+			c.ctx.TGO.Debug("与集群节点[%s]交换成员列表失败！-> %v", p.node, err)
+			continue
+		}
+		c.mergeMembers(reply.Nodes)
+	}
+}
+
+// ---------- 连接过来的节点 ----------
+
+func (c *Cluster) acceptLoop() {
+	defer c.waitGroup.Done()
+	for {
+		conn, err := c.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			c.ctx.TGO.Warn("集群接受连接失败！-> %v", err)
+			continue
+		}
+		fc := newFrameConn(conn)
+		c.Lock()
+		if !c.started {
+			c.Unlock()
+			fc.Close()
+			return
+		}
+		c.conns[fc] = struct{}{}
+		c.waitGroup.Add(1)
+		c.Unlock()
+		go c.serveInbound(fc)
+	}
+}
+
+// validToken 校验对方节点的ClusterToken
+func (c *Cluster) validToken(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(token), []byte(c.ctx.TGO.GetOpts().ClusterToken)) == 1
+}
+
+// serveInbound 处理其他节点的请求 第一帧必须为带上正确ClusterToken的hello 否则断开
+func (c *Cluster) serveInbound(fc *frameConn) {
+	defer c.waitGroup.Done()
+	defer func() {
+		fc.Close()
+		c.Lock()
+		delete(c.conns, fc)
+		c.Unlock()
+	}()
+	timeout := c.ctx.TGO.GetOpts().ClusterTimeout
+	hello, err := fc.read(timeout)
+	if err != nil || hello.Type != frameHello || hello.Node == "" {
+		c.ctx.TGO.Warn("集群节点握手失败！-> %v", err)
+		return
+	}
+	if !c.validToken(hello.Token) {
+		c.ctx.TGO.Warn("集群节点[%s]的token不正确，拒绝连接！", fc.conn.RemoteAddr())
+		return
+	}
+	if err = fc.write(&frame{Type: frameHello, Node: c.self, Token: c.ctx.TGO.GetOpts().ClusterToken}, timeout); err != nil {
+		return
+	}
+	node := hello.Node
+	if node == c.self { // 连接的是自己 对方收到回复后会移除
+		return
+	}
+	c.Lock()
+	c.inbound[node] = fc
+	c.clearPresence(node)
+	c.setPresence(node, hello.ClientIDs, true)
+	c.Unlock()
+	c.forwardOffline(hello.ClientIDs)
+	defer func() {
+		c.Lock()
+		if c.inbound[node] == fc {
+			delete(c.inbound, node)
+			c.clearPresence(node)
+		}
+		c.Unlock()
+	}()
+	c.addPeer(node, false)
+
+	for {
+		f, err := fc.read(0)
+		if err != nil {
+			return
+		}
+		switch f.Type {
+		case framePresence:
+			c.Lock()
+			c.setPresence(node, f.ClientIDs, f.Online)
+			c.Unlock()
+			if f.Online {
+				c.forwardOffline(f.ClientIDs)
+			}
+		case frameGossip:
+			c.mergeMembers(f.Nodes)
+			err = fc.write(&frame{Type: frameGossip, Seq: f.Seq, Node: c.self, Nodes: c.members()}, timeout)
+		case frameForward:
+			reply := &frame{Type: frameAck, Seq: f.Seq}
+			if f.Msg == nil {
+				reply.Error = "消息不能为空！"
+			} else if acceptErr := c.ctx.TGO.AcceptForwardMsg(f.ClientID, f.ChannelID, f.Msg); acceptErr != nil {
+				reply.Error = acceptErr.Error()
+			}
+			err = fc.write(reply, timeout)
+		default:
+			c.ctx.TGO.Warn("集群节点[%s]发送了不支持的帧[%s]！", node, f.Type)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// ---------- 转发 ----------
+
+func (c *Cluster) Forward(clientID uint64, channelID uint64, msg *tgo.Msg) (bool, error) {
+	c.RLock()
+	node, ok := c.presence[clientID]
+	p := c.peers[node]
+	c.RUnlock()
+	if !ok {
+		return false, nil
+	}
+	if p == nil {
+		return false, fmt.Errorf("集群节点[%s]不可用！", node)
+	}
+	reply, err := p.request(&frame{Type: frameForward, ClientID: clientID, ChannelID: channelID, Msg: msg})
+	if err != nil {
+		return false, err
+	}
+	if reply.Error != "" {
+		return false, errors.New(reply.Error)
+	}
+	return true, nil
+}
@@ -0,0 +1,220 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/tgo-team/tgo-core/tgo"
+	"github.com/tgo-team/tgo-core/tgo/client"
+	"github.com/tgo-team/tgo-core/tgo/protocol"
+	"github.com/tgo-team/tgo-core/tgo/server/tcp"
+	"github.com/tgo-team/tgo-core/tgo/storage"
+)
+
+// startNode 在回环地址上启动一个节点 seeds为空时作为第一个节点
+func startNode(t *testing.T, gossipInterval time.Duration, seeds string) *tgo.TGO {
+	opts := tgo.NewOptions()
+	opts.DataPath = t.TempDir()
+	opts.TCPAddress = "127.0.0.1:0"
+	opts.HTTPAddress = ""
+	opts.LogLevel = tgo.ErrorLevel
+	opts.Pro = protocol.New()
+	opts.ClusterAddress = "127.0.0.1:0"
+	opts.ClusterSeeds = seeds
+	opts.ClusterGossipInterval = gossipInterval
+	opts.ClusterToken = "secret"
+	tg, err := tgo.NewBuilder(opts).Server(tcp.New).Storage(storage.NewMemory).Cluster(New).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tg.MatchDefaultHandlers()
+	if err = tg.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tg.Stop() })
+	// 每个节点的存储是独立的 客户端和管道需要在所有节点添加
+	for clientID := uint64(1); clientID <= 3; clientID++ {
+		tg.Storage.AddClient(tgo.NewClient(clientID, "pwd"))
+		tg.Storage.AddChannel(tgo.NewChannelModel(clientID, tgo.ChannelTypePerson))
+		tg.Storage.Bind(clientID, clientID)
+	}
+	return tg
+}
+
+func nodeOf(tg *tgo.TGO) *Cluster {
+	return tg.Cluster().(*Cluster)
+}
+
+func connectClient(t *testing.T, tg *tgo.TGO, clientID uint64) *client.Client {
+	c := client.New(&client.Options{
+		Addr:     tg.Servers[0].(*tcp.Server).Addr().String(),
+		ClientID: clientID,
+		Password: "pwd",
+	})
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func waitFor(t *testing.T, desc string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("等待%s超时！", desc)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func receive(t *testing.T, c *client.Client) *client.Message {
+	t.Helper()
+	select {
+	case msg := <-c.Messages():
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待消息超时！")
+	}
+	return nil
+}
+
+// TestCluster_gossip 只配置第一个节点作为种子 通过交换成员列表互相发现
+func TestCluster_gossip(t *testing.T) {
+	a := startNode(t, 20*time.Millisecond, "")
+	b := startNode(t, 20*time.Millisecond, nodeOf(a).Node())
+	c := startNode(t, 20*time.Millisecond, nodeOf(a).Node())
+	for _, tg := range []*tgo.TGO{a, b, c} {
+		node := nodeOf(tg)
+		waitFor(t, "节点["+node.Node()+"]发现其他节点", func() bool { return len(node.Nodes()) == 2 })
+	}
+}
+
+func TestCluster_forward(t *testing.T) {
+	a := startNode(t, 0, "")
+	b := startNode(t, 0, nodeOf(a).Node())
+	waitFor(t, "节点互相连接", func() bool {
+		return len(nodeOf(a).Nodes()) == 1 && len(nodeOf(b).Nodes()) == 1
+	})
+	c1 := connectClient(t, a, 1)
+	c2 := connectClient(t, b, 2)
+	waitFor(t, "在线表同步", func() bool { return nodeOf(a).Locate(2) == nodeOf(b).Node() })
+
+	// 个人管道
+	messageID, err := c1.Send(context.Background(), 2, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := receive(t, c2); msg.MessageID != messageID || msg.From != 1 || string(msg.Payload) != "hello" {
+		t.Fatalf("收到的消息不正确！-> %+v", msg)
+	}
+	waitFor(t, "转发的消息从本节点移除", func() bool {
+		msgList, _ := a.Storage.GetMsgInChannel(2, 1, 10)
+		return len(msgList) == 0
+	})
+
+	// 写扩散的群组 成员的个人管道转发到成员所在的节点
+	var groupID uint64 = 1000
+	for _, tg := range []*tgo.TGO{a, b} {
+		tg.Storage.AddChannel(tgo.NewChannelModel(groupID, tgo.ChannelTypeGroup))
+		tg.Storage.Bind(1, groupID)
+		tg.Storage.Bind(2, groupID)
+	}
+	if messageID, err = c1.Send(context.Background(), groupID, []byte("group")); err != nil {
+		t.Fatal(err)
+	}
+	if msg := receive(t, c2); msg.MessageID != messageID || string(msg.Payload) != "group" {
+		t.Fatalf("收到的群组消息不正确！-> %+v", msg)
+	}
+
+	// 读扩散的群组在集群模式下使用写扩散 其他节点的成员同样能收到
+	var readGroupID uint64 = 1001
+	for _, tg := range []*tgo.TGO{a, b} {
+		model := tgo.NewChannelModel(readGroupID, tgo.ChannelTypeGroup)
+		model.FanoutMode = tgo.FanoutModeRead
+		tg.Storage.AddChannel(model)
+		tg.Storage.Bind(1, readGroupID)
+		tg.Storage.Bind(2, readGroupID)
+	}
+	if messageID, err = c1.Send(context.Background(), readGroupID, []byte("read group")); err != nil {
+		t.Fatal(err)
+	}
+	if msg := receive(t, c2); msg.MessageID != messageID || string(msg.Payload) != "read group" {
+		t.Fatalf("收到的读扩散群组消息不正确！-> %+v", msg)
+	}
+
+	// 客户端下线后 消息保存在发送的节点 客户端在其他节点上线时转发过去
+	c2.Close()
+	waitFor(t, "客户端下线同步", func() bool { return nodeOf(a).Locate(2) == "" })
+	if messageID, err = c1.Send(context.Background(), 2, []byte("offline")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "离线消息保存在本节点", func() bool {
+		msgList, _ := a.Storage.GetMsgInChannel(2, 1, 10)
+		return len(msgList) == 1 && msgList[0].MessageID == messageID
+	})
+	c2 = connectClient(t, b, 2)
+	if msg := receive(t, c2); msg.MessageID != messageID || string(msg.Payload) != "offline" {
+		t.Fatalf("收到的离线消息不正确！-> %+v", msg)
+	}
+	waitFor(t, "转发的离线消息从本节点移除", func() bool {
+		msgList, _ := a.Storage.GetMsgInChannel(2, 1, 10)
+		return len(msgList) == 0
+	})
+}
+
+// TestCluster_nodeStop 节点停止后 其他节点移除该节点的在线客户端
+func TestCluster_nodeStop(t *testing.T) {
+	a := startNode(t, 0, "")
+	b := startNode(t, 0, nodeOf(a).Node())
+	connectClient(t, b, 2)
+	waitFor(t, "在线表同步", func() bool { return nodeOf(a).Locate(2) == nodeOf(b).Node() })
+	b.Stop()
+	waitFor(t, "移除停止节点的客户端", func() bool { return nodeOf(a).Locate(2) == "" })
+}
+
+// TestCluster_token token不正确或者第一帧不是hello的连接被断开 不能修改在线表
+func TestCluster_token(t *testing.T) {
+	a := startNode(t, 0, "")
+	for _, first := range []*frame{
+		{Type: frameHello, Node: "127.0.0.1:1", Token: "wrong", ClientIDs: []uint64{2}},
+		{Type: framePresence, Online: true, ClientIDs: []uint64{2}},
+	} {
+		conn, err := net.Dial("tcp", nodeOf(a).Node())
+		if err != nil {
+			t.Fatal(err)
+		}
+		fc := newFrameConn(conn)
+		if err = fc.write(first, time.Second); err != nil {
+			t.Fatal(err)
+		}
+		fc.write(&frame{Type: framePresence, Online: true, ClientIDs: []uint64{2}}, time.Second)
+		if reply, err := fc.read(5 * time.Second); err == nil {
+			t.Fatalf("连接应该被断开！-> %+v", reply)
+		}
+		fc.Close()
+		if node := nodeOf(a).Locate(2); node != "" {
+			t.Fatalf("没有通过握手的连接不能修改在线表！-> %s", node)
+		}
+	}
+
+	opts := tgo.NewOptions()
+	opts.TCPAddress = "127.0.0.1:0"
+	opts.HTTPAddress = ""
+	opts.LogLevel = tgo.ErrorLevel
+	opts.Pro = protocol.New()
+	opts.ClusterAddress = "127.0.0.1:0"
+	tg, err := tgo.NewBuilder(opts).Server(tcp.New).Storage(storage.NewMemory).Cluster(New).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tg.Stop()
+	var optionErr *tgo.OptionError
+	if err = tg.Start(); !errors.As(err, &optionErr) || optionErr.Field != "cluster_token" {
+		t.Fatalf("没有配置cluster_token应该启动失败！-> %v", err)
+	}
+}
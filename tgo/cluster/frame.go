@@ -0,0 +1,79 @@
+package cluster
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/tgo-team/tgo-core/tgo"
+)
+
+// 节点之间的帧类型
+const (
+	frameHello    = "hello"    // 连接后的第一帧 带上ClusterToken和本节点的在线客户端 对方校验后回复hello
+	framePresence = "presence" // 客户端上线、下线 不需要回复
+	frameGossip   = "gossip"   // 交换成员列表 对方回复自己的成员列表
+	frameForward  = "forward"  // 转发消息 对方回复ack
+	frameAck      = "ack"      // forward的回复 Error为空表示对方已接收
+)
+
+// frame 节点之间通信的帧 每帧为一行JSON
+// 每个节点主动连接其他节点（peer）发送请求，对方在同一个连接上回复（Seq相同）
+type frame struct {
+	Type      string   `json:"type"`
+	Seq       uint64   `json:"seq,omitempty"`
+	Node      string   `json:"node,omitempty"`
+	Token     string   `json:"token,omitempty"` // hello时双方校验ClusterToken
+	Nodes     []string `json:"nodes,omitempty"`
+	ClientIDs []uint64 `json:"client_ids,omitempty"`
+	Online    bool     `json:"online,omitempty"`
+	ClientID  uint64   `json:"client_id,omitempty"`
+	ChannelID uint64   `json:"channel_id,omitempty"`
+	Msg       *tgo.Msg `json:"msg,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// frameConn 读写帧的连接 写入可以在多个协程中调用
+type frameConn struct {
+	conn      net.Conn
+	decoder   *json.Decoder
+	writeLock sync.Mutex
+}
+
+func newFrameConn(conn net.Conn) *frameConn {
+	return &frameConn{
+		conn:    conn,
+		decoder: json.NewDecoder(bufio.NewReader(conn)),
+	}
+}
+
+func (c *frameConn) read(timeout time.Duration) (*frame, error) {
+	if timeout > 0 {
+		c.conn.SetReadDeadline(time.Now().Add(timeout))
+	} else {
+		c.conn.SetReadDeadline(time.Time{})
+	}
+	f := &frame{}
+	if err := c.decoder.Decode(f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (c *frameConn) write(f *frame, timeout time.Duration) error {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(timeout))
+	_, err = c.conn.Write(append(data, '\n'))
+	return err
+}
+
+func (c *frameConn) Close() error {
+	return c.conn.Close()
+}
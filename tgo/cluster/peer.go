@@ -0,0 +1,208 @@
+package cluster
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+var errPeerNotConnected = errors.New("节点未连接！")
+
+const (
+	reconnectMin = 100 * time.Millisecond
+	reconnectMax = 5 * time.Second
+)
+
+// peer 其他节点 本节点主动连接对方 发送在线状态、交换成员列表和转发消息
+// ClusterSeeds中的节点断开后一直重连，其他节点（gossip或者连接过来得知的）重连失败后移除
+type peer struct {
+	c        *Cluster
+	node     string
+	seed     bool
+	fc       *frameConn // 没有连接时为nil
+	pending  map[uint64]chan *frame
+	sequence uint64
+	sync.Mutex
+}
+
+func newPeer(c *Cluster, node string, seed bool) *peer {
+	return &peer{
+		c:       c,
+		node:    node,
+		seed:    seed,
+		pending: map[uint64]chan *frame{},
+	}
+}
+
+func (p *peer) run() {
+	defer p.c.waitGroup.Done()
+	backoff := reconnectMin
+	for {
+		fc, err := p.connect()
+		if err == nil && fc == nil { // 连接的是自己或者已经连接的节点（同一个节点的不同地址）
+			p.c.removePeer(p)
+			return
+		}
+		if err != nil {
+			if !p.seed {
+				p.c.ctx.TGO.Warn("连接集群节点[%s]失败，移除节点！-> %v", p.node, err)
+				p.c.removePeer(p)
+				return
+			}
+			p.c.ctx.TGO.Debug("连接集群节点[%s]失败！-> %v", p.node, err)
+			select {
+			case <-time.After(backoff):
+			case <-p.c.exitChan:
+				return
+			}
+			if backoff *= 2; backoff > reconnectMax {
+				backoff = reconnectMax
+			}
+			continue
+		}
+		backoff = reconnectMin
+		p.c.ctx.TGO.Info("已连接集群节点[%s]！", p.node)
+		err = p.readLoop(fc)
+		p.disconnect()
+		select {
+		case <-p.c.exitChan:
+			return
+		default:
+		}
+		p.c.ctx.TGO.Warn("集群节点[%s]的连接断开！-> %v", p.node, err)
+	}
+}
+
+// connect 连接并握手 握手时带上本节点的在线客户端
+// 持有锁直到握手完成，保证之后的在线状态都在hello之后发送
+func (p *peer) connect() (*frameConn, error) {
+	timeout := p.c.ctx.TGO.GetOpts().ClusterTimeout
+	conn, err := net.DialTimeout("tcp", p.node, timeout)
+	if err != nil {
+		return nil, err
+	}
+	fc := newFrameConn(conn)
+	p.Lock()
+	defer p.Unlock()
+	err = fc.write(&frame{Type: frameHello, Node: p.c.self, Token: p.c.ctx.TGO.GetOpts().ClusterToken, ClientIDs: p.c.localClientIDs()}, timeout)
+	if err == nil {
+		var reply *frame
+		if reply, err = fc.read(timeout); err == nil {
+			if reply.Type != frameHello {
+				err = errors.New("握手回复不正确！")
+			} else if !p.c.validToken(reply.Token) {
+				err = errors.New("节点的token不正确！")
+			} else if reply.Node != p.node && !p.c.renamePeer(p, reply.Node) {
+				fc.Close()
+				return nil, nil
+			}
+		}
+	}
+	if err != nil {
+		fc.Close()
+		return nil, err
+	}
+	select {
+	case <-p.c.exitChan:
+		fc.Close()
+		return nil, errors.New("集群已停止！")
+	default:
+	}
+	p.fc = fc
+	return fc, nil
+}
+
+// readLoop 读取对方的回复 连接断开时返回
+func (p *peer) readLoop(fc *frameConn) error {
+	for {
+		f, err := fc.read(0)
+		if err != nil {
+			return err
+		}
+		p.Lock()
+		replyChan, ok := p.pending[f.Seq]
+		delete(p.pending, f.Seq)
+		p.Unlock()
+		if ok {
+			replyChan <- f
+		}
+	}
+}
+
+// disconnect 关闭连接 等待回复的请求返回错误
+func (p *peer) disconnect() {
+	p.Lock()
+	defer p.Unlock()
+	if p.fc != nil {
+		p.fc.Close()
+		p.fc = nil
+	}
+	for seq, replyChan := range p.pending {
+		replyChan <- &frame{Type: frameAck, Seq: seq, Error: errPeerNotConnected.Error()}
+		delete(p.pending, seq)
+	}
+}
+
+func (p *peer) close() {
+	p.Lock()
+	defer p.Unlock()
+	if p.fc != nil {
+		p.fc.Close()
+	}
+}
+
+func (p *peer) connected() bool {
+	p.Lock()
+	defer p.Unlock()
+	return p.fc != nil
+}
+
+// send 发送不需要回复的帧
+func (p *peer) send(f *frame) error {
+	p.Lock()
+	fc := p.fc
+	p.Unlock()
+	if fc == nil {
+		return errPeerNotConnected
+	}
+	return fc.write(f, p.c.ctx.TGO.GetOpts().ClusterTimeout)
+}
+
+// request 发送请求并等待回复
+func (p *peer) request(f *frame) (*frame, error) {
+	timeout := p.c.ctx.TGO.GetOpts().ClusterTimeout
+	p.Lock()
+	fc := p.fc
+	if fc == nil {
+		p.Unlock()
+		return nil, errPeerNotConnected
+	}
+	p.sequence++
+	f.Seq = p.sequence
+	replyChan := make(chan *frame, 1)
+	p.pending[f.Seq] = replyChan
+	p.Unlock()
+
+	removePending := func() {
+		p.Lock()
+		delete(p.pending, f.Seq)
+		p.Unlock()
+	}
+	if err := fc.write(f, timeout); err != nil {
+		removePending()
+		return nil, err
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case reply := <-replyChan:
+		return reply, nil
+	case <-timer.C:
+		removePending()
+		return nil, errors.New("等待集群节点[" + p.node + "]回复超时！")
+	case <-p.c.exitChan:
+		removePending()
+		return nil, errors.New("集群已停止！")
+	}
+}
@@ -1,41 +1,69 @@
 package tgo
 
 import (
+	"context"
 	"sync"
 )
 
 // -------------- clientManager -----------------------
 
 type connManager struct {
-	conns          map[uint64]Conn
-	connLock       sync.RWMutex
+	conns            map[uint64]Conn
+	tags             map[uint64][]string     // 在线客户端的标签（广播管道按标签定向投递）
+	connContexts     map[uint64]*connContext // 连接的上下文 连接移除时取消
+	connLock         sync.RWMutex
 	clientIDSequence int64
 }
 
 func newConnManager() *connManager {
 
 	return &connManager{
-		conns: make(map[uint64]Conn),
+		conns:        make(map[uint64]Conn),
+		tags:         make(map[uint64][]string),
+		connContexts: make(map[uint64]*connContext),
 	}
 }
 
-func (cm *connManager) AddConn(connID uint64,conn Conn) uint64 {
+// AddConn 添加连接 同一个客户端重新连接时关闭之前的连接
+func (cm *connManager) AddConn(connID uint64, conn Conn) uint64 {
 	cm.connLock.Lock()
+	oldConn := cm.conns[connID]
 	cm.conns[connID] = conn
+	if oldConnContext, ok := cm.connContexts[connID]; ok { // 同一个客户端重新连接 取消之前连接的上下文
+		oldConnContext.cancel()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cm.connContexts[connID] = &connContext{conn: conn, ctx: ctx, cancel: cancel}
 	cm.connLock.Unlock()
+	if oldConn != nil && oldConn != conn {
+		go closeConn(oldConn) // 关闭时会通知AcceptConnExitChan 不能在msgLoop中阻塞
+	}
 	return connID
 }
 
-func (cm *connManager) RemoveConn(connID uint64) {
+// RemoveConn 移除连接 只有当前记录的连接为conn时才移除（重新连接后旧连接的退出不影响新连接）
+func (cm *connManager) RemoveConn(connID uint64, conn Conn) bool {
 	cm.connLock.Lock()
-	_, ok := cm.conns[connID]
-	if !ok {
+	current, ok := cm.conns[connID]
+	if !ok || current != conn {
 		cm.connLock.Unlock()
-		return
+		return false
 	}
 	delete(cm.conns, connID)
+	delete(cm.tags, connID)
+	if connContext, ok := cm.connContexts[connID]; ok {
+		connContext.cancel()
+		delete(cm.connContexts, connID)
+	}
 	cm.connLock.Unlock()
+	return true
+}
 
+// Len 在线连接数量
+func (cm *connManager) Len() int {
+	cm.connLock.RLock()
+	defer cm.connLock.RUnlock()
+	return len(cm.conns)
 }
 
 func (cm *connManager) GetConn(connID uint64) Conn {
@@ -43,3 +71,61 @@ func (cm *connManager) GetConn(connID uint64) Conn {
 	defer cm.connLock.Unlock()
 	return cm.conns[connID]
 }
+
+// connContext 连接的上下文
+type connContext struct {
+	conn   Conn
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// ConnContext 获取连接的上下文 连接移除（关闭）时Done 连接不在线返回nil
+func (cm *connManager) ConnContext(connID uint64, conn Conn) context.Context {
+	cm.connLock.RLock()
+	defer cm.connLock.RUnlock()
+	connContext, ok := cm.connContexts[connID]
+	if !ok || connContext.conn != conn {
+		return nil
+	}
+	return connContext.ctx
+}
+
+// Conns 所有在线连接的快照
+func (cm *connManager) Conns() map[uint64]Conn {
+	cm.connLock.RLock()
+	defer cm.connLock.RUnlock()
+	conns := make(map[uint64]Conn, len(cm.conns))
+	for connID, conn := range cm.conns {
+		conns[connID] = conn
+	}
+	return conns
+}
+
+// SetTags 设置在线客户端的标签
+func (cm *connManager) SetTags(connID uint64, tags []string) {
+	cm.connLock.Lock()
+	defer cm.connLock.Unlock()
+	if _, ok := cm.conns[connID]; !ok {
+		return
+	}
+	cm.tags[connID] = tags
+}
+
+// Tags 在线客户端的标签
+func (cm *connManager) Tags(connID uint64) []string {
+	cm.connLock.RLock()
+	defer cm.connLock.RUnlock()
+	return cm.tags[connID]
+}
+
+// HasTag 在线客户端是否有标签[tag]
+func (cm *connManager) HasTag(connID uint64, tag string) bool {
+	cm.connLock.RLock()
+	defer cm.connLock.RUnlock()
+	for _, t := range cm.tags[connID] {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
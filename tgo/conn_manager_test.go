@@ -0,0 +1,45 @@
+package tgo
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+// closableConn 记录是否被关闭的测试连接
+type closableConn struct {
+	StatefulConnTest
+	closed int32
+}
+
+func (c *closableConn) Close() error {
+	atomic.StoreInt32(&c.closed, 1)
+	return nil
+}
+
+// TestConnManager_reconnect 重新连接时关闭旧连接 旧连接的退出不移除新连接
+func TestConnManager_reconnect(t *testing.T) {
+	tg := startTGO(NewOptions())
+	defer tg.Stop()
+
+	oldConn := &closableConn{StatefulConnTest: StatefulConnTest{id: 1}}
+	newConn := &closableConn{StatefulConnTest: StatefulConnTest{id: 1}}
+	tg.ConnManager.AddConn(1, oldConn)
+	tg.topics.trie.Subscribe("a/b", 1)
+	tg.ConnManager.AddConn(1, newConn)
+	waitFor(t, func() bool { return atomic.LoadInt32(&oldConn.closed) == 1 })
+	if atomic.LoadInt32(&newConn.closed) != 0 {
+		t.Fatal("新连接不应该被关闭！")
+	}
+
+	otherConn := &StatefulConnTest{id: 2}
+	tg.ConnManager.AddConn(2, otherConn)
+	tg.AcceptConnExitChan <- oldConn
+	tg.AcceptConnExitChan <- otherConn // msgLoop按顺序处理 移除otherConn时oldConn的退出已处理
+	waitFor(t, func() bool { return tg.ConnManager.GetConn(2) == nil })
+	if tg.ConnManager.GetConn(1) != newConn {
+		t.Fatal("旧连接的退出不应该移除新连接！")
+	}
+	if clientIDs := tg.topics.trie.Match("a/b"); len(clientIDs) != 1 {
+		t.Fatalf("旧连接的退出不应该取消新连接的订阅！-> %v", clientIDs)
+	}
+}
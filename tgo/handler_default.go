@@ -0,0 +1,113 @@
+package tgo
+
+import (
+	"fmt"
+
+	"github.com/tgo-team/tgo-core/tgo/packets"
+)
+
+// MatchDefaultHandlers 注册默认的包处理 连接认证、心跳、发送消息和消息确认
+// 需要自定义这些包的处理时不要调用，自行通过Match注册
+func (t *TGO) MatchDefaultHandlers() {
+	t.Match(fmt.Sprintf("%s%d", matchTypePrefix, packets.Connect), t.handleConnect)
+	t.Match(fmt.Sprintf("%s%d", matchTypePrefix, packets.Pingreq), t.handlePingreq)
+	t.Match(fmt.Sprintf("%s%d", matchTypePrefix, packets.Message), t.handleMessage)
+	t.Match(fmt.Sprintf("%s%d", matchTypePrefix, packets.Msgack), t.handleMsgack)
+}
+
+// handleConnect 认证连接 认证成功后确保客户端的个人管道存在，回复Connack并开始读取连接之后的包
+func (t *TGO) handleConnect(m *MContext) {
+	connectPacket := m.Packet().(*packets.ConnectPacket)
+	statefulConn, ok := m.Conn().(StatefulConn)
+	if !ok {
+		m.Error("连接不支持认证！")
+		return
+	}
+	err := t.Authenticate(connectPacket.ClientID, connectPacket.Password)
+	if err != nil {
+		m.Debug("客户端[%d]认证失败！-> %v", connectPacket.ClientID, err)
+		m.ReplyPacket(packets.NewConnackPacket(packets.ConnReturnCodePasswordOrUnameError))
+		closeConn(m.Conn())
+		return
+	}
+	if err = t.ensurePersonChannel(connectPacket.ClientID); err != nil {
+		m.Error("创建客户端[%d]的个人管道失败！-> %v", connectPacket.ClientID, err)
+		m.ReplyPacket(packets.NewConnackPacket(packets.ConnReturnCodeError))
+		closeConn(m.Conn())
+		return
+	}
+	statefulConn.SetID(connectPacket.ClientID)
+	statefulConn.SetAuth(true)
+	m.ReplyPacket(packets.NewConnackPacket(packets.ConnReturnCodeSuccess))
+	t.AcceptAuthenticatedChan <- NewAuthenticatedContext(connectPacket.ClientID, statefulConn)
+	statefulConn.StartIOLoop()
+}
+
+// ensurePersonChannel 个人管道不存在时创建并绑定客户端
+func (t *TGO) ensurePersonChannel(clientID uint64) error {
+	model, err := t.Storage.GetChannel(clientID)
+	if err != nil || model != nil {
+		return err
+	}
+	if err = t.Storage.AddChannel(NewChannelModel(clientID, ChannelTypePerson)); err != nil {
+		return err
+	}
+	return t.Storage.Bind(clientID, clientID)
+}
+
+func (t *TGO) handlePingreq(m *MContext) {
+	m.ReplyPacket(packets.NewPingrespPacket())
+}
+
+// handleMessage 将消息放入目标管道 存储成功后回复Msgack
+// 存储可能阻塞（投递队列满），所以在协程中处理
+func (t *TGO) handleMessage(m *MContext) {
+	statefulConn, ok := m.Conn().(StatefulConn)
+	if !ok || !statefulConn.IsAuth() {
+		m.Warn("未认证的连接不能发送消息！")
+		return
+	}
+	messagePacket := m.Packet().(*packets.MessagePacket)
+	channel, err := t.GetChannel(messagePacket.ChannelID)
+	if err != nil {
+		m.Error("获取管道[%d]失败！-> %v", messagePacket.ChannelID, err)
+		return
+	}
+	if channel == nil {
+		m.Warn("管道[%d]不存在！", messagePacket.ChannelID)
+		return
+	}
+	msg := m.Msg()
+	msg.From = statefulConn.GetID()
+	cp := m.Copy()
+	t.waitGroup.Wrap(func() {
+		defer cp.Release()
+		if err := channel.PutMsg(msg); err != nil {
+			cp.Error("消息[%d]放入管道[%d]失败！-> %v", msg.MessageID, messagePacket.ChannelID, err)
+			return
+		}
+		cp.ReplyPacket(packets.NewMsgackPacket([]uint64{msg.MessageID}))
+	})
+}
+
+// handleMsgack 客户端确认收到消息 从客户端的个人管道中移除消息
+func (t *TGO) handleMsgack(m *MContext) {
+	statefulConn, ok := m.Conn().(StatefulConn)
+	if !ok || !statefulConn.IsAuth() {
+		return
+	}
+	msgackPacket := m.Packet().(*packets.MsgackPacket)
+	err := t.Storage.RemoveMsgInChannel(msgackPacket.MessageIDs, statefulConn.GetID())
+	if err != nil {
+		m.Error("移除客户端[%d]的消息失败！-> %v", statefulConn.GetID(), err)
+	}
+}
+
+// closeConn 关闭连接 连接不支持关闭返回false
+func closeConn(conn Conn) bool {
+	closer, ok := conn.(interface{ Close() error })
+	if ok {
+		closer.Close()
+	}
+	return ok
+}
@@ -0,0 +1,64 @@
+package tgo
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+// httpServer TGO内置的http服务（/metrics等 需要AdminToken）
+type httpServer struct {
+	mux      *http.ServeMux
+	server   *http.Server
+	listener net.Listener
+}
+
+func newHTTPServer() *httpServer {
+	return &httpServer{
+		mux: http.NewServeMux(),
+	}
+}
+
+// HTTPMux 内置http服务的路由，可以在Start之前挂载自定义的接口
+func (t *TGO) HTTPMux() *http.ServeMux {
+	return t.http.mux
+}
+
+// HTTPAddr 内置http服务实际监听的地址（没有启动返回nil）
+func (t *TGO) HTTPAddr() net.Addr {
+	if t.http.listener == nil {
+		return nil
+	}
+	return t.http.listener.Addr()
+}
+
+// startHTTP 在HTTPAddress上启动内置http服务 HTTPAddress为空则不启动
+func (t *TGO) startHTTP() error {
+	addr := t.GetOpts().HTTPAddress
+	if addr == "" {
+		return nil
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	t.http.listener = listener
+	t.http.server = &http.Server{Handler: t.http.mux}
+	t.waitGroup.Wrap(func() {
+		t.Info("HTTP服务 -> %s", listener.Addr())
+		if err := t.http.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			t.Error("HTTP服务退出！-> %v", err)
+		}
+	})
+	return nil
+}
+
+func (t *TGO) stopHTTP() error {
+	if t.http.server == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return t.http.server.Shutdown(ctx)
+}
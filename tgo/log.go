@@ -1,5 +1,12 @@
 package tgo
 
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+)
+
 // Level type
 type LogLevel uint32
 
@@ -22,10 +29,121 @@ const (
 	DebugLevel
 	TraceLevel
 )
+
 type Log interface {
-	Info(format string,a ...interface{})
-	Error(format string,a ...interface{})
-	Debug(format string,a ...interface{})
-	Warn(format string,a ...interface{})
-	Fatal(format string,a ...interface{})
-}
\ No newline at end of file
+	Info(format string, a ...interface{})
+	Error(format string, a ...interface{})
+	Debug(format string, a ...interface{})
+	Warn(format string, a ...interface{})
+	Fatal(format string, a ...interface{})
+}
+
+var levelNames = map[LogLevel]string{
+	PanicLevel: "panic",
+	FatalLevel: "fatal",
+	ErrorLevel: "error",
+	WarnLevel:  "warn",
+	InfoLevel:  "info",
+	DebugLevel: "debug",
+	TraceLevel: "trace",
+}
+
+func (level LogLevel) String() string {
+	name, ok := levelNames[level]
+	if !ok {
+		return fmt.Sprintf("level(%d)", level)
+	}
+	return name
+}
+
+// ParseLogLevel 通过名字获取日志级别 例如: debug
+func ParseLogLevel(name string) (LogLevel, error) {
+	for level, levelName := range levelNames {
+		if strings.EqualFold(levelName, name) {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf("不支持的日志级别[%s]！", name)
+}
+
+// Field 结构化日志的字段
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// 常用的日志字段名
+const (
+	FieldKeyClientID   = "client_id"
+	FieldKeyChannelID  = "channel_id"
+	FieldKeyMessageID  = "message_id"
+	FieldKeyRemoteAddr = "remote_addr"
+	FieldKeyHandler    = "handler"
+)
+
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+func FieldClientID(clientID uint64) Field {
+	return Field{Key: FieldKeyClientID, Value: clientID}
+}
+
+func FieldChannelID(channelID uint64) Field {
+	return Field{Key: FieldKeyChannelID, Value: channelID}
+}
+
+func FieldMessageID(messageID uint64) Field {
+	return Field{Key: FieldKeyMessageID, Value: messageID}
+}
+
+// FieldRemoteAddr 连接的远程地址（conn没有RemoteAddr方法时为conn本身）
+func FieldRemoteAddr(conn Conn) Field {
+	if addrConn, ok := conn.(interface{ RemoteAddr() net.Addr }); ok && addrConn.RemoteAddr() != nil {
+		return Field{Key: FieldKeyRemoteAddr, Value: addrConn.RemoteAddr().String()}
+	}
+	return Field{Key: FieldKeyRemoteAddr, Value: fmt.Sprintf("%v", conn)}
+}
+
+// StructuredLog 支持结构化字段和级别过滤的Log（可选实现）
+type StructuredLog interface {
+	Log
+	// Enabled 是否输出此级别的日志（不输出时调用方可以跳过格式化）
+	Enabled(level LogLevel) bool
+	// Log 输出一条带字段的日志
+	Log(level LogLevel, msg string, fields ...Field)
+}
+
+// logf 输出日志 lg实现了StructuredLog时带上字段，否则将字段追加到内容之后
+func logf(lg Log, level LogLevel, fields []Field, format string, a ...interface{}) {
+	if lg == nil {
+		return
+	}
+	if structuredLog, ok := lg.(StructuredLog); ok {
+		if !structuredLog.Enabled(level) {
+			return
+		}
+		structuredLog.Log(level, fmt.Sprintf(format, a...), fields...)
+		return
+	}
+	if len(fields) > 0 {
+		var buf bytes.Buffer
+		buf.WriteString(fmt.Sprintf(format, a...))
+		for _, field := range fields {
+			buf.WriteString(fmt.Sprintf(" %s=%v", field.Key, field.Value))
+		}
+		format, a = "%s", []interface{}{buf.String()}
+	}
+	switch level {
+	case PanicLevel, FatalLevel:
+		lg.Fatal(format, a...)
+	case ErrorLevel:
+		lg.Error(format, a...)
+	case WarnLevel:
+		lg.Warn(format, a...)
+	case InfoLevel:
+		lg.Info(format, a...)
+	default:
+		lg.Debug(format, a...)
+	}
+}
@@ -0,0 +1,197 @@
+package tgo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// LogEncoder 将一条日志编码为一行
+type LogEncoder interface {
+	Encode(buf *bytes.Buffer, t time.Time, level LogLevel, msg string, fields []Field)
+}
+
+// DefaultLog 默认的日志 按级别过滤，支持文本和JSON格式，可以同时输出到多个Writer（例如标准输出和轮转文件）
+type DefaultLog struct {
+	level   uint32 // LogLevel
+	encoder LogEncoder
+	writers []io.Writer
+	sync.Mutex
+}
+
+// NewDefaultLog 创建输出到标准输出的文本格式日志
+func NewDefaultLog(level LogLevel) *DefaultLog {
+	return &DefaultLog{
+		level:   uint32(level),
+		encoder: &TextLogEncoder{},
+		writers: []io.Writer{os.Stdout},
+	}
+}
+
+// newDefaultLogWithOptions 根据配置创建日志 配置了LogFile时同时输出到DataPath/logs下的轮转文件
+func newDefaultLogWithOptions(opts *Options) (*DefaultLog, error) {
+	lg := NewDefaultLog(opts.LogLevel)
+	switch opts.LogFormat {
+	case "", LogFormatText:
+	case LogFormatJSON:
+		lg.encoder = &JSONLogEncoder{}
+	default:
+		return nil, fmt.Errorf("不支持的日志格式[%s]！", opts.LogFormat)
+	}
+	if opts.LogFile != "" {
+		file, err := NewRotateFile(filepath.Join(opts.DataPath, "logs", opts.LogFile), opts.LogMaxSize, opts.LogRotateInterval, opts.LogMaxBackups, opts.LogMaxAge)
+		if err != nil {
+			return nil, err
+		}
+		lg.writers = append(lg.writers, file)
+	}
+	return lg, nil
+}
+
+// SetLevel 设置日志级别（可以在运行时修改）
+func (lg *DefaultLog) SetLevel(level LogLevel) {
+	atomic.StoreUint32(&lg.level, uint32(level))
+}
+
+func (lg *DefaultLog) Level() LogLevel {
+	return LogLevel(atomic.LoadUint32(&lg.level))
+}
+
+func (lg *DefaultLog) SetEncoder(encoder LogEncoder) {
+	lg.Lock()
+	lg.encoder = encoder
+	lg.Unlock()
+}
+
+// SetWriters 设置日志的输出
+func (lg *DefaultLog) SetWriters(writers ...io.Writer) {
+	lg.Lock()
+	lg.writers = writers
+	lg.Unlock()
+}
+
+func (lg *DefaultLog) Enabled(level LogLevel) bool {
+	return level <= lg.Level()
+}
+
+func (lg *DefaultLog) Log(level LogLevel, msg string, fields ...Field) {
+	if !lg.Enabled(level) {
+		return
+	}
+	now := time.Now()
+	lg.Lock()
+	defer lg.Unlock()
+	var buf bytes.Buffer
+	encoder := lg.encoder
+	if encoder == nil {
+		encoder = &TextLogEncoder{}
+	}
+	encoder.Encode(&buf, now, level, msg, fields)
+	writers := lg.writers
+	if writers == nil {
+		writers = []io.Writer{os.Stdout}
+	}
+	for _, writer := range writers {
+		writer.Write(buf.Bytes())
+	}
+}
+
+func (lg *DefaultLog) Info(format string, a ...interface{}) {
+	logf(lg, InfoLevel, nil, format, a...)
+}
+func (lg *DefaultLog) Error(format string, a ...interface{}) {
+	logf(lg, ErrorLevel, nil, format, a...)
+}
+func (lg *DefaultLog) Debug(format string, a ...interface{}) {
+	logf(lg, DebugLevel, nil, format, a...)
+}
+func (lg *DefaultLog) Warn(format string, a ...interface{}) {
+	logf(lg, WarnLevel, nil, format, a...)
+}
+func (lg *DefaultLog) Fatal(format string, a ...interface{}) {
+	logf(lg, FatalLevel, nil, format, a...)
+}
+
+// Close 关闭可以关闭的输出（例如日志文件）
+func (lg *DefaultLog) Close() error {
+	lg.Lock()
+	defer lg.Unlock()
+	for _, writer := range lg.writers {
+		if closer, ok := writer.(io.Closer); ok && writer != os.Stdout && writer != os.Stderr {
+			closer.Close()
+		}
+	}
+	return nil
+}
+
+// ---------- encoder ----------
+
+const logTimeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// TextLogEncoder 文本格式 例如: 2006-01-02T15:04:05.000+08:00 [Info]消息 client_id=1
+type TextLogEncoder struct {
+}
+
+func (e *TextLogEncoder) Encode(buf *bytes.Buffer, t time.Time, level LogLevel, msg string, fields []Field) {
+	buf.WriteString(t.Format(logTimeLayout))
+	buf.WriteString(" [")
+	name := level.String()
+	buf.WriteString(string(name[0]-'a'+'A') + name[1:])
+	buf.WriteString("]")
+	buf.WriteString(msg)
+	for _, field := range fields {
+		buf.WriteByte(' ')
+		buf.WriteString(field.Key)
+		buf.WriteByte('=')
+		value := fmt.Sprint(field.Value)
+		if value == "" || bytes.ContainsAny([]byte(value), " \"=\n") {
+			value = strconv.Quote(value)
+		}
+		buf.WriteString(value)
+	}
+	buf.WriteByte('\n')
+}
+
+// JSONLogEncoder JSON格式 例如: {"time":"...","level":"info","msg":"消息","client_id":1}
+type JSONLogEncoder struct {
+}
+
+func (e *JSONLogEncoder) Encode(buf *bytes.Buffer, t time.Time, level LogLevel, msg string, fields []Field) {
+	buf.WriteString(`{"time":`)
+	e.writeValue(buf, t.Format(logTimeLayout))
+	buf.WriteString(`,"level":`)
+	e.writeValue(buf, level.String())
+	buf.WriteString(`,"msg":`)
+	e.writeValue(buf, msg)
+	for _, field := range fields {
+		buf.WriteByte(',')
+		e.writeValue(buf, field.Key)
+		buf.WriteByte(':')
+		value := field.Value
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		e.writeValue(buf, value)
+	}
+	buf.WriteString("}\n")
+}
+
+func (e *JSONLogEncoder) writeValue(buf *bytes.Buffer, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buf.Write(data)
+}
@@ -0,0 +1,138 @@
+package tgo
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const rotateTimeLayout = "20060102-150405.000"
+
+// RotateFile 按大小和时间轮转的日志文件
+// 轮转时当前文件重命名为 文件名.时间，并按数量和时长清理轮转出来的文件
+type RotateFile struct {
+	path       string
+	maxSize    int64         // 文件超过此大小轮转 0表示不按大小轮转
+	interval   time.Duration // 文件打开超过此时间轮转 0表示不按时间轮转
+	maxBackups int           // 最多保留的轮转文件数量 0表示不限制
+	maxAge     time.Duration // 轮转文件最多保留多久 0表示不限制
+	file       *os.File
+	size       int64
+	openTime   time.Time
+	sync.Mutex
+}
+
+func NewRotateFile(path string, maxSize int64, interval time.Duration, maxBackups int, maxAge time.Duration) (*RotateFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f := &RotateFile{
+		path:       path,
+		maxSize:    maxSize,
+		interval:   interval,
+		maxBackups: maxBackups,
+		maxAge:     maxAge,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotateFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	f.openTime = time.Now()
+	return nil
+}
+
+func (f *RotateFile) Write(p []byte) (int, error) {
+	f.Lock()
+	defer f.Unlock()
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.needRotate(int64(len(p))) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *RotateFile) needRotate(writeLen int64) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.maxSize > 0 && f.size+writeLen > f.maxSize {
+		return true
+	}
+	return f.interval > 0 && time.Since(f.openTime) >= f.interval
+}
+
+// rotate 轮转当前文件（调用方需持有锁）
+func (f *RotateFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+	if err := os.Rename(f.path, f.path+"."+time.Now().Format(rotateTimeLayout)); err != nil {
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	f.removeBackups()
+	return nil
+}
+
+// removeBackups 清理超过数量或时长的轮转文件
+func (f *RotateFile) removeBackups() {
+	if f.maxBackups <= 0 && f.maxAge <= 0 {
+		return
+	}
+	backups, err := filepath.Glob(f.path + ".*")
+	if err != nil {
+		return
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(backups))) // 文件名带时间 倒序后最新的在前
+	for i, backup := range backups {
+		if !strings.HasPrefix(backup, f.path+".") {
+			continue
+		}
+		if f.maxBackups > 0 && i >= f.maxBackups {
+			os.Remove(backup)
+			continue
+		}
+		if f.maxAge > 0 {
+			if info, err := os.Stat(backup); err == nil && time.Since(info.ModTime()) > f.maxAge {
+				os.Remove(backup)
+			}
+		}
+	}
+}
+
+func (f *RotateFile) Close() error {
+	f.Lock()
+	defer f.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
@@ -0,0 +1,74 @@
+package tgo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDefaultLog_Level(t *testing.T) {
+	var buf bytes.Buffer
+	lg := NewDefaultLog(InfoLevel)
+	lg.SetWriters(&buf)
+	lg.Debug("debug %d", 1)
+	lg.Info("info %d", 2)
+	if strings.Contains(buf.String(), "debug") {
+		t.Fatal("Info级别不应该输出Debug日志！")
+	}
+	if !strings.Contains(buf.String(), "[Info]info 2") {
+		t.Fatalf("没有输出Info日志！%s", buf.String())
+	}
+	buf.Reset()
+	lg.SetLevel(DebugLevel)
+	logf(lg, DebugLevel, []Field{FieldClientID(1), F("reason", "a b")}, "debug")
+	if !strings.HasSuffix(buf.String(), "[Debug]debug client_id=1 reason=\"a b\"\n") {
+		t.Fatalf("文本格式不正确！%s", buf.String())
+	}
+}
+
+func TestJSONLogEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	lg := NewDefaultLog(DebugLevel)
+	lg.SetWriters(&buf)
+	lg.SetEncoder(&JSONLogEncoder{})
+	lg.Log(WarnLevel, "失败", FieldChannelID(2), F("err", errors.New("timeout")))
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["level"] != "warn" || entry["msg"] != "失败" || entry["channel_id"] != float64(2) || entry["err"] != "timeout" {
+		t.Fatalf("JSON格式不正确！%s", buf.String())
+	}
+}
+
+func TestRotateFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tgo-log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "tgo.log")
+	f, err := NewRotateFile(path, 10, 0, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		f.Write([]byte("0123456789"))
+		time.Sleep(2 * time.Millisecond) // 轮转文件名精确到毫秒
+	}
+	f.Close()
+	backups, _ := filepath.Glob(path + ".*")
+	if len(backups) != 2 {
+		t.Fatalf("应该保留2个轮转文件，实际为%d个", len(backups))
+	}
+	data, _ := ioutil.ReadFile(path)
+	if string(data) != "0123456789" {
+		t.Fatalf("当前文件内容不正确！%s", data)
+	}
+}
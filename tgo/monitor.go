@@ -1,5 +1,124 @@
 package tgo
 
+import (
+	"github.com/tgo-team/tgo-core/tgo/packets"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Labels 指标的标签
+type Labels map[string]string
+
 type Monitor interface {
-	Counter(flag string,inc int64)
+	// Counter 计数（没有标签的计数器）
+	Counter(flag string, inc int64)
+	// AddCounter 计数器增加inc（inc不能为负数）
+	AddCounter(name string, labels Labels, inc float64)
+	// SetGauge 设置仪表盘的值
+	SetGauge(name string, labels Labels, value float64)
+	// AddGauge 仪表盘的值增加delta（可以为负数）
+	AddGauge(name string, labels Labels, delta float64)
+	// Observe 直方图记录一次观测值
+	Observe(name string, labels Labels, value float64)
+}
+
+// core的指标
+const (
+	metricConnections       = "tgo_connections"              // 在线连接数量
+	metricPacketsReceived   = "tgo_packets_received_total"   // 收到的包数量 标签type
+	metricDecodeErrors      = "tgo_decode_errors_total"      // 解码包失败数量
+	metricMessagesStored    = "tgo_messages_stored_total"    // 存储成功的消息数量 标签channel_type
+	metricMessagesDelivered = "tgo_messages_delivered_total" // 写入连接的消息数量
+	metricDeliveryErrors    = "tgo_delivery_errors_total"    // 写入连接失败的消息数量
+	metricDeliveryLatency   = "tgo_delivery_latency_seconds" // 消息从产生到写入连接的延迟
+	metricStorageLatency    = "tgo_storage_latency_seconds"  // 存储操作的延迟 标签op
+	metricChannels          = "tgo_channels"                 // 已加载的管道数量
+	metricChannelsCreated   = "tgo_channels_created_total"   // 创建的管道数量
+	metricChannelsEvicted   = "tgo_channels_evicted_total"   // 被淘汰的管道数量
+	metricChannelQueueDepth = "tgo_channel_queue_depth"      // 所有管道待投递的消息数量
+	metricAcceptQueueDepth  = "tgo_accept_queue_depth"       // 待处理的包数量
+	metricHandlerPanics     = "tgo_handler_panics_total"     // 处理发生panic的次数
+	metricPacketsDropped    = "tgo_packets_dropped_total"    // 超过限制被丢弃的包数量 标签reason
+)
+
+// packetTypeName 包类型的名字（用作标签）
+func packetTypeName(packetType packets.PacketType) string {
+	name, ok := packets.PacketNames[uint8(packetType)]
+	if !ok {
+		return strconv.Itoa(int(packetType))
+	}
+	return strings.ToLower(name)
+}
+
+// channelTypeName 管道类型的名字（用作标签）
+func channelTypeName(channel Channel) string {
+	switch channel.Model().ChannelType {
+	case ChannelTypePerson:
+		return "person"
+	case ChannelTypeGroup:
+		return "group"
+	case ChannelTypeBroadcast:
+		return "broadcast"
+	case ChannelTypeTopic:
+		return "topic"
+	}
+	return strconv.Itoa(channel.Model().ChannelType)
+}
+
+// monitorCounter 计数器增加inc（没有配置Monitor则忽略）
+func (t *TGO) monitorCounter(name string, labels Labels, inc float64) {
+	monitor := t.GetOpts().Monitor
+	if monitor != nil {
+		monitor.AddCounter(name, labels, inc)
+	}
+}
+
+// monitorGauge 设置仪表盘的值（没有配置Monitor则忽略）
+func (t *TGO) monitorGauge(name string, labels Labels, value float64) {
+	monitor := t.GetOpts().Monitor
+	if monitor != nil {
+		monitor.SetGauge(name, labels, value)
+	}
+}
+
+// monitorGaugeAdd 仪表盘的值增加delta（没有配置Monitor则忽略）
+func (t *TGO) monitorGaugeAdd(name string, labels Labels, delta float64) {
+	monitor := t.GetOpts().Monitor
+	if monitor != nil {
+		monitor.AddGauge(name, labels, delta)
+	}
+}
+
+// monitorObserve 直方图记录观测值（没有配置Monitor则忽略）
+func (t *TGO) monitorObserve(name string, labels Labels, value float64) {
+	monitor := t.GetOpts().Monitor
+	if monitor != nil {
+		monitor.Observe(name, labels, value)
+	}
+}
+
+// monitorStorage 记录存储操作[op]从start开始的延迟
+func (t *TGO) monitorStorage(op string, start time.Time) {
+	t.monitorObserve(metricStorageLatency, Labels{"op": op}, time.Since(start).Seconds())
+}
+
+// monitorLoop 定时采集队列深度等指标
+func (t *TGO) monitorLoop() {
+	interval := t.GetOpts().MonitorInterval
+	if interval <= 0 || t.GetOpts().Monitor == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.monitorGauge(metricChannels, nil, float64(t.ChannelCount()))
+			t.monitorGauge(metricChannelQueueDepth, nil, float64(t.channels.queueDepth()))
+			t.monitorGauge(metricAcceptQueueDepth, nil, float64(len(t.AcceptPacketChan)))
+		case <-t.exitChan:
+			return
+		}
+	}
 }
@@ -0,0 +1,218 @@
+package tgo
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets 直方图默认的桶（单位秒）
+var DefaultBuckets = []float64{.0005, .001, .005, .01, .05, .1, .5, 1, 5}
+
+const (
+	metricTypeCounter   = "counter"
+	metricTypeGauge     = "gauge"
+	metricTypeHistogram = "histogram"
+)
+
+// PrometheusMonitor 内置的Monitor实现，以Prometheus文本格式输出指标
+type PrometheusMonitor struct {
+	buckets  []float64
+	families map[string]*metricFamily
+	sync.Mutex
+}
+
+type metricFamily struct {
+	name    string
+	typ     string
+	metrics map[string]*metricValue // key为标签序列化后的字符串
+}
+
+type metricValue struct {
+	labels string
+	value  float64  // counter、gauge的值
+	counts []uint64 // histogram每个桶的数量（不累加）
+	sum    float64  // histogram观测值的总和
+	count  uint64   // histogram观测的次数
+}
+
+// NewPrometheusMonitor 创建Monitor buckets为空使用DefaultBuckets
+func NewPrometheusMonitor(buckets ...float64) *PrometheusMonitor {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	sorted := append([]float64{}, buckets...)
+	sort.Float64s(sorted)
+	return &PrometheusMonitor{
+		buckets:  sorted,
+		families: map[string]*metricFamily{},
+	}
+}
+
+func (p *PrometheusMonitor) Counter(flag string, inc int64) {
+	p.AddCounter(sanitizeMetricName(flag), nil, float64(inc))
+}
+
+func (p *PrometheusMonitor) AddCounter(name string, labels Labels, inc float64) {
+	if inc < 0 {
+		return
+	}
+	p.Lock()
+	p.metric(name, metricTypeCounter, labels).value += inc
+	p.Unlock()
+}
+
+func (p *PrometheusMonitor) SetGauge(name string, labels Labels, value float64) {
+	p.Lock()
+	p.metric(name, metricTypeGauge, labels).value = value
+	p.Unlock()
+}
+
+func (p *PrometheusMonitor) AddGauge(name string, labels Labels, delta float64) {
+	p.Lock()
+	p.metric(name, metricTypeGauge, labels).value += delta
+	p.Unlock()
+}
+
+func (p *PrometheusMonitor) Observe(name string, labels Labels, value float64) {
+	p.Lock()
+	defer p.Unlock()
+	mv := p.metric(name, metricTypeHistogram, labels)
+	if mv.counts == nil {
+		mv.counts = make([]uint64, len(p.buckets))
+	}
+	for i, bucket := range p.buckets {
+		if value <= bucket {
+			mv.counts[i]++
+			break
+		}
+	}
+	mv.sum += value
+	mv.count++
+}
+
+// metric 获取指标（调用方需持有锁） 同名指标类型以第一次使用的为准
+func (p *PrometheusMonitor) metric(name, typ string, labels Labels) *metricValue {
+	family := p.families[name]
+	if family == nil {
+		family = &metricFamily{name: name, typ: typ, metrics: map[string]*metricValue{}}
+		p.families[name] = family
+	}
+	key := formatLabels(labels)
+	mv := family.metrics[key]
+	if mv == nil {
+		mv = &metricValue{labels: key}
+		family.metrics[key] = mv
+	}
+	return mv
+}
+
+// Bytes 以Prometheus文本格式输出所有指标
+func (p *PrometheusMonitor) Bytes() []byte {
+	p.Lock()
+	defer p.Unlock()
+	names := make([]string, 0, len(p.families))
+	for name := range p.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		family := p.families[name]
+		fmt.Fprintf(&buf, "# TYPE %s %s\n", name, family.typ)
+		keys := make([]string, 0, len(family.metrics))
+		for key := range family.metrics {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			mv := family.metrics[key]
+			if family.typ != metricTypeHistogram {
+				fmt.Fprintf(&buf, "%s%s %s\n", name, wrapLabels(mv.labels), formatFloat(mv.value))
+				continue
+			}
+			var cumulative uint64
+			for i, bucket := range p.buckets {
+				if mv.counts != nil {
+					cumulative += mv.counts[i]
+				}
+				fmt.Fprintf(&buf, "%s_bucket%s %d\n", name, wrapLabels(joinLabels(mv.labels, "le=\""+formatFloat(bucket)+"\"")), cumulative)
+			}
+			fmt.Fprintf(&buf, "%s_bucket%s %d\n", name, wrapLabels(joinLabels(mv.labels, "le=\"+Inf\"")), mv.count)
+			fmt.Fprintf(&buf, "%s_sum%s %s\n", name, wrapLabels(mv.labels), formatFloat(mv.sum))
+			fmt.Fprintf(&buf, "%s_count%s %d\n", name, wrapLabels(mv.labels), mv.count)
+		}
+	}
+	return buf.Bytes()
+}
+
+// ServeHTTP 实现http.Handler 用于/metrics
+func (p *PrometheusMonitor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(p.Bytes())
+}
+
+// formatLabels 按标签名排序后序列化 例如: op="get",type="cmd"
+func formatLabels(labels Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", sanitizeMetricName(name), escapeLabelValue(labels[name])))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func joinLabels(labels, extra string) string {
+	if labels == "" {
+		return extra
+	}
+	return labels + "," + extra
+}
+
+func wrapLabels(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func escapeLabelValue(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, "\n", `\n`, -1)
+	return strings.Replace(value, `"`, `\"`, -1)
+}
+
+// sanitizeMetricName 将不合法的字符替换为下划线
+func sanitizeMetricName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == ':' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,70 @@
+package tgo
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPrometheusMonitor_Bytes(t *testing.T) {
+	monitor := NewPrometheusMonitor(0.1, 1)
+	monitor.AddCounter("tgo_packets_received_total", Labels{"type": "cmd"}, 2)
+	monitor.AddCounter("tgo_packets_received_total", Labels{"type": "connect"}, 1)
+	monitor.SetGauge("tgo_connections", nil, 3)
+	monitor.AddGauge("tgo_connections", nil, -1)
+	monitor.Observe("tgo_delivery_latency_seconds", nil, 0.05)
+	monitor.Observe("tgo_delivery_latency_seconds", nil, 0.5)
+	monitor.Observe("tgo_delivery_latency_seconds", nil, 2)
+	monitor.Counter("client.auth", 1)
+	monitor.SetGauge("tgo_escape", Labels{"v": "a\"b\\c\nd"}, 1)
+
+	expected := `# TYPE client_auth counter
+client_auth 1
+# TYPE tgo_connections gauge
+tgo_connections 2
+# TYPE tgo_delivery_latency_seconds histogram
+tgo_delivery_latency_seconds_bucket{le="0.1"} 1
+tgo_delivery_latency_seconds_bucket{le="1"} 2
+tgo_delivery_latency_seconds_bucket{le="+Inf"} 3
+tgo_delivery_latency_seconds_sum 2.55
+tgo_delivery_latency_seconds_count 3
+# TYPE tgo_escape gauge
+tgo_escape{v="a\"b\\c\nd"} 1
+# TYPE tgo_packets_received_total counter
+tgo_packets_received_total{type="cmd"} 2
+tgo_packets_received_total{type="connect"} 1
+`
+	if got := string(monitor.Bytes()); got != expected {
+		t.Errorf("输出不正确！\n%s", got)
+	}
+}
+
+func TestTGO_metricsHandler(t *testing.T) {
+	opts := NewOptions()
+	opts.AdminToken = "token"
+	tg := startTGO(opts)
+	defer tg.Stop()
+
+	tg.monitorCounter(metricDecodeErrors, nil, 1)
+
+	resp, err := http.Get("http://" + tg.HTTPAddr().String() + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("没有token应该返回401，实际为%d", resp.StatusCode)
+	}
+	req, _ := http.NewRequest("GET", "http://"+tg.HTTPAddr().String()+"/metrics", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if !strings.Contains(string(body), metricDecodeErrors+" 1\n") {
+		t.Errorf("没有输出指标！\n%s", body)
+	}
+}
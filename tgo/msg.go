@@ -11,25 +11,29 @@ import (
 // --------- message -------------
 
 type Msg struct {
-	MessageID uint64 // 消息唯一编号
-	From      uint64 // 发送者ID
-	Timestamp int64  // 消息时间 到毫秒
-	Payload   []byte // 消息内容
+	MessageID  uint64 // 消息唯一编号
+	From       uint64 // 发送者ID
+	Timestamp  int64  // 消息时间 到毫秒
+	Payload    []byte // 消息内容
+	Retain     bool   // 是否为保留消息（来自FixedHeader.Retain 不参与编码）
+	ReadFanout bool   // 群组消息是否使用读扩散（放入群组管道时确定，存储需要保存 不参与编码）
+	TraceID    uint64 // 消息处理链路的ID（不参与编码）
+	SpanID     uint64 // 消息链路根Span的ID（不参与编码）
 }
 
-func NewMsg(messageID uint64,from uint64, payload []byte) *Msg {
+func NewMsg(messageID uint64, from uint64, payload []byte) *Msg {
 
 	return &Msg{
-		From: from,
+		From:      from,
 		MessageID: messageID,
-		Timestamp:time.Now().UnixNano()/1000000,
+		Timestamp: time.Now().UnixNano() / 1000000,
 		Payload:   payload,
 	}
 }
 
 func (m *Msg) String() string {
 
-	return fmt.Sprintf("MessageID: %d From: %d Payload: %s",m.MessageID,m.From,string(m.Payload))
+	return fmt.Sprintf("MessageID: %d From: %d Payload: %s", m.MessageID, m.From, string(m.Payload))
 }
 
 func (m *Msg) MarshalBinary() (data []byte, err error) {
@@ -38,28 +42,32 @@ func (m *Msg) MarshalBinary() (data []byte, err error) {
 	body.Write(packets.EncodeUint64(m.MessageID))
 	body.Write(packets.EncodeUint64(uint64(m.Timestamp)))
 	body.Write(m.Payload)
-	return body.Bytes(),nil
+	return body.Bytes(), nil
 }
 
 func (m *Msg) UnmarshalBinary(data []byte) error {
 	m.From = binary.BigEndian.Uint64(data[:8])
 	m.MessageID = binary.BigEndian.Uint64(data[8:16])
-	m.Timestamp = int64( binary.BigEndian.Uint64(data[16:24]))
+	m.Timestamp = int64(binary.BigEndian.Uint64(data[16:24]))
 	m.Payload = data[24:]
 	return nil
 }
 
-
-
 // -------- MsgContext ------------
 type MsgContext struct {
-	msg *Msg
+	msg       *Msg
 	channelID uint64
+	traceID   uint64 // 消息处理链路的ID
+	spanID    uint64
 }
 
-func NewMsgContext(msg *Msg,channelID uint64) *MsgContext {
+func NewMsgContext(msg *Msg, channelID uint64) *MsgContext {
 
-	return &MsgContext{msg:msg,channelID:channelID}
+	return &MsgContext{msg: msg, channelID: channelID, traceID: msg.TraceID, spanID: msg.SpanID}
+}
+
+func (mc *MsgContext) TraceID() uint64 {
+	return mc.traceID
 }
 
 func (mc *MsgContext) Msg() *Msg {
@@ -69,4 +77,3 @@ func (mc *MsgContext) Msg() *Msg {
 func (mc *MsgContext) ChannelID() uint64 {
 	return mc.channelID
 }
-
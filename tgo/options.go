@@ -1,69 +1,86 @@
 package tgo
 
 import (
-	"fmt"
 	"time"
 )
 
 type Options struct {
-	LogLevel             LogLevel
-	Log                  Log
-	Monitor              Monitor
-	LogPrefix            string
-	Verbose              bool
-	TCPAddress           string
-	UDPAddress           string
-	HTTPAddress          string
-	HTTPSAddress         string
-	MaxHeartbeatInterval time.Duration
-	DataPath             string
-	MaxMsgSize           int32
-	MaxBytesPerFile      int64         // 每个文件数据文件最多保存多大的数据 单位byte
-	SyncEvery            int64         // 内存队列每满多少消息就同步一次
-	SyncTimeout          time.Duration // 超过超时时间没同步就持久化一次
-	Pro                  Protocol      // 协议
-	MemQueueSize         int64         // 内存队列的chan大小，值表示内存中能堆积多少条消息
-	MsgTimeout           time.Duration // 消息发送超时时间
-	TestOn               bool          // 是否开启测试模式
+	LogLevel                 LogLevel
+	Log                      Log
+	Monitor                  Monitor
+	LogPrefix                string
+	Verbose                  bool
+	TCPAddress               string
+	UDPAddress               string
+	WebSocketAddress         string
+	HTTPAddress              string
+	HTTPSAddress             string
+	MaxHeartbeatInterval     time.Duration
+	DataPath                 string
+	MaxMsgSize               int32
+	MaxBytesPerFile          int64         // 每个文件数据文件最多保存多大的数据 单位byte
+	SyncEvery                int64         // 内存队列每满多少消息就同步一次
+	SyncTimeout              time.Duration // 超过超时时间没同步就持久化一次
+	Pro                      Protocol      // 协议
+	MemQueueSize             int64         // 内存队列的chan大小，值表示内存中能堆积多少条消息
+	MsgTimeout               time.Duration // 消息发送（写入连接）的超时时间 0表示不超时
+	HandlerTimeout           time.Duration // 处理一个包的超时时间（MContext的deadline）
+	TestOn                   bool          // 是否开启测试模式
+	MaxChannelNum            int           // 内存中最多缓存多少个管道（LRU淘汰） 0表示不限制
+	ChannelIdleTimeout       time.Duration // 管道空闲（没有使用、没有在线成员并且投递队列为空）超过此时间将被淘汰 0表示不淘汰
+	ChannelScanInterval      time.Duration // 扫描空闲管道的时间间隔
+	GroupReadFanoutThreshold int           // 群组成员数量达到此值使用读扩散（FanoutModeAuto的群组） 0表示不自动使用读扩散（读扩散需要存储实现CursorStorage，集群模式下不使用）
+	MonitorInterval          time.Duration // 采集队列深度等指标的时间间隔 0表示不采集
+	TraceExporter            TraceExporter // 消息处理链路的导出 为空时使用内置的RingTraceExporter
+	TraceBufferSize          int           // 内置RingTraceExporter保存的Span数量 0表示不开启链路追踪
+	LogFormat                string        // 默认日志的格式 text或json
+	LogFile                  string        // 默认日志的文件名（位于DataPath/logs下） 为空表示只输出到标准输出
+	LogMaxSize               int64         // 日志文件超过此大小轮转 单位byte 0表示不按大小轮转
+	LogRotateInterval        time.Duration // 日志文件按时间轮转的间隔 0表示不按时间轮转
+	LogMaxBackups            int           // 最多保留的轮转日志文件数量 0表示不限制
+	LogMaxAge                time.Duration // 轮转日志文件最多保留多久 0表示不限制
+	MaxPacketRate            int           // 每个连接每秒最多处理多少个包 超过的包会被丢弃 0表示不限制
+	AdminToken               string        // 管理接口（/admin、/metrics、/debug/traces）的token 为空表示不开启管理接口
+	ClusterAddress           string        // 集群节点之间通信的监听地址 为空表示不开启集群
+	ClusterAdvertiseAddress  string        // 其他节点连接本节点使用的地址（同时作为节点ID） 为空时使用实际监听的地址
+	ClusterSeeds             string        // 逗号分隔的节点地址 启动时连接这些节点
+	ClusterGossipInterval    time.Duration // 与其他节点交换成员列表的间隔 0表示不交换（静态成员，只连接ClusterSeeds中的节点和连接过来的节点）
+	ClusterTimeout           time.Duration // 连接节点和等待转发回复的超时时间
+	ClusterToken             string        // 节点之间握手时校验的共享密钥 开启集群时不能为空
 }
 
 func NewOptions() *Options {
 
 	return &Options{
-		MaxBytesPerFile:      100 * 1024 * 1024,
-		MsgTimeout:           60 * time.Second,
-		MaxMsgSize:           1024 * 1024,
-		Log:                  &DefaultLog{},
-		MemQueueSize:         10000,
-		SyncEvery:            2500,
-		SyncTimeout:          2 * time.Second,
-		LogPrefix:            "[tgo-server] ",
-		LogLevel:             DebugLevel,
-		TCPAddress:           "0.0.0.0:6666",
-		UDPAddress:           "0.0.0.0:5555",
-		HTTPAddress:          "0.0.0.0:4444",
-		HTTPSAddress:         "0.0.0.0:4433",
-		MaxHeartbeatInterval: 60 * time.Second,
-		TestOn:               false,
-		Pro:                  NewProtocol("mqtt-im"),
+		MaxBytesPerFile:          100 * 1024 * 1024,
+		MsgTimeout:               60 * time.Second,
+		HandlerTimeout:           30 * time.Second,
+		MaxMsgSize:               1024 * 1024,
+		Log:                      NewDefaultLog(DebugLevel),
+		MemQueueSize:             10000,
+		SyncEvery:                2500,
+		SyncTimeout:              2 * time.Second,
+		LogPrefix:                "[tgo-server] ",
+		LogLevel:                 DebugLevel,
+		TCPAddress:               "0.0.0.0:6666",
+		UDPAddress:               "0.0.0.0:5555",
+		WebSocketAddress:         "0.0.0.0:6677",
+		HTTPAddress:              "0.0.0.0:4444",
+		HTTPSAddress:             "0.0.0.0:4433",
+		MaxHeartbeatInterval:     60 * time.Second,
+		TestOn:                   false,
+		MaxChannelNum:            100000,
+		ChannelIdleTimeout:       10 * time.Minute,
+		ChannelScanInterval:      time.Minute,
+		GroupReadFanoutThreshold: 0,
+		MonitorInterval:          10 * time.Second,
+		TraceBufferSize:          10000,
+		LogFormat:                LogFormatText,
+		LogMaxSize:               100 * 1024 * 1024,
+		LogRotateInterval:        24 * time.Hour,
+		LogMaxBackups:            7,
+		ClusterGossipInterval:    time.Second,
+		ClusterTimeout:           5 * time.Second,
+		Pro:                      NewProtocol("mqtt-im"),
 	}
 }
-
-type DefaultLog struct {
-}
-
-func (lg *DefaultLog) Info(format string, a ...interface{}) {
-	fmt.Println(fmt.Sprintf(fmt.Sprintf("[Info]%s", format), a...))
-}
-func (lg *DefaultLog) Error(format string, a ...interface{}) {
-	fmt.Println(fmt.Sprintf(fmt.Sprintf("[Error]%s", format), a...))
-}
-func (lg *DefaultLog) Debug(format string, a ...interface{}) {
-	fmt.Println(fmt.Sprintf(fmt.Sprintf("[Debug]%s", format), a...))
-}
-func (lg *DefaultLog) Warn(format string, a ...interface{}) {
-	fmt.Println(fmt.Sprintf(fmt.Sprintf("[Warn]%s", format), a...))
-}
-func (lg *DefaultLog) Fatal(format string, a ...interface{}) {
-	fmt.Println(fmt.Sprintf(fmt.Sprintf("[Fatal]%s", format), a...))
-}
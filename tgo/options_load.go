@@ -0,0 +1,377 @@
+package tgo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	EnvPrefix      = "TGO_"     // 环境变量的前缀 例如: TGO_TCP_ADDRESS
+	optionProtocol = "protocol" // 协议名（通过NewProtocol创建Options.Pro）
+)
+
+// OptionError 配置错误 Field为配置名 例如: max_msg_size
+type OptionError struct {
+	Field string
+	Err   error
+}
+
+func (e *OptionError) Error() string {
+	return fmt.Sprintf("配置[%s]不正确！-> %v", e.Field, e.Err)
+}
+
+// LoadOptions 加载配置 先使用默认配置，再读取配置文件（path为空则不读取），最后使用环境变量覆盖，加载后进行校验
+// 配置文件中不支持的配置返回错误，不支持的环境变量忽略
+// 配置文件通过扩展名区分格式: .json .yaml/.yml .toml（yaml和toml只支持一层的 键: 值 / 键 = 值）
+// 配置名为Options字段名的下划线形式 例如: tcp_address、max_heartbeat_interval，时间使用 10s、1m 这样的格式
+func LoadOptions(path string) (*Options, error) {
+	opts := NewOptions()
+	if path != "" {
+		values, err := readOptionFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err = opts.apply(values); err != nil {
+			return nil, err
+		}
+	}
+	if err := opts.apply(envOptionValues(os.Environ())); err != nil {
+		return nil, err
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// readOptionFile 读取配置文件为 配置名 -> 值
+func readOptionFile(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return parseJSONOptions(data)
+	case ".yaml", ".yml":
+		return parseFlatOptions(data, ":")
+	case ".toml":
+		return parseFlatOptions(data, "=")
+	}
+	return nil, fmt.Errorf("不支持的配置文件格式[%s]！", filepath.Ext(path))
+}
+
+func parseJSONOptions(data []byte) (map[string]string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var raw map[string]interface{}
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, err
+	}
+	values := make(map[string]string, len(raw))
+	for key, value := range raw {
+		switch v := value.(type) {
+		case string:
+			values[key] = v
+		case json.Number, bool:
+			values[key] = fmt.Sprint(v)
+		default:
+			return nil, &OptionError{Field: key, Err: fmt.Errorf("只支持字符串、数字和布尔值")}
+		}
+	}
+	return values, nil
+}
+
+// parseFlatOptions 解析一层的 键<sep>值 格式（yaml、toml的子集） #开头为注释
+func parseFlatOptions(data []byte, sep string) (map[string]string, error) {
+	values := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || line == "---" {
+			continue
+		}
+		index := strings.Index(line, sep)
+		if index <= 0 {
+			return nil, fmt.Errorf("配置文件第%d行格式不正确！-> %s", lineNum, line)
+		}
+		key := strings.TrimSpace(line[:index])
+		value := stripComment(strings.TrimSpace(line[index+len(sep):]))
+		if value == "" {
+			return nil, &OptionError{Field: key, Err: fmt.Errorf("第%d行没有值（不支持嵌套）", lineNum)}
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+			value = value[1 : len(value)-1]
+		}
+		values[key] = value
+	}
+	return values, scanner.Err()
+}
+
+// stripComment 去掉值后面的注释（引号内的#保留）
+func stripComment(value string) string {
+	inQuote := rune(0)
+	for i, r := range value {
+		switch {
+		case inQuote != 0:
+			if r == inQuote {
+				inQuote = 0
+			}
+		case r == '"' || r == '\'':
+			inQuote = r
+		case r == '#':
+			return strings.TrimSpace(value[:i])
+		}
+	}
+	return value
+}
+
+// envOptionValues 获取TGO_开头的环境变量 不是配置的环境变量（例如: TGO_HOME）忽略
+func envOptionValues(environ []string) map[string]string {
+	fields := optionFields()
+	values := map[string]string{}
+	for _, env := range environ {
+		if !strings.HasPrefix(env, EnvPrefix) {
+			continue
+		}
+		kv := strings.SplitN(env, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key := strings.ToLower(kv[0][len(EnvPrefix):])
+		normalized := normalizeOptionName(key)
+		if _, ok := fields[normalized]; !ok && normalized != normalizeOptionName(optionProtocol) {
+			continue
+		}
+		values[key] = kv[1]
+	}
+	return values
+}
+
+// apply 设置配置 配置名不区分大小写和下划线
+func (o *Options) apply(values map[string]string) error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fields := optionFields()
+	v := reflect.ValueOf(o).Elem()
+	for _, key := range keys {
+		value := values[key]
+		normalized := normalizeOptionName(key)
+		if normalized == normalizeOptionName(optionProtocol) {
+			pro := NewProtocol(value)
+			if pro == nil {
+				return &OptionError{Field: optionProtocol, Err: fmt.Errorf("协议[%s]没有登记", value)}
+			}
+			o.Pro = pro
+			continue
+		}
+		field, ok := fields[normalized]
+		if !ok {
+			return &OptionError{Field: key, Err: fmt.Errorf("不支持的配置")}
+		}
+		if err := setOptionValue(v.FieldByIndex(field.Index), value); err != nil {
+			return &OptionError{Field: optionName(field.Name), Err: err}
+		}
+	}
+	return nil
+}
+
+// Set 按配置名设置一个配置 例如: opts.Set("tcp_address", "0.0.0.0:6666")（用于命令行参数）
+func (o *Options) Set(name, value string) error {
+	return o.apply(map[string]string{name: value})
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	logLevelType = reflect.TypeOf(LogLevel(0))
+)
+
+// optionFields 可以通过配置设置的字段（接口类型的字段除外）
+func optionFields() map[string]reflect.StructField {
+	fields := map[string]reflect.StructField{}
+	t := reflect.TypeOf(Options{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Type.Kind() == reflect.Interface {
+			continue
+		}
+		fields[normalizeOptionName(field.Name)] = field
+	}
+	return fields
+}
+
+func setOptionValue(field reflect.Value, value string) error {
+	switch field.Type() {
+	case durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	case logLevelType:
+		level, err := ParseLogLevel(value)
+		if err != nil {
+			return err
+		}
+		field.SetUint(uint64(level))
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(i)
+	case reflect.Uint, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(u)
+	default:
+		return fmt.Errorf("不支持的类型[%s]", field.Type())
+	}
+	return nil
+}
+
+// normalizeOptionName 配置名转小写并去掉下划线和中划线 例如: tcp_address、TCPAddress 都为 tcpaddress
+func normalizeOptionName(name string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(name))
+}
+
+// optionName 字段名转为配置名 例如: TCPAddress -> tcp_address
+func optionName(fieldName string) string {
+	runes := []rune(fieldName)
+	var buf bytes.Buffer
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				buf.WriteByte('_')
+			}
+		}
+		buf.WriteRune(unicode.ToLower(r))
+	}
+	return buf.String()
+}
+
+// Validate 校验配置 错误为*OptionError
+func (o *Options) Validate() error {
+	addresses := map[string]string{
+		"tcp_address":               o.TCPAddress,
+		"udp_address":               o.UDPAddress,
+		"web_socket_address":        o.WebSocketAddress,
+		"http_address":              o.HTTPAddress,
+		"https_address":             o.HTTPSAddress,
+		"cluster_address":           o.ClusterAddress,
+		"cluster_advertise_address": o.ClusterAdvertiseAddress,
+	}
+	for name, address := range addresses {
+		if address == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return &OptionError{Field: name, Err: err}
+		}
+	}
+	if o.LogLevel > TraceLevel {
+		return &OptionError{Field: "log_level", Err: fmt.Errorf("不支持的日志级别[%d]", o.LogLevel)}
+	}
+	if o.LogFormat != "" && o.LogFormat != LogFormatText && o.LogFormat != LogFormatJSON {
+		return &OptionError{Field: "log_format", Err: fmt.Errorf("只支持%s或%s", LogFormatText, LogFormatJSON)}
+	}
+	if o.MaxHeartbeatInterval <= 0 {
+		return &OptionError{Field: "max_heartbeat_interval", Err: fmt.Errorf("必须大于0")}
+	}
+	if o.MaxMsgSize <= 0 {
+		return &OptionError{Field: "max_msg_size", Err: fmt.Errorf("必须大于0")}
+	}
+	nonNegatives := map[string]int64{
+		"max_bytes_per_file":          o.MaxBytesPerFile,
+		"sync_every":                  o.SyncEvery,
+		"sync_timeout":                int64(o.SyncTimeout),
+		"mem_queue_size":              o.MemQueueSize,
+		"msg_timeout":                 int64(o.MsgTimeout),
+		"handler_timeout":             int64(o.HandlerTimeout),
+		"max_channel_num":             int64(o.MaxChannelNum),
+		"channel_idle_timeout":        int64(o.ChannelIdleTimeout),
+		"channel_scan_interval":       int64(o.ChannelScanInterval),
+		"group_read_fanout_threshold": int64(o.GroupReadFanoutThreshold),
+		"monitor_interval":            int64(o.MonitorInterval),
+		"trace_buffer_size":           int64(o.TraceBufferSize),
+		"log_max_size":                o.LogMaxSize,
+		"log_rotate_interval":         int64(o.LogRotateInterval),
+		"log_max_backups":             int64(o.LogMaxBackups),
+		"log_max_age":                 int64(o.LogMaxAge),
+		"max_packet_rate":             int64(o.MaxPacketRate),
+		"cluster_gossip_interval":     int64(o.ClusterGossipInterval),
+		"cluster_timeout":             int64(o.ClusterTimeout),
+	}
+	names := make([]string, 0, len(nonNegatives))
+	for name := range nonNegatives {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if nonNegatives[name] < 0 {
+			return &OptionError{Field: name, Err: fmt.Errorf("不能为负数")}
+		}
+	}
+	return nil
+}
+
+// Dump 输出生效的配置 每行一个 例如: tcp_address = 0.0.0.0:6666（token类的配置只输出******）
+func (o *Options) Dump() string {
+	v := reflect.ValueOf(o).Elem()
+	t := v.Type()
+	var buf bytes.Buffer
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		value := v.Field(i)
+		var str string
+		if field.Type.Kind() == reflect.Interface {
+			if value.IsNil() {
+				str = "<nil>"
+			} else {
+				str = fmt.Sprintf("%T", value.Interface())
+			}
+		} else if strings.HasSuffix(field.Name, "Token") && value.String() != "" { // 不输出密钥
+			str = "******"
+		} else {
+			str = fmt.Sprint(value.Interface())
+		}
+		fmt.Fprintf(&buf, "%s = %s\n", optionName(field.Name), str)
+	}
+	return buf.String()
+}
@@ -0,0 +1,96 @@
+package tgo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeOptionFile(t *testing.T, name, content string) string {
+	dir, err := ioutil.TempDir("", "tgo-options")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err = ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadOptions(t *testing.T) {
+	files := map[string]string{
+		"tgo.json": `{"tcp_address": "127.0.0.1:7777", "max_heartbeat_interval": "30s", "max_msg_size": 2048, "test_on": true, "log_level": "info"}`,
+		"tgo.yaml": "# tgo\ntcp_address: \"127.0.0.1:7777\"\nmax_heartbeat_interval: 30s # 心跳\nmax_msg_size: 2048\ntest_on: true\nlog_level: info\n",
+		"tgo.toml": "tcp_address = \"127.0.0.1:7777\"\nmax_heartbeat_interval = \"30s\"\nmax_msg_size = 2048\ntest_on = true\nlog_level = \"info\"\n",
+	}
+	for name, content := range files {
+		path := writeOptionFile(t, name, content)
+		defer os.RemoveAll(filepath.Dir(path))
+		opts, err := LoadOptions(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if opts.TCPAddress != "127.0.0.1:7777" || opts.MaxHeartbeatInterval != 30*time.Second || opts.MaxMsgSize != 2048 || !opts.TestOn || opts.LogLevel != InfoLevel {
+			t.Fatalf("%s: 配置加载不正确！\n%s", name, opts.Dump())
+		}
+		if opts.UDPAddress != NewOptions().UDPAddress {
+			t.Fatalf("%s: 没有配置的字段应该使用默认值！", name)
+		}
+	}
+}
+
+func TestLoadOptions_env(t *testing.T) {
+	path := writeOptionFile(t, "tgo.yaml", "tcp_address: 127.0.0.1:7777\n")
+	defer os.RemoveAll(filepath.Dir(path))
+	os.Setenv("TGO_TCP_ADDRESS", "127.0.0.1:8888")
+	os.Setenv("TGO_DATA_PATH", "/tmp/tgo")
+	os.Setenv("TGO_HOME", "/opt/tgo")
+	defer os.Unsetenv("TGO_TCP_ADDRESS")
+	defer os.Unsetenv("TGO_DATA_PATH")
+	defer os.Unsetenv("TGO_HOME")
+	opts, err := LoadOptions(path)
+	if err != nil {
+		t.Fatalf("不是配置的环境变量应该忽略！-> %v", err)
+	}
+	if opts.TCPAddress != "127.0.0.1:8888" || opts.DataPath != "/tmp/tgo" {
+		t.Fatalf("环境变量应该覆盖配置文件！\n%s", opts.Dump())
+	}
+}
+
+func TestLoadOptions_invalid(t *testing.T) {
+	cases := map[string]string{
+		"max_msg_size: abc\n":          "max_msg_size",
+		"max_msg_size: -1\n":           "max_msg_size",
+		"tcp_address: 6666\n":          "tcp_address",
+		"unknown_field: 1\n":           "unknown_field",
+		"log_format: xml\n":            "log_format",
+		"msg_timeout: 10\n":            "msg_timeout",
+		"max_heartbeat_interval: 0s\n": "max_heartbeat_interval",
+	}
+	for content, field := range cases {
+		path := writeOptionFile(t, "tgo.yml", content)
+		defer os.RemoveAll(filepath.Dir(path))
+		_, err := LoadOptions(path)
+		optionErr, ok := err.(*OptionError)
+		if !ok || optionErr.Field != field {
+			t.Fatalf("[%s]应该返回配置[%s]的错误，实际为%v", content, field, err)
+		}
+	}
+}
+
+func TestOptionName(t *testing.T) {
+	names := map[string]string{
+		"TCPAddress":               "tcp_address",
+		"HTTPSAddress":             "https_address",
+		"MaxHeartbeatInterval":     "max_heartbeat_interval",
+		"GroupReadFanoutThreshold": "group_read_fanout_threshold",
+	}
+	for fieldName, name := range names {
+		if optionName(fieldName) != name {
+			t.Fatalf("%s应该为%s，实际为%s", fieldName, name, optionName(fieldName))
+		}
+	}
+}
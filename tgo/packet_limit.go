@@ -0,0 +1,55 @@
+package tgo
+
+import (
+	"time"
+
+	"github.com/tgo-team/tgo-core/tgo/packets"
+)
+
+// packetLimiter 限制每个连接每秒处理的包数量 只在msgLoop中使用（不需要锁）
+type packetLimiter struct {
+	windows map[Conn]*rateWindow
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+func newPacketLimiter() *packetLimiter {
+	return &packetLimiter{windows: map[Conn]*rateWindow{}}
+}
+
+// allow 连接在当前一秒内处理的包数量没有超过rate rate<=0表示不限制
+func (l *packetLimiter) allow(conn Conn, rate int, now time.Time) bool {
+	if rate <= 0 {
+		return true
+	}
+	window := l.windows[conn]
+	if window == nil || now.Sub(window.start) >= time.Second {
+		window = &rateWindow{start: now}
+		l.windows[conn] = window
+	}
+	window.count++
+	return window.count <= rate
+}
+
+func (l *packetLimiter) remove(conn Conn) {
+	delete(l.windows, conn)
+}
+
+// checkPacket 检查包是否超过限制（MaxPacketRate、MaxMsgSize） 超过限制的包会被丢弃
+func (t *TGO) checkPacket(packetContext *PacketContext) bool {
+	opts := t.GetOpts()
+	if !t.limiter.allow(packetContext.Conn, opts.MaxPacketRate, time.Now()) {
+		t.LogFields(WarnLevel, []Field{FieldRemoteAddr(packetContext.Conn)}, "包的速率超过限制[%d/s]，丢弃 -> %v", opts.MaxPacketRate, packetContext.Packet)
+		t.monitorCounter(metricPacketsDropped, Labels{"reason": "rate_limit"}, 1)
+		return false
+	}
+	if messagePacket, ok := packetContext.Packet.(*packets.MessagePacket); ok && opts.MaxMsgSize > 0 && len(messagePacket.Payload) > int(opts.MaxMsgSize) {
+		t.LogFields(WarnLevel, []Field{FieldRemoteAddr(packetContext.Conn), FieldMessageID(messagePacket.MessageID)}, "消息大小[%d]超过限制[%d]，丢弃！", len(messagePacket.Payload), opts.MaxMsgSize)
+		t.monitorCounter(metricPacketsDropped, Labels{"reason": "msg_size"}, 1)
+		return false
+	}
+	return true
+}
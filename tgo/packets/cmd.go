@@ -5,7 +5,8 @@ import "fmt"
 type CmdPacket struct {
 	FixedHeader
 	CMD       string
-	TokenFlag bool // token标识 true表示存在token false为不存在
+	RequestID uint64 // 请求编号 回复的Cmdack带上相同的请求编号，用于关联请求和回复（0表示不需要关联）
+	TokenFlag bool   // token标识 true表示存在token false为不存在
 	Token     string // token字符串
 	Payload   []byte // 消息内容
 }
@@ -29,6 +30,6 @@ func (c *CmdPacket) GetFixedHeader() FixedHeader {
 func (c *CmdPacket) String() string {
 	str := fmt.Sprintf("%s", c.FixedHeader)
 	str += " "
-	str += fmt.Sprintf("CMD: %s TokenFlag: %v Token: %v Payload:  %s", c.CMD,c.TokenFlag,c.Token, string(c.Payload))
+	str += fmt.Sprintf("CMD: %s RequestID: %d TokenFlag: %v Token: %v Payload:  %s", c.CMD, c.RequestID, c.TokenFlag, c.Token, string(c.Payload))
 	return str
 }
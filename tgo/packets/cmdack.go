@@ -2,11 +2,19 @@ package packets
 
 import "fmt"
 
+const (
+	CmdackStatusSuccess       uint16 = 200 // 成功
+	CmdackStatusBadRequest    uint16 = 400 // 请求错误
+	CmdackStatusNotFound      uint16 = 404 // 命令不存在
+	CmdackStatusInternalError uint16 = 500 // 服务器内部错误
+)
+
 type CmdackPacket struct {
 	FixedHeader
-	CMD     string  // 命令
-	Status  uint16 // 状态
-	Payload []byte // 消息内容
+	CMD       string // 命令
+	RequestID uint64 // 请求编号（与Cmd的请求编号相同）
+	Status    uint16 // 状态
+	Payload   []byte // 消息内容
 }
 
 func NewCmdackPacketWithHeader(fh FixedHeader) *CmdackPacket {
@@ -15,12 +23,11 @@ func NewCmdackPacketWithHeader(fh FixedHeader) *CmdackPacket {
 	return c
 }
 
-func NewCmdackPacket(cmd string,status uint16, payload []byte) *CmdackPacket {
+func NewCmdackPacket(cmd string, status uint16, payload []byte) *CmdackPacket {
 
-	return &CmdackPacket{CMD: cmd,Status:status, Payload: payload, FixedHeader: FixedHeader{PacketType: Cmdack}}
+	return &CmdackPacket{CMD: cmd, Status: status, Payload: payload, FixedHeader: FixedHeader{PacketType: Cmdack}}
 }
 
-
 func (c *CmdackPacket) GetFixedHeader() FixedHeader {
 
 	return c.FixedHeader
@@ -29,6 +36,6 @@ func (c *CmdackPacket) GetFixedHeader() FixedHeader {
 func (c *CmdackPacket) String() string {
 	str := fmt.Sprintf("%s", c.FixedHeader)
 	str += " "
-	str += fmt.Sprintf("CMD: %s Status: %d Payload:  %s", c.CMD, c.Status, string(c.Payload))
+	str += fmt.Sprintf("CMD: %s Status: %d RequestID: %d Payload:  %s", c.CMD, c.Status, c.RequestID, string(c.Payload))
 	return str
-}
\ No newline at end of file
+}
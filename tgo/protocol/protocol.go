@@ -0,0 +1,307 @@
+// Package protocol 内置的mqtt-im协议
+//
+// 包格式（类似MQTT）:
+//
+//	固定头: 1字节（高4位包类型 dup、qos、retain） + 剩余长度（MQTT变长编码，最多4字节）
+//	CONNECT:  ClientID(8) 标识(1) Keepalive(2) [Username] [Password]
+//	CONNACK:  ReturnCode(1)
+//	MESSAGE:  ChannelID(8) MessageID(8) From(8) Timestamp(8) Payload
+//	MSGACK:   MessageID(8)...
+//	PINGREQ、PINGRESP: 没有内容
+//	CMD:      CMD RequestID(8) TokenFlag(1) [Token] Payload
+//	CMDACK:   CMD RequestID(8) Status(2) Payload
+//
+// 字符串为2字节长度+内容，整数为大端。
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/tgo-team/tgo-core/tgo"
+	"github.com/tgo-team/tgo-core/tgo/packets"
+)
+
+// Name 协议名 Options.Pro默认使用此协议
+const Name = "mqtt-im"
+
+// MaxRemainingLength 剩余长度的最大值（4字节变长编码能表示的最大值）
+const MaxRemainingLength = 268435455
+
+var (
+	ErrRemainingLength = errors.New("剩余长度不合法！")
+	ErrPacketTooShort  = errors.New("包的数据不完整！")
+)
+
+func init() {
+	tgo.RegistryProtocol(Name, func() tgo.Protocol {
+		return New()
+	})
+}
+
+// MQTTIM mqtt-im协议的编解码
+type MQTTIM struct {
+}
+
+func New() *MQTTIM {
+	return &MQTTIM{}
+}
+
+// DecodePacket 从reader读取一个完整的包
+func (p *MQTTIM) DecodePacket(reader tgo.Conn) (packets.Packet, error) {
+	return Decode(reader)
+}
+
+func (p *MQTTIM) EncodePacket(packet packets.Packet) ([]byte, error) {
+	return Encode(packet)
+}
+
+// Decode 从reader读取一个完整的包
+func Decode(reader io.Reader) (packets.Packet, error) {
+	header := make([]byte, 1)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+	fh := packets.FixedHeader{
+		PacketType: packets.PacketType(header[0] >> 4),
+		Dup:        header[0]&0x08 > 0,
+		Qos:        (header[0] >> 1) & 0x03,
+		Retain:     header[0]&0x01 > 0,
+	}
+	remainingLength, err := decodeLength(reader)
+	if err != nil {
+		return nil, err
+	}
+	fh.RemainingLength = remainingLength
+	body := make([]byte, remainingLength)
+	if _, err = io.ReadFull(reader, body); err != nil {
+		return nil, err
+	}
+	return decodeBody(fh, &bodyReader{data: body})
+}
+
+func decodeBody(fh packets.FixedHeader, r *bodyReader) (packets.Packet, error) {
+	switch fh.PacketType {
+	case packets.Connect:
+		packet := packets.NewConnectPacketWithHeader(fh)
+		packet.ClientID = r.uint64()
+		flags := r.byte()
+		packet.UsernameFlag = flags&0x80 > 0
+		packet.PasswordFlag = flags&0x40 > 0
+		packet.Keepalive = r.uint16()
+		if packet.UsernameFlag {
+			packet.Username = r.string()
+		}
+		if packet.PasswordFlag {
+			packet.Password = r.string()
+		}
+		return packet, r.err
+	case packets.Connack:
+		packet := packets.NewConnackPacketWithHeader(fh)
+		packet.ReturnCode = packets.ConnReturnCode(r.byte())
+		return packet, r.err
+	case packets.Message:
+		packet := packets.NewMessagePacketHeader(fh)
+		packet.ChannelID = r.uint64()
+		packet.MessageID = r.uint64()
+		packet.From = r.uint64()
+		packet.Timestamp = int64(r.uint64())
+		packet.Payload = r.rest()
+		return packet, r.err
+	case packets.Msgack:
+		packet := packets.NewMsgackPacketWithHeader(fh)
+		for r.remaining() > 0 {
+			packet.MessageIDs = append(packet.MessageIDs, r.uint64())
+		}
+		return packet, r.err
+	case packets.Pingreq:
+		return packets.NewPingreqPacketWithHeader(fh), nil
+	case packets.Pingresp:
+		return packets.NewPingrespPacketWithHeader(fh), nil
+	case packets.Cmd:
+		packet := packets.NewCmdPacketWithHeader(fh)
+		packet.CMD = r.string()
+		packet.RequestID = r.uint64()
+		packet.TokenFlag = r.byte() > 0
+		if packet.TokenFlag {
+			packet.Token = r.string()
+		}
+		packet.Payload = r.rest()
+		return packet, r.err
+	case packets.Cmdack:
+		packet := packets.NewCmdackPacketWithHeader(fh)
+		packet.CMD = r.string()
+		packet.RequestID = r.uint64()
+		packet.Status = r.uint16()
+		packet.Payload = r.rest()
+		return packet, r.err
+	}
+	return nil, fmt.Errorf("不支持的包类型[%d]！", fh.PacketType)
+}
+
+// Encode 编码包
+func Encode(packet packets.Packet) ([]byte, error) {
+	var body bytes.Buffer
+	switch p := packet.(type) {
+	case *packets.ConnectPacket:
+		body.Write(packets.EncodeUint64(p.ClientID))
+		var flags byte
+		if p.UsernameFlag || p.Username != "" {
+			flags |= 0x80
+		}
+		if p.PasswordFlag || p.Password != "" {
+			flags |= 0x40
+		}
+		body.WriteByte(flags)
+		body.Write(packets.EncodeUint16(p.Keepalive))
+		if flags&0x80 > 0 {
+			body.Write(packets.EncodeString(p.Username))
+		}
+		if flags&0x40 > 0 {
+			body.Write(packets.EncodeString(p.Password))
+		}
+	case *packets.ConnackPacket:
+		body.WriteByte(byte(p.ReturnCode))
+	case *packets.MessagePacket:
+		body.Write(packets.EncodeUint64(p.ChannelID))
+		body.Write(packets.EncodeUint64(p.MessageID))
+		body.Write(packets.EncodeUint64(p.From))
+		body.Write(packets.EncodeUint64(uint64(p.Timestamp)))
+		body.Write(p.Payload)
+	case *packets.MsgackPacket:
+		for _, messageID := range p.MessageIDs {
+			body.Write(packets.EncodeUint64(messageID))
+		}
+	case *packets.PingreqPacket, *packets.PingrespPacket:
+	case *packets.CmdPacket:
+		body.Write(packets.EncodeString(p.CMD))
+		body.Write(packets.EncodeUint64(p.RequestID))
+		if p.TokenFlag || p.Token != "" {
+			body.WriteByte(1)
+			body.Write(packets.EncodeString(p.Token))
+		} else {
+			body.WriteByte(0)
+		}
+		body.Write(p.Payload)
+	case *packets.CmdackPacket:
+		body.Write(packets.EncodeString(p.CMD))
+		body.Write(packets.EncodeUint64(p.RequestID))
+		body.Write(packets.EncodeUint16(p.Status))
+		body.Write(p.Payload)
+	default:
+		return nil, fmt.Errorf("不支持编码的包[%T]！", packet)
+	}
+	if body.Len() > MaxRemainingLength {
+		return nil, ErrRemainingLength
+	}
+	fh := packet.GetFixedHeader()
+	header := byte(fh.PacketType)<<4 | (fh.Qos&0x03)<<1
+	if fh.Dup {
+		header |= 0x08
+	}
+	if fh.Retain {
+		header |= 0x01
+	}
+	data := make([]byte, 0, body.Len()+5)
+	data = append(data, header)
+	data = append(data, encodeLength(body.Len())...)
+	return append(data, body.Bytes()...), nil
+}
+
+// encodeLength MQTT的变长编码
+func encodeLength(length int) []byte {
+	var encoded []byte
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		encoded = append(encoded, digit)
+		if length == 0 {
+			return encoded
+		}
+	}
+}
+
+func decodeLength(reader io.Reader) (int, error) {
+	var length int
+	var multiplier = 1
+	b := make([]byte, 1)
+	for i := 0; i < 4; i++ {
+		if _, err := io.ReadFull(reader, b); err != nil {
+			return 0, err
+		}
+		length += int(b[0]&0x7f) * multiplier
+		if b[0]&0x80 == 0 {
+			return length, nil
+		}
+		multiplier *= 128
+	}
+	return 0, ErrRemainingLength
+}
+
+// bodyReader 读取包的内容 数据不够时记录错误并返回零值
+type bodyReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *bodyReader) remaining() int {
+	return len(r.data) - r.pos
+}
+
+func (r *bodyReader) next(n int) []byte {
+	if r.err != nil || r.remaining() < n {
+		r.err = ErrPacketTooShort
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *bodyReader) byte() byte {
+	b := r.next(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *bodyReader) uint16() uint16 {
+	b := r.next(2)
+	if b == nil {
+		return 0
+	}
+	return uint16(b[0])<<8 | uint16(b[1])
+}
+
+func (r *bodyReader) uint64() uint64 {
+	b := r.next(8)
+	if b == nil {
+		return 0
+	}
+	var n uint64
+	for _, v := range b {
+		n = n<<8 | uint64(v)
+	}
+	return n
+}
+
+func (r *bodyReader) string() string {
+	length := int(r.uint16())
+	return string(r.next(length))
+}
+
+func (r *bodyReader) rest() []byte {
+	if r.err != nil {
+		return nil
+	}
+	b := r.data[r.pos:]
+	r.pos = len(r.data)
+	return b
+}
@@ -0,0 +1,117 @@
+package protocol
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/tgo-team/tgo-core/tgo/packets"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	message := packets.NewMessagePacket(10, 20, []byte("hello"))
+	message.From = 30
+	message.Retain = true
+	cmd := packets.NewCmdPacket("topic/subscribe", []byte("a/b"))
+	cmd.RequestID = 5
+	cmd.TokenFlag = true
+	cmd.Token = "token"
+	cmdack := packets.NewCmdackPacket("topic/subscribe", packets.CmdackStatusSuccess, []byte("ok"))
+	cmdack.RequestID = 5
+	connect := packets.NewConnectPacket(100, "123456")
+	connect.PasswordFlag = true
+	connect.Keepalive = 60
+	list := []packets.Packet{
+		connect,
+		packets.NewConnackPacket(packets.ConnReturnCodeSuccess),
+		message,
+		packets.NewMsgackPacket([]uint64{1, 2, 3}),
+		packets.NewPingreqPacket(),
+		packets.NewPingrespPacket(),
+		cmd,
+		cmdack,
+	}
+	var buf bytes.Buffer
+	for _, packet := range list {
+		data, err := Encode(packet)
+		if err != nil {
+			t.Fatalf("编码[%v]失败！-> %v", packet, err)
+		}
+		buf.Write(data)
+	}
+	for _, packet := range list {
+		decoded, err := Decode(&buf)
+		if err != nil {
+			t.Fatalf("解码[%v]失败！-> %v", packet, err)
+		}
+		if decoded.GetFixedHeader().PacketType != packet.GetFixedHeader().PacketType {
+			t.Fatalf("包类型应该为%d，实际为%d", packet.GetFixedHeader().PacketType, decoded.GetFixedHeader().PacketType)
+		}
+		if !equalBody(packet, decoded) {
+			t.Fatalf("解码后的包不一致！-> %v != %v", packet, decoded)
+		}
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("还有%d字节没有解码", buf.Len())
+	}
+}
+
+// equalBody 比较FixedHeader以外的字段（解码后FixedHeader带有剩余长度）
+func equalBody(a, b packets.Packet) bool {
+	av := reflect.ValueOf(a).Elem()
+	bv := reflect.ValueOf(b).Elem()
+	for i := 0; i < av.NumField(); i++ {
+		if av.Type().Field(i).Name == "FixedHeader" {
+			continue
+		}
+		x, y := av.Field(i).Interface(), bv.Field(i).Interface()
+		if xb, ok := x.([]byte); ok && len(xb) == 0 && len(y.([]byte)) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(x, y) {
+			return false
+		}
+	}
+	return a.GetFixedHeader().Retain == b.GetFixedHeader().Retain
+}
+
+func TestEncodeLength(t *testing.T) {
+	for _, length := range []int{0, 127, 128, 16383, 16384, 2097151, 2097152, MaxRemainingLength} {
+		decoded, err := decodeLength(bytes.NewReader(encodeLength(length)))
+		if err != nil || decoded != length {
+			t.Fatalf("长度%d解码为%d -> %v", length, decoded, err)
+		}
+	}
+}
+
+func benchmarkMessagePacket() *packets.MessagePacket {
+	message := packets.NewMessagePacket(10, 20, bytes.Repeat([]byte("x"), 256))
+	message.From = 30
+	return message
+}
+
+func BenchmarkEncode(b *testing.B) {
+	message := benchmarkMessagePacket()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Encode(message); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	data, err := Encode(benchmarkMessagePacket())
+	if err != nil {
+		b.Fatal(err)
+	}
+	reader := bytes.NewReader(data)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		reader.Reset(data)
+		if _, err = Decode(reader); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
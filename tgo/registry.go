@@ -5,85 +5,137 @@ import (
 	"sync"
 )
 
-
-
 const (
-	newServerPrefix = "newServer:"
-	newRoutePrefix = "newRoute:"
-	newProtocolPrefix = "newProtocol:"
-	newLogPrefix = "newLog:"
-	newStoragePrefix = "newStorage:"
-	newAuthPrefix = "newAuth:"
+	newServerPrefix      = "newServer:"
+	newRoutePrefix       = "newRoute:"
+	newProtocolPrefix    = "newProtocol:"
+	newLogPrefix         = "newLog:"
+	newStoragePrefix     = "newStorage:"
+	newAuthPrefix        = "newAuth:"
+	newChannelTypePrefix = "newChannelType:"
 )
 
 var registryMap map[string]interface{}
-
+var registryLock sync.RWMutex // 保护registryMap
 
 type newServerFunc func(*Context) Server
 type newRouteFunc func(*Context) Route
 type newProtocol func() Protocol
 type newLog func(logLevel LogLevel) Log
 type newStorageFunc func(*Context) Storage
+type newChannelFunc func(model *ChannelModel, ctx *Context) Channel
 
 var clientLock sync.RWMutex
 var tContextLock sync.RWMutex
-type authFunc func(ctx *Context)
-func init()  {
+
+type newAuthFunc func(*Context) Authenticator
+
+func init() {
 	registryMap = map[string]interface{}{}
+
+	// 内置的管道类型
+	RegistryChannelType(ChannelTypePerson, func(model *ChannelModel, ctx *Context) Channel {
+		return NewPersonChannel(model.ChannelID, model, ctx)
+	})
+	RegistryChannelType(ChannelTypeGroup, func(model *ChannelModel, ctx *Context) Channel {
+		return NewGroupChannel(model.ChannelID, model, ctx)
+	})
+	RegistryChannelType(ChannelTypeBroadcast, func(model *ChannelModel, ctx *Context) Channel {
+		return NewBroadcastChannel(model.ChannelID, model, ctx)
+	})
+	RegistryChannelType(ChannelTypeTopic, func(model *ChannelModel, ctx *Context) Channel {
+		return NewTopicChannel(model.ChannelID, model, ctx)
+	})
 }
 
-// 登记server
-func RegistryServer(newFunc newServerFunc)  {
-	serverFuncObj := registryMap[fmt.Sprintf("%s",newServerPrefix)]
+// 登记server 全局登记的server会被所有没有通过Builder指定server的TGO使用
+func RegistryServer(newFunc newServerFunc) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	serverFuncObj := registryMap[fmt.Sprintf("%s", newServerPrefix)]
 	var serverFuncs []newServerFunc
-	if serverFuncObj==nil {
+	if serverFuncObj == nil {
 		serverFuncs = []newServerFunc{}
-	}else{
+	} else {
 		serverFuncs = serverFuncObj.([]newServerFunc)
 	}
-	serverFuncs = append(serverFuncs,newFunc)
-	registryMap[fmt.Sprintf("%s",newServerPrefix)] = serverFuncs
+	serverFuncs = append(serverFuncs, newFunc)
+	registryMap[fmt.Sprintf("%s", newServerPrefix)] = serverFuncs
 }
 
-
 // 登记协议
-func RegistryProtocol(name string,newFunc newProtocol)  {
-	registryMap[fmt.Sprintf("%s-%s",newProtocolPrefix,name)] = newFunc
+func RegistryProtocol(name string, newFunc newProtocol) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	registryMap[fmt.Sprintf("%s-%s", newProtocolPrefix, name)] = newFunc
+}
+
+func RegistryLog(newFunc newLog) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	registryMap[fmt.Sprintf("%s", newLogPrefix)] = newFunc
+}
+
+func RegistryStorage(newFunc newStorageFunc) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	registryMap[fmt.Sprintf("%s", newStoragePrefix)] = newFunc
+}
+
+// RegistryChannelType 登记管道类型 应用可以登记自己的管道类型（例如广播、客服队列、系统通知等） 重复登记同一类型会覆盖之前的
+func RegistryChannelType(typ int, newFunc newChannelFunc) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	registryMap[fmt.Sprintf("%s-%d", newChannelTypePrefix, typ)] = newFunc
 }
 
-func RegistryLog(newFunc newLog)  {
-	registryMap[fmt.Sprintf("%s",newLogPrefix)] = newFunc
+// RegistryAuth 登记认证
+func RegistryAuth(newFunc newAuthFunc) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	registryMap[fmt.Sprintf("%s", newAuthPrefix)] = newFunc
 }
 
-func RegistryStorage(newFunc newStorageFunc)  {
-	registryMap[fmt.Sprintf("%s",newStoragePrefix)] = newFunc
+// UnregistryServers 清除全局登记的server
+func UnregistryServers() {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	delete(registryMap, fmt.Sprintf("%s", newServerPrefix))
+}
+
+// NewChannelByType 通过管道类型创建管道 类型没有登记返回nil
+func NewChannelByType(model *ChannelModel, ctx *Context) Channel {
+	key := fmt.Sprintf("%s-%d", newChannelTypePrefix, model.ChannelType)
+	funcObj := getRegistry(key)
+	if funcObj != nil {
+		return funcObj.(newChannelFunc)(model, ctx)
+	}
+	return nil
 }
 
 func NewStorage(context *Context) Storage {
-	key := fmt.Sprintf("%s",newStoragePrefix)
-	serverFuncObj := registryMap[key]
-	if serverFuncObj!=nil {
-		return  serverFuncObj.(newStorageFunc)(context)
+	key := fmt.Sprintf("%s", newStoragePrefix)
+	serverFuncObj := getRegistry(key)
+	if serverFuncObj != nil {
+		return serverFuncObj.(newStorageFunc)(context)
 	}
 	return nil
 }
 
-func GetServers(context *Context) []Server  {
-	key := fmt.Sprintf("%s",newServerPrefix)
-	serverFuncObj := registryMap[key]
-	servers := make([]Server,0)
-	if serverFuncObj!=nil {
+func GetServers(context *Context) []Server {
+	key := fmt.Sprintf("%s", newServerPrefix)
+	serverFuncObj := getRegistry(key)
+	servers := make([]Server, 0)
+	if serverFuncObj != nil {
 		serverFuncs := serverFuncObj.([]newServerFunc)
-		for _,serverFunc :=range serverFuncs {
-			servers = append(servers,serverFunc(context))
+		for _, serverFunc := range serverFuncs {
+			servers = append(servers, serverFunc(context))
 		}
-		return  servers
+		return servers
 	}
 	return nil
 }
 
-
-
 //func NewRoute(ctx *Context) Route  {
 //	key := fmt.Sprintf("%s",newRoutePrefix)
 //	funcObj := registryMap[key]
@@ -93,20 +145,35 @@ func GetServers(context *Context) []Server  {
 //	return nil
 //}
 
-func NewProtocol(name string) Protocol  {
-	key := fmt.Sprintf("%s-%s",newProtocolPrefix,name)
-	funcObj := registryMap[key]
-	if funcObj!=nil {
-		return  funcObj.(newProtocol)()
+func NewProtocol(name string) Protocol {
+	key := fmt.Sprintf("%s-%s", newProtocolPrefix, name)
+	funcObj := getRegistry(key)
+	if funcObj != nil {
+		return funcObj.(newProtocol)()
 	}
 	return nil
 }
 
-func NewLog(logLevel LogLevel) Log  {
-	key := fmt.Sprintf("%s",newLogPrefix)
-	funcObj := registryMap[key]
-	if funcObj!=nil {
-		return  funcObj.(newLog)(logLevel)
+func NewLog(logLevel LogLevel) Log {
+	key := fmt.Sprintf("%s", newLogPrefix)
+	funcObj := getRegistry(key)
+	if funcObj != nil {
+		return funcObj.(newLog)(logLevel)
 	}
 	return nil
 }
+
+// NewAuth 创建登记的认证 没有登记返回nil
+func NewAuth(context *Context) Authenticator {
+	funcObj := getRegistry(fmt.Sprintf("%s", newAuthPrefix))
+	if funcObj != nil {
+		return funcObj.(newAuthFunc)(context)
+	}
+	return nil
+}
+
+func getRegistry(key string) interface{} {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	return registryMap[key]
+}
@@ -0,0 +1,142 @@
+package tgo
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
+)
+
+var errOptionNotReloadable = errors.New("不支持运行时修改，需要重启")
+
+// reloadableOptions 可以在运行时修改的配置（Options的字段名）
+var reloadableOptions = []string{
+	"LogLevel",
+	"MaxHeartbeatInterval",
+	"MsgTimeout",
+	"HandlerTimeout",
+	"MaxPacketRate",
+	"MaxMsgSize",
+	"AdminToken",
+}
+
+// restartOptions 修改后需要重启的配置 Reload时有修改会返回错误
+var restartOptions = []string{
+	"TCPAddress",
+	"UDPAddress",
+	"WebSocketAddress",
+	"HTTPAddress",
+	"HTTPSAddress",
+	"DataPath",
+	"LogFile",
+	"ClusterAddress",
+	"ClusterAdvertiseAddress",
+	"ClusterSeeds",
+	"ClusterToken",
+}
+
+// Reload 在运行时应用新配置中可以修改的部分（reloadableOptions）
+// 监听地址、存储路径有修改时返回*OptionError并且不应用任何修改，其他不支持运行时修改的配置会被忽略并输出警告
+func (t *TGO) Reload(opts *Options) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	oldOpts := t.GetOpts()
+	oldValue := reflect.ValueOf(oldOpts).Elem()
+	newValue := reflect.ValueOf(opts).Elem()
+	for _, name := range restartOptions {
+		if !reflect.DeepEqual(oldValue.FieldByName(name).Interface(), newValue.FieldByName(name).Interface()) {
+			return &OptionError{Field: optionName(name), Err: errOptionNotReloadable}
+		}
+	}
+
+	reloadedOpts := *oldOpts
+	reloadedValue := reflect.ValueOf(&reloadedOpts).Elem()
+	for _, name := range reloadableOptions {
+		oldField := oldValue.FieldByName(name)
+		newField := newValue.FieldByName(name)
+		if reflect.DeepEqual(oldField.Interface(), newField.Interface()) {
+			continue
+		}
+		t.Info("配置[%s]修改为：%v（原来为：%v）", optionName(name), reloadLogValue(name, newField), reloadLogValue(name, oldField))
+		reloadedValue.FieldByName(name).Set(newField)
+	}
+	t.warnIgnoredOptions(oldValue, newValue)
+	if leveled, ok := reloadedOpts.Log.(interface{ SetLevel(level LogLevel) }); ok {
+		leveled.SetLevel(reloadedOpts.LogLevel)
+	}
+	t.storeOpts(&reloadedOpts)
+	return nil
+}
+
+// warnIgnoredOptions 对修改了但不支持运行时修改的配置输出警告（Log、Pro等接口类型的配置不比较）
+func (t *TGO) warnIgnoredOptions(oldValue, newValue reflect.Value) {
+	applied := map[string]bool{}
+	for _, name := range reloadableOptions {
+		applied[name] = true
+	}
+	optionsType := oldValue.Type()
+	for i := 0; i < optionsType.NumField(); i++ {
+		field := optionsType.Field(i)
+		if applied[field.Name] || field.Type.Kind() == reflect.Interface {
+			continue
+		}
+		oldField := oldValue.Field(i)
+		newField := newValue.Field(i)
+		if !reflect.DeepEqual(oldField.Interface(), newField.Interface()) {
+			t.Warn("配置[%s]修改为：%v（原来为：%v）不支持运行时修改，重启后生效！", optionName(field.Name), reloadLogValue(field.Name, newField), reloadLogValue(field.Name, oldField))
+		}
+	}
+}
+
+// reloadLogValue 日志中输出的配置值 和Dump一样不输出密钥
+func reloadLogValue(name string, value reflect.Value) interface{} {
+	if strings.HasSuffix(name, "Token") && value.String() != "" {
+		return "******"
+	}
+	return value.Interface()
+}
+
+// ReloadFile 重新加载配置文件和环境变量（见LoadOptions）并应用可以修改的部分
+func (t *TGO) ReloadFile(path string) error {
+	opts, err := LoadOptions(path)
+	if err != nil {
+		return err
+	}
+	return t.Reload(opts)
+}
+
+// WatchReloadSignal 收到SIGHUP时重新加载配置文件 TGO停止后退出监听
+func (t *TGO) WatchReloadSignal(path string) {
+	t.WatchReload(func() (*Options, error) {
+		return LoadOptions(path)
+	})
+}
+
+// WatchReload 收到SIGHUP时通过load重新生成配置并应用可以修改的部分 TGO停止后退出监听
+// 启动时在配置文件之外还应用了命令行参数、默认值等，load需要同样应用，否则会被当作修改
+func (t *TGO) WatchReload(load func() (*Options, error)) {
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGHUP)
+	t.waitGroup.Wrap(func() {
+		defer signal.Stop(signalChan)
+		for {
+			select {
+			case <-signalChan:
+				opts, err := load()
+				if err == nil {
+					err = t.Reload(opts)
+				}
+				if err != nil {
+					t.Error("重新加载配置失败！-> %v", err)
+					continue
+				}
+				t.Info("重新加载配置成功！")
+			case <-t.exitChan:
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,111 @@
+package tgo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestTGO_Reload(t *testing.T) {
+	tg := startTGO(NewOptions())
+	defer tg.Stop()
+
+	opts := *tg.GetOpts()
+	opts.LogLevel = ErrorLevel
+	opts.MaxMsgSize = 10
+	opts.MsgTimeout = time.Second
+	opts.MaxChannelNum = 1 // 不支持运行时修改 忽略
+	if err := tg.Reload(&opts); err != nil {
+		t.Fatal(err)
+	}
+	if tg.GetOpts().MaxMsgSize != 10 || tg.GetOpts().LogLevel != ErrorLevel || tg.GetOpts().MsgTimeout != time.Second {
+		t.Fatal("可以修改的配置没有生效！")
+	}
+	if tg.GetOpts().MaxChannelNum == 1 {
+		t.Fatal("不支持运行时修改的配置不应该生效！")
+	}
+	if tg.GetOpts().Log.(*DefaultLog).Level() != ErrorLevel {
+		t.Fatal("日志级别没有生效！")
+	}
+
+	opts.TCPAddress = "127.0.0.1:1"
+	opts.MaxMsgSize = 20
+	err := tg.Reload(&opts)
+	if optionErr, ok := err.(*OptionError); !ok || optionErr.Field != "tcp_address" {
+		t.Fatalf("修改监听地址应该返回错误，实际为%v", err)
+	}
+	if tg.GetOpts().MaxMsgSize != 10 {
+		t.Fatal("返回错误时不应该应用任何修改！")
+	}
+}
+
+// warnLog 记录警告日志
+type warnLog struct {
+	lock  sync.Mutex
+	warns []string
+}
+
+func (l *warnLog) Info(format string, a ...interface{})  {}
+func (l *warnLog) Error(format string, a ...interface{}) {}
+func (l *warnLog) Debug(format string, a ...interface{}) {}
+func (l *warnLog) Fatal(format string, a ...interface{}) {}
+
+func (l *warnLog) Warn(format string, a ...interface{}) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.warns = append(l.warns, fmt.Sprintf(format, a...))
+}
+
+// TestTGO_Reload_ignored 修改了但不支持运行时修改的配置输出警告
+func TestTGO_Reload_ignored(t *testing.T) {
+	log := &warnLog{}
+	tg := startBuilder(newTestBuilder(NewOptions()).Log(log))
+	defer tg.Stop()
+
+	newOpts := *tg.GetOpts()
+	newOpts.MaxChannelNum = 1
+	newOpts.MsgTimeout = time.Second
+	if err := tg.Reload(&newOpts); err != nil {
+		t.Fatal(err)
+	}
+	log.lock.Lock()
+	defer log.lock.Unlock()
+	if len(log.warns) != 1 || !strings.Contains(log.warns[0], "max_channel_num") {
+		t.Fatalf("应该只对max_channel_num输出警告！-> %v", log.warns)
+	}
+}
+
+func TestTGO_WatchReloadSignal(t *testing.T) {
+	opts := NewOptions()
+	tg := startTGO(opts)
+	defer tg.Stop()
+
+	path := writeOptionFile(t, "tgo.yaml", "tcp_address: 127.0.0.1:0\nhttp_address: 127.0.0.1:0\nhttps_address: 127.0.0.1:0\nmax_packet_rate: 100\n")
+	defer os.RemoveAll(filepath.Dir(path))
+	tg.WatchReloadSignal(path)
+	time.Sleep(10 * time.Millisecond)
+	syscall.Kill(os.Getpid(), syscall.SIGHUP)
+	waitFor(t, func() bool { return tg.GetOpts().MaxPacketRate == 100 })
+}
+
+func TestPacketLimiter(t *testing.T) {
+	limiter := newPacketLimiter()
+	conn := &ServerConnTest{}
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if !limiter.allow(conn, 3, now) {
+			t.Fatalf("第%d个包不应该被限制！", i+1)
+		}
+	}
+	if limiter.allow(conn, 3, now) {
+		t.Fatal("超过速率的包应该被限制！")
+	}
+	if !limiter.allow(conn, 3, now.Add(time.Second)) {
+		t.Fatal("下一秒应该重新计数！")
+	}
+}
@@ -0,0 +1,95 @@
+package tgo
+
+// putRetainMsg 处理保留消息（FixedHeader.Retain） 保留消息替换管道当前的保留消息，内容为空的保留消息清除管道的保留消息
+// 返回cleared为true表示消息只用于清除保留消息，不需要再存储和投递
+func (t *TGO) putRetainMsg(channelID uint64, msg *Msg) (cleared bool, err error) {
+	if !msg.Retain {
+		return false, nil
+	}
+	if len(msg.Payload) == 0 {
+		return true, t.setRetainMsg(channelID, nil)
+	}
+	return false, t.setRetainMsg(channelID, msg)
+}
+
+// setRetainMsg 设置管道的保留消息 msg为nil表示清除
+func (t *TGO) setRetainMsg(channelID uint64, msg *Msg) error {
+	if retainStorage, ok := t.Storage.(RetainStorage); ok {
+		return retainStorage.SetRetainMsg(channelID, msg)
+	}
+	t.retainMsgLock.Lock()
+	defer t.retainMsgLock.Unlock()
+	if msg == nil {
+		delete(t.retainMsgMap, channelID)
+	} else {
+		t.retainMsgMap[channelID] = msg
+	}
+	return nil
+}
+
+// GetRetainMsg 获取管道的保留消息 没有返回nil
+func (t *TGO) GetRetainMsg(channelID uint64) (*Msg, error) {
+	if retainStorage, ok := t.Storage.(RetainStorage); ok {
+		return retainStorage.GetRetainMsg(channelID)
+	}
+	t.retainMsgLock.RLock()
+	defer t.retainMsgLock.RUnlock()
+	return t.retainMsgMap[channelID], nil
+}
+
+// pushRetainMsg 将管道的保留消息推送到连接
+func (t *TGO) pushRetainMsg(channelID uint64, conn Conn) error {
+	msg, err := t.GetRetainMsg(channelID)
+	if err != nil {
+		return err
+	}
+	if msg == nil {
+		return nil
+	}
+	return t.writeMsgPacket(conn, channelID, msg, true)
+}
+
+// Bind 绑定客户端和管道 群组的新成员从最新的消息开始同步 客户端在线时立即推送管道的保留消息
+func (t *TGO) Bind(clientID uint64, channelID uint64) error {
+	clientIDs, err := t.Storage.GetClientIDs(channelID)
+	if err != nil {
+		return err
+	}
+	err = t.Storage.Bind(clientID, channelID)
+	if err != nil {
+		return err
+	}
+	if !containsClientID(clientIDs, clientID) {
+		t.startGroupCursor(clientID, channelID)
+	}
+	conn := t.ConnManager.GetConn(clientID)
+	if conn == nil {
+		return nil
+	}
+	return t.pushRetainMsg(channelID, conn)
+}
+
+// startGroupCursor 群组新成员的读取游标从管道最新的消息开始
+func (t *TGO) startGroupCursor(clientID uint64, channelID uint64) {
+	channel, release, err := t.acquireChannel(channelID)
+	defer release()
+	if err != nil || channel == nil {
+		return
+	}
+	groupChannel, ok := channel.(*GroupChannel)
+	if !ok {
+		return
+	}
+	if err = groupChannel.startCursorAtHead(clientID); err != nil {
+		t.Warn("设置客户端[%d]在管道[%d]的读取游标失败！-> %v", clientID, channelID, err)
+	}
+}
+
+func containsClientID(clientIDs []uint64, clientID uint64) bool {
+	for _, id := range clientIDs {
+		if id == clientID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package tgo
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTGO_retainMsg(t *testing.T) {
+	opts := NewOptions()
+	opts.Pro = &ProtocolTest{}
+	tg := startTGO(opts)
+	defer tg.Stop()
+
+	var groupID uint64 = 800
+	tg.Storage.AddChannel(NewChannelModel(groupID, ChannelTypeGroup))
+	channel, err := tg.GetChannel(groupID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(1); i <= 2; i++ {
+		msg := NewMsg(i, 9, []byte("state"))
+		msg.Retain = true
+		if err = channel.PutMsg(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	retainMsg, _ := tg.GetRetainMsg(groupID)
+	if retainMsg == nil || retainMsg.MessageID != 2 {
+		t.Fatalf("保留消息应该为最后一条保留消息")
+	}
+
+	// 绑定时立即收到保留消息
+	conn := &ServerConnTest{}
+	tg.ConnManager.AddConn(5, conn)
+	if err = tg.Bind(5, groupID); err != nil {
+		t.Fatal(err)
+	}
+	writes := conn.Writes()
+	if len(writes) != 1 || !strings.Contains(writes[0], "retain: true") {
+		t.Fatalf("绑定后应该收到1条保留消息，实际为%v", writes)
+	}
+
+	// 连接时收到所在管道的保留消息
+	connectConn := &ServerConnTest{}
+	tg.Storage.Bind(6, groupID)
+	tg.syncChannelMsg(6, connectConn)
+	if len(connectConn.Writes()) != 1 {
+		t.Fatalf("连接后应该收到1条保留消息，实际为%d条", len(connectConn.Writes()))
+	}
+
+	// 内容为空的保留消息清除保留消息
+	clearMsg := NewMsg(3, 9, nil)
+	clearMsg.Retain = true
+	channel.PutMsg(clearMsg)
+	if retainMsg, _ = tg.GetRetainMsg(groupID); retainMsg != nil {
+		t.Fatalf("保留消息应该已被清除")
+	}
+}
+
+// TestTGO_retainMsg_plainStorage 存储没有实现CursorStorage时连接也能收到个人管道的保留消息
+func TestTGO_retainMsg_plainStorage(t *testing.T) {
+	opts := NewOptions()
+	opts.Pro = &ProtocolTest{}
+	tg := startBuilder(newTestBuilder(opts).Storage(func(context *Context) Storage {
+		return struct{ Storage }{NewMemoryStorage(context)}
+	}))
+	defer tg.Stop()
+
+	var clientID uint64 = 5
+	tg.Storage.AddChannel(NewChannelModel(clientID, ChannelTypePerson))
+	msg := NewMsg(1, 9, []byte("state"))
+	msg.Retain = true
+	if _, err := tg.putRetainMsg(clientID, msg); err != nil {
+		t.Fatal(err)
+	}
+	conn := &ServerConnTest{}
+	tg.syncChannelMsg(clientID, conn)
+	writes := conn.Writes()
+	if len(writes) != 1 || !strings.Contains(writes[0], "retain: true") {
+		t.Fatalf("连接后应该收到1条保留消息，实际为%v", writes)
+	}
+}
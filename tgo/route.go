@@ -1,11 +1,14 @@
 package tgo
 
 import (
+	"context"
 	"fmt"
 	"github.com/tgo-team/tgo-core/tgo/packets"
 	"math"
 	"reflect"
 	"runtime"
+	"strconv"
+	"strings"
 	"sync"
 )
 
@@ -13,18 +16,27 @@ type HandlerFunc func(*MContext)
 type AuthHandlerFunc func(MContext) error
 type HandlersChain []HandlerFunc
 
+const (
+	matchTypePrefix = "type:" // 包类型匹配 例如 type:7
+	matchCmdPrefix  = "cmd:"  // 命令匹配 支持参数段和通配段 例如 cmd:group/:groupID/members cmd:file/*path
+)
+
 type Route struct {
-	pool            sync.Pool
-	handlers        HandlersChain
-	ctx             *Context
-	matchHandlerMap map[string]HandlerFunc
+	pool           sync.Pool
+	handlers       HandlersChain
+	ctx            *Context
+	typeHandlerMap map[packets.PacketType]HandlersChain // 包类型匹配
+	cmdTree        *routeNode                           // 命令匹配
+	noMatchHandler HandlerFunc                          // 命令没有匹配的处理
 }
 
 func NewRoute(ctx *Context) *Route {
 	r := &Route{
-		handlers:        HandlersChain{},
-		ctx:             ctx,
-		matchHandlerMap: make(map[string]HandlerFunc, 0),
+		handlers:       HandlersChain{},
+		ctx:            ctx,
+		typeHandlerMap: make(map[packets.PacketType]HandlersChain, 0),
+		cmdTree:        newRouteNode(),
+		noMatchHandler: replyCmdNotFound,
 	}
 	return r
 }
@@ -35,29 +47,46 @@ func (r *Route) handle(context *MContext) {
 
 func (r *Route) Serve(m *MContext) {
 	m.Ctx = r.ctx
-	m.handlers = r.handlers
+	m.initContext()
+	m.handlers = r.matchHandlers(m)
+	m.startSpan()
 	r.handle(m)
+	r.replyErr(m)
+	r.ctx.TGO.finishSpan(m.span, m.GetErr())
+	m.release()
+}
 
-	if m.Packet()!=nil && !m.IsAborted(){
-		// 包类型匹配
-		packetType := m.Packet().GetFixedHeader().PacketType
-		typePath := fmt.Sprintf("type:%d",packetType)
-		matchFunc := r.matchHandlerMap[typePath]
-		if matchFunc!=nil {
-
-			matchFunc(m)
-		}
-		// cmd类型匹配
-		if packetType == packets.Cmd {
-			cmd := m.Packet().(*packets.CmdPacket).CMD
-			cmdPath := fmt.Sprintf("cmd:%s",cmd)
-			matchFunc := r.matchHandlerMap[cmdPath]
-			if matchFunc!=nil {
-				matchFunc(m)
-			}
+// matchHandlers 组合全局中间件和匹配到的处理链（分组中间件、路由中间件和处理）
+// 全局中间件对所有包生效，并且可以通过Next包裹匹配到的处理链
+func (r *Route) matchHandlers(m *MContext) HandlersChain {
+	if m.Packet() == nil {
+		return r.handlers
+	}
+	handlers := r.handlers
+	// 包类型匹配
+	packetType := m.Packet().GetFixedHeader().PacketType
+	typeHandlers := r.typeHandlerMap[packetType]
+	if typeHandlers != nil {
+		handlers = combineHandlers(handlers, typeHandlers)
+	}
+	// cmd类型匹配
+	if packetType == packets.Cmd {
+		node, params := r.cmdTree.find(m.CmdPacket().CMD)
+		if node != nil {
+			m.params = params
+			handlers = combineHandlers(handlers, node.handlers)
+		} else if typeHandlers == nil && r.noMatchHandler != nil {
+			handlers = combineHandlers(handlers, HandlersChain{r.noMatchHandler})
 		}
 	}
+	return handlers
+}
 
+// combineHandlers 合并处理链（返回新的处理链，不修改参数）
+func combineHandlers(handlers HandlersChain, others HandlersChain) HandlersChain {
+	mergedHandlers := make(HandlersChain, 0, len(handlers)+len(others))
+	mergedHandlers = append(mergedHandlers, handlers...)
+	return append(mergedHandlers, others...)
 }
 
 func (r *Route) Use(handles ...HandlerFunc) *Route {
@@ -65,16 +94,75 @@ func (r *Route) Use(handles ...HandlerFunc) *Route {
 	return r
 }
 
-func (r *Route) Match(match string, handler HandlerFunc) {
-	r.matchHandlerMap[match] = handler
+// Match 注册匹配规则的处理 规则格式为 type:包类型 或 cmd:命令（支持 :参数 和 *通配 段）
+// handlers最后一个为处理，前面的为只对此规则生效的中间件
+// 规则不合法或与已注册的规则冲突会panic
+func (r *Route) Match(match string, handlers ...HandlerFunc) {
+	r.match(match, handlers)
+}
+
+// Group 创建路由分组 分组的匹配规则为prefix加上子规则，分组中间件只对分组内的规则生效
+// 例如 admin := r.Group("cmd:admin/", adminAuth); admin.Match("kick", kick) 注册的规则为 cmd:admin/kick
+func (r *Route) Group(prefix string, handlers ...HandlerFunc) *RouteGroup {
+	return &RouteGroup{route: r, prefix: prefix, handlers: handlers}
+}
+
+func (r *Route) match(match string, handlers HandlersChain) {
+	if len(handlers) == 0 {
+		panic(fmt.Errorf("匹配规则[%s]没有处理！", match))
+	}
+	if len(r.handlers)+len(handlers) >= int(abortIndex) {
+		panic(fmt.Errorf("匹配规则[%s]的处理链太长！", match))
+	}
+	err := r.addMatch(match, handlers)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// NoMatch 设置命令没有匹配到处理时的处理（默认回复CmdackStatusNotFound）
+func (r *Route) NoMatch(handler HandlerFunc) {
+	r.noMatchHandler = handler
+}
+
+func (r *Route) addMatch(match string, handlers HandlersChain) error {
+	switch {
+	case strings.HasPrefix(match, matchTypePrefix):
+		packetType, err := strconv.Atoi(match[len(matchTypePrefix):])
+		if err != nil {
+			return fmt.Errorf("匹配规则[%s]的包类型不合法！", match)
+		}
+		if r.typeHandlerMap[packets.PacketType(packetType)] != nil {
+			return fmt.Errorf("匹配规则[%s]已注册！", match)
+		}
+		r.typeHandlerMap[packets.PacketType(packetType)] = handlers
+		return nil
+	case strings.HasPrefix(match, matchCmdPrefix):
+		return r.cmdTree.add(match[len(matchCmdPrefix):], handlers)
+	}
+	return fmt.Errorf("不支持的匹配规则[%s]！", match)
+}
+
+// replyCmdNotFound 回复命令不存在
+func replyCmdNotFound(m *MContext) {
+	cmdPacket := m.CmdPacket()
+	m.Debug("命令[%s]没有匹配的处理！", cmdPacket.CMD)
+	m.Reply(packets.CmdackStatusNotFound, nil)
 }
 
 const abortIndex int8 = math.MaxInt8 / 2
 
 type MContext struct {
-	packetContext *PacketContext
-	index       int8
-	handlers    HandlersChain
+	packetContext   *PacketContext
+	index           int8
+	handlers        HandlersChain
+	params          Params                 // 命令匹配到的参数
+	err             error                  // 处理返回的错误
+	keys            map[string]interface{} // 中间件传递给处理的数据（Set/Get）
+	copied          bool                   // 是否为Copy的副本（副本不放回池中）
+	span            *Span                  // 消息包的处理链路（route.serve）
+	cancel          context.CancelFunc
+	context.Context // 连接关闭或超过HandlerTimeout时Done
 	sync.RWMutex
 	Ctx *Context
 }
@@ -85,7 +173,7 @@ var pool = sync.Pool{
 	},
 }
 
-// TODO 这里不需要pool 因为消息都是异步处理 不知道结束点在哪里 也就不知道什么时候put回对象，以后需要优化为多例的
+// GetMContext 从池中获取MContext Route.Serve完成后会放回池中，处理中启动的协程需要使用Copy的副本
 func GetMContext(packetContext *PacketContext) *MContext {
 	mContext := pool.Get().(*MContext)
 	mContext.reset()
@@ -126,13 +214,17 @@ func (m *MContext) Storage() Storage {
 	return m.Ctx.TGO.Storage
 }
 
-
 func (m *MContext) Msg() *Msg {
 	messagePacket, ok := m.packetContext.Packet.(*packets.MessagePacket)
 	if ok {
-		msg := NewMsg(messagePacket.MessageID,messagePacket.From,messagePacket.Payload)
+		msg := NewMsg(messagePacket.MessageID, messagePacket.From, messagePacket.Payload)
 		msg.MessageID = messagePacket.MessageID
 		msg.Payload = messagePacket.Payload
+		msg.Retain = messagePacket.Retain
+		if m.span != nil {
+			msg.TraceID = m.span.TraceID
+			msg.SpanID = m.span.SpanID
+		}
 		return msg
 	}
 	return nil
@@ -146,20 +238,54 @@ func (m *MContext) IsAborted() bool {
 	return m.index >= abortIndex
 }
 
-func (m *MContext) ReplyPacket(packet packets.Packet)  {
+// AbortWithError 终止处理并返回错误 命令包会回复Cmdack（CmdError回复对应的状态，其他错误回复CmdackStatusInternalError）
+func (m *MContext) AbortWithError(err error) {
+	m.err = err
+	m.Abort()
+}
+
+// GetErr 获取处理返回的错误
+func (m *MContext) GetErr() error {
+	return m.err
+}
+
+func (m *MContext) ReplyPacket(packet packets.Packet) {
 	data, err := m.Ctx.TGO.GetOpts().Pro.EncodePacket(packet)
 	if err != nil {
-		m.Error("编码出错！-> %v",err)
+		m.Error("编码出错！-> %v", err)
 		return
 	}
 	_, err = m.Conn().Write(data)
 	if err != nil {
-		m.Error("写入数据出错！-> %v",err)
+		m.Error("写入数据出错！-> %v", err)
 	}
 	return
 }
 
-func (m *MContext) GetChannel(channelID uint64) (Channel,error) {
+// Reply 回复当前命令 回复的Cmdack带上命令和请求编号
+func (m *MContext) Reply(status uint16, payload []byte) {
+	cmdPacket := m.CmdPacket()
+	cmdackPacket := packets.NewCmdackPacket(cmdPacket.CMD, status, payload)
+	cmdackPacket.RequestID = cmdPacket.RequestID
+	m.ReplyPacket(cmdackPacket)
+}
+
+// ReplyValue 将v编码（实现了encoding.BinaryMarshaler使用二进制编码，否则使用JSON）后回复当前命令
+func (m *MContext) ReplyValue(status uint16, v interface{}) error {
+	payload, err := EncodePayload(v)
+	if err != nil {
+		return err
+	}
+	m.Reply(status, payload)
+	return nil
+}
+
+// BindCmd 将当前命令的payload解码到v（实现了encoding.BinaryUnmarshaler使用二进制解码，否则使用JSON）
+func (m *MContext) BindCmd(v interface{}) error {
+	return DecodePayload(m.CmdPacket().Payload, v)
+}
+
+func (m *MContext) GetChannel(channelID uint64) (Channel, error) {
 
 	return m.Ctx.TGO.GetChannel(channelID)
 }
@@ -170,6 +296,24 @@ func (m *MContext) reset() {
 	m.index = -1
 	m.packetContext = nil
 	m.handlers = nil
+	m.params = nil
+	m.err = nil
+	m.keys = nil
+	m.copied = false
+	m.span = nil
+	m.cancel = nil
+	m.Context = nil
+}
+
+// Param 获取命令匹配到的参数 例如规则 cmd:group/:groupID/members 的 groupID
+func (m *MContext) Param(key string) string {
+	value, _ := m.params.Get(key)
+	return value
+}
+
+// Params 获取命令匹配到的所有参数
+func (m *MContext) Params() Params {
+	return m.params
 }
 
 func (m *MContext) current() HandlerFunc {
@@ -180,33 +324,41 @@ func (m *MContext) current() HandlerFunc {
 }
 
 // ---------- log --------------
+// logFields 处理日志带上客户端ID和连接地址
+func (m *MContext) logFields() []Field {
+	if m.packetContext == nil {
+		return nil
+	}
+	return []Field{FieldClientID(m.ClientID()), FieldRemoteAddr(m.Conn())}
+}
+
 func (m *MContext) Info(f string, args ...interface{}) {
 	funcName := m.currentHandleName()
-	m.Ctx.TGO.GetOpts().Log.Info(fmt.Sprintf("%s[%s] -> ", m.getLogPrefix(), funcName)+f, args...)
+	logf(m.Ctx.TGO.GetOpts().Log, InfoLevel, m.logFields(), fmt.Sprintf("%s[%s] -> ", m.getLogPrefix(), funcName)+f, args...)
 	return
 }
 
 func (m *MContext) Error(f string, args ...interface{}) {
 	funcName := m.currentHandleName()
-	m.Ctx.TGO.GetOpts().Log.Error(fmt.Sprintf("%s[%s] -> ", m.getLogPrefix(), funcName)+f, args...)
+	logf(m.Ctx.TGO.GetOpts().Log, ErrorLevel, m.logFields(), fmt.Sprintf("%s[%s] -> ", m.getLogPrefix(), funcName)+f, args...)
 	return
 }
 
 func (m *MContext) Debug(f string, args ...interface{}) {
 	funcName := m.currentHandleName()
-	m.Ctx.TGO.GetOpts().Log.Debug(fmt.Sprintf("%s[%s] -> ", m.getLogPrefix(), funcName)+f, args...)
+	logf(m.Ctx.TGO.GetOpts().Log, DebugLevel, m.logFields(), fmt.Sprintf("%s[%s] -> ", m.getLogPrefix(), funcName)+f, args...)
 	return
 }
 
 func (m *MContext) Warn(f string, args ...interface{}) {
 	funcName := m.currentHandleName()
-	m.Ctx.TGO.GetOpts().Log.Warn(fmt.Sprintf("%s[%s] -> ", m.getLogPrefix(), funcName)+f, args...)
+	logf(m.Ctx.TGO.GetOpts().Log, WarnLevel, m.logFields(), fmt.Sprintf("%s[%s] -> ", m.getLogPrefix(), funcName)+f, args...)
 	return
 }
 
 func (m *MContext) Fatal(f string, args ...interface{}) {
 	funcName := m.currentHandleName()
-	m.Ctx.TGO.GetOpts().Log.Fatal(fmt.Sprintf("%s[%s] -> ", m.getLogPrefix(), funcName)+f, args...)
+	logf(m.Ctx.TGO.GetOpts().Log, FatalLevel, m.logFields(), fmt.Sprintf("%s[%s] -> ", m.getLogPrefix(), funcName)+f, args...)
 	return
 }
 
@@ -0,0 +1,166 @@
+package tgo
+
+import (
+	"context"
+	"github.com/tgo-team/tgo-core/tgo/packets"
+	"time"
+)
+
+const ContextKeyClientID = "tgo.clientID" // 认证中间件保存客户端ID的key
+
+// initContext 初始化MContext的上下文 连接已认证时上下文随连接关闭而取消，并且在HandlerTimeout后超时
+func (m *MContext) initContext() {
+	parent := m.connContext()
+	timeout := m.Ctx.TGO.GetOpts().HandlerTimeout
+	if timeout > 0 {
+		m.Context, m.cancel = context.WithTimeout(parent, timeout)
+	} else {
+		m.Context, m.cancel = context.WithCancel(parent)
+	}
+}
+
+// connContext 获取连接的上下文 连接未认证返回context.Background()
+func (m *MContext) connContext() context.Context {
+	if m.packetContext != nil && m.Ctx != nil && m.Ctx.TGO.ConnManager != nil {
+		if statefulConn, ok := m.Conn().(StatefulConn); ok {
+			ctx := m.Ctx.TGO.ConnManager.ConnContext(statefulConn.GetID(), m.Conn())
+			if ctx != nil {
+				return ctx
+			}
+		}
+	}
+	return context.Background()
+}
+
+// startSpan 消息包开始一条新的处理链路（route.serve为根Span） Msg()创建的消息会带上链路ID
+func (m *MContext) startSpan() {
+	messagePacket, ok := m.Packet().(*packets.MessagePacket)
+	if !ok {
+		return
+	}
+	m.span = m.Ctx.TGO.startSpan(SpanRouteServe, nil, messagePacket.ChannelID)
+	if m.span != nil {
+		m.span.MessageID = messagePacket.MessageID
+		if statefulConn, ok := m.Conn().(StatefulConn); ok {
+			m.span.ClientID = statefulConn.GetID()
+		}
+	}
+}
+
+// release 处理完成后取消上下文并放回池中
+func (m *MContext) release() {
+	if m.cancel != nil {
+		m.cancel()
+	}
+	if !m.copied {
+		pool.Put(m)
+	}
+}
+
+// Copy 复制MContext 处理中启动的协程需要使用副本（原MContext在Serve完成后会被重用）
+// 副本的上下文在连接关闭、到达原MContext的deadline或者调用Release时Done
+// 副本使用完后必须调用Release 否则上下文要等到连接关闭才释放
+func (m *MContext) Copy() *MContext {
+	cp := &MContext{
+		packetContext: m.packetContext,
+		index:         abortIndex,
+		params:        append(Params{}, m.params...),
+		err:           m.err,
+		copied:        true,
+		span:          m.span,
+		Ctx:           m.Ctx,
+	}
+	m.RLock()
+	if m.keys != nil {
+		cp.keys = make(map[string]interface{}, len(m.keys))
+		for key, value := range m.keys {
+			cp.keys[key] = value
+		}
+	}
+	m.RUnlock()
+	parent := m.connContext()
+	if deadline, ok := m.Deadline(); ok {
+		cp.Context, cp.cancel = context.WithDeadline(parent, deadline)
+	} else {
+		cp.Context, cp.cancel = context.WithCancel(parent)
+	}
+	return cp
+}
+
+// Release 释放Copy得到的副本的上下文 对Serve中的MContext无效（Serve完成后自动释放）
+func (m *MContext) Release() {
+	if !m.copied {
+		return
+	}
+	if m.cancel != nil {
+		m.cancel()
+	}
+}
+
+// Set 保存数据 用于中间件传递数据给之后的处理（例如认证后的客户端ID）
+func (m *MContext) Set(key string, value interface{}) {
+	m.Lock()
+	defer m.Unlock()
+	if m.keys == nil {
+		m.keys = make(map[string]interface{})
+	}
+	m.keys[key] = value
+}
+
+// Get 获取Set保存的数据
+func (m *MContext) Get(key string) (interface{}, bool) {
+	m.RLock()
+	defer m.RUnlock()
+	value, ok := m.keys[key]
+	return value, ok
+}
+
+// ClientID 获取客户端ID 优先使用中间件保存的ContextKeyClientID，否则使用已认证连接的ID
+func (m *MContext) ClientID() uint64 {
+	if value, ok := m.Get(ContextKeyClientID); ok {
+		if clientID, ok := value.(uint64); ok {
+			return clientID
+		}
+	}
+	if statefulConn, ok := m.Conn().(StatefulConn); ok {
+		return statefulConn.GetID()
+	}
+	return 0
+}
+
+// Value 实现context.Context 先查找Set保存的数据
+func (m *MContext) Value(key interface{}) interface{} {
+	if keyStr, ok := key.(string); ok {
+		if value, ok := m.Get(keyStr); ok {
+			return value
+		}
+	}
+	if m.Context == nil {
+		return nil
+	}
+	return m.Context.Value(key)
+}
+
+// Deadline 实现context.Context
+func (m *MContext) Deadline() (time.Time, bool) {
+	if m.Context == nil {
+		return time.Time{}, false
+	}
+	return m.Context.Deadline()
+}
+
+// Done 实现context.Context
+func (m *MContext) Done() <-chan struct{} {
+	if m.Context == nil {
+		return nil
+	}
+	return m.Context.Done()
+}
+
+// Err 实现context.Context
+func (m *MContext) Err() error {
+	if m.Context == nil {
+		return nil
+	}
+	return m.Context.Err()
+}
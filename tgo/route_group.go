@@ -0,0 +1,37 @@
+package tgo
+
+// RouteGroup 路由分组 分组内的中间件只对分组内的匹配规则生效
+type RouteGroup struct {
+	route    *Route
+	prefix   string
+	handlers HandlersChain
+}
+
+// Use 添加分组中间件（只对之后注册的规则生效）
+func (g *RouteGroup) Use(handlers ...HandlerFunc) *RouteGroup {
+	g.handlers = append(g.handlers, handlers...)
+	return g
+}
+
+// Group 创建子分组 子分组继承当前分组的前缀和中间件
+func (g *RouteGroup) Group(prefix string, handlers ...HandlerFunc) *RouteGroup {
+	return &RouteGroup{
+		route:    g.route,
+		prefix:   g.prefix + prefix,
+		handlers: combineHandlers(g.handlers, handlers),
+	}
+}
+
+// Match 在分组内注册匹配规则 规则为分组前缀加上match，handlers最后一个为处理，前面的为只对此规则生效的中间件
+func (g *RouteGroup) Match(match string, handlers ...HandlerFunc) {
+	if len(handlers) == 0 {
+		g.route.match(g.prefix+match, handlers)
+		return
+	}
+	g.route.match(g.prefix+match, combineHandlers(g.handlers, handlers))
+}
+
+// Prefix 分组的匹配规则前缀
+func (g *RouteGroup) Prefix() string {
+	return g.prefix
+}
@@ -0,0 +1,58 @@
+package tgo
+
+import (
+	"fmt"
+	"github.com/tgo-team/tgo-core/tgo/packets"
+	"io"
+	"runtime/debug"
+)
+
+// CmdError 处理命令的错误 会被转换为对应状态的Cmdack回复
+type CmdError struct {
+	Status  uint16 // Cmdack状态
+	Message string // 错误信息（作为Cmdack的payload）
+}
+
+func NewCmdError(status uint16, message string) *CmdError {
+	return &CmdError{Status: status, Message: message}
+}
+
+func (e *CmdError) Error() string {
+	return fmt.Sprintf("status: %d message: %s", e.Status, e.Message)
+}
+
+// Recovery 恢复处理中发生的panic 记录堆栈和处理名称，命令包回复CmdackStatusInternalError，其他包关闭连接
+// 默认已添加到TGO的路由中
+func Recovery() HandlerFunc {
+	return func(m *MContext) {
+		defer func() {
+			if err := recover(); err != nil {
+				m.Error("处理发生panic！-> %v\n%s", err, debug.Stack())
+				m.Ctx.TGO.monitorCounter(metricHandlerPanics, Labels{"handler": m.currentHandleName()}, 1)
+				if m.Packet() != nil && m.PacketType() == packets.Cmd {
+					m.AbortWithError(NewCmdError(packets.CmdackStatusInternalError, "服务器内部错误！"))
+					return
+				}
+				m.Abort()
+				if closer, ok := m.Conn().(io.Closer); ok {
+					closer.Close()
+				}
+			}
+		}()
+		m.Next()
+	}
+}
+
+// replyErr 将处理返回的错误转换为Cmdack回复（只有命令包才回复）
+func (r *Route) replyErr(m *MContext) {
+	if m.err == nil || m.Packet() == nil || m.PacketType() != packets.Cmd {
+		return
+	}
+	status := packets.CmdackStatusInternalError
+	message := m.err.Error()
+	if cmdErr, ok := m.err.(*CmdError); ok {
+		status = cmdErr.Status
+		message = cmdErr.Message
+	}
+	m.Reply(status, []byte(message))
+}
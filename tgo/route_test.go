@@ -1,27 +1,30 @@
 package tgo
 
-
+import (
+	"fmt"
+	"github.com/tgo-team/tgo-core/tgo/packets"
+	"strings"
+	"testing"
+	"time"
+)
 
 type ServerTest struct {
-
 }
 
-
 func (s *ServerTest) Start() error {
 	return nil
 }
-func (s *ServerTest)  ReceiveMsgChan() chan *Msg {
+func (s *ServerTest) ReceiveMsgChan() chan *Msg {
 	return nil
 }
-func (s *ServerTest)  SendMsg(to int64,msg *Msg) error {
+func (s *ServerTest) SendMsg(to int64, msg *Msg) error {
 	return nil
 }
-func (s *ServerTest)  Stop() error {
+func (s *ServerTest) Stop() error {
 	return nil
 }
 
 type StorageTest struct {
-
 }
 
 func (s *StorageTest) SaveMsg(msg *Msg) error {
@@ -29,4 +32,198 @@ func (s *StorageTest) SaveMsg(msg *Msg) error {
 }
 func (s *StorageTest) ReceiveMsgChan() chan *Msg {
 	return nil
-}
\ No newline at end of file
+}
+func newTestRoute() (*Route, *ServerConnTest) {
+	opts := NewOptions()
+	opts.Pro = &ProtocolTest{}
+	tg := &TGO{}
+	tg.storeOpts(opts)
+	return NewRoute(&Context{TGO: tg}), &ServerConnTest{}
+}
+
+func TestRoute_MatchParams(t *testing.T) {
+	r, conn := newTestRoute()
+	var groupID, path, matched string
+	r.Match("cmd:group/:groupID/members", func(m *MContext) {
+		matched = "members"
+		groupID = m.Param("groupID")
+	})
+	r.Match("cmd:group/admin/members", func(m *MContext) {
+		matched = "admin"
+	})
+	r.Match("cmd:file/*path", func(m *MContext) {
+		matched = "file"
+		path = m.Param("path")
+	})
+
+	r.Serve(GetMContext(NewPacketContext(packets.NewCmdPacket("group/100/members", nil), conn)))
+	if matched != "members" || groupID != "100" {
+		t.Fatalf("应该匹配到members，groupID为100，实际为%s %s", matched, groupID)
+	}
+	r.Serve(GetMContext(NewPacketContext(packets.NewCmdPacket("group/admin/members", nil), conn)))
+	if matched != "admin" {
+		t.Fatalf("静态段应该优先匹配，实际为%s", matched)
+	}
+	r.Serve(GetMContext(NewPacketContext(packets.NewCmdPacket("file/a/b.txt", nil), conn)))
+	if matched != "file" || path != "a/b.txt" {
+		t.Fatalf("应该匹配到file，path为a/b.txt，实际为%s %s", matched, path)
+	}
+
+	// 没有匹配回复命令不存在
+	r.Serve(GetMContext(NewPacketContext(packets.NewCmdPacket("group/100", nil), conn)))
+	writes := conn.Writes()
+	if len(writes) != 1 || !strings.Contains(writes[0], fmt.Sprintf("Status: %d", packets.CmdackStatusNotFound)) {
+		t.Fatalf("没有匹配的命令应该回复CmdackStatusNotFound，实际为%v", writes)
+	}
+}
+
+func TestRoute_MatchConflict(t *testing.T) {
+	tests := [][]string{
+		{"cmd:login", "cmd:login"},
+		{"cmd:group/:groupID", "cmd:group/:id"},
+		{"cmd:file/*path", "cmd:file/*name"},
+		{"type:7", "type:7"},
+		{"cmd:file/*path/x"},
+		{"login"},
+	}
+	for _, matches := range tests {
+		r, _ := newTestRoute()
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("注册%v应该panic", matches)
+				}
+			}()
+			for _, match := range matches {
+				r.Match(match, func(m *MContext) {})
+			}
+		}()
+	}
+}
+
+func TestRoute_Group(t *testing.T) {
+	r, conn := newTestRoute()
+	calls := make([]string, 0)
+	record := func(name string) HandlerFunc {
+		return func(m *MContext) {
+			calls = append(calls, name)
+		}
+	}
+	adminAuth := func(m *MContext) {
+		calls = append(calls, "adminAuth")
+		if string(m.CmdPacket().Payload) != "admin" {
+			m.Abort()
+		}
+	}
+	r.Use(record("global"))
+	admin := r.Group("cmd:admin/", adminAuth)
+	admin.Match("kick", record("kick"))
+	msg := r.Group("cmd:msg/", record("rateLimit"))
+	msg.Match("send", record("audit"), record("send"))
+	r.Match("cmd:login", record("login"))
+
+	serve := func(cmd string, payload string) []string {
+		calls = calls[:0]
+		r.Serve(GetMContext(NewPacketContext(packets.NewCmdPacket(cmd, []byte(payload)), conn)))
+		return calls
+	}
+	tests := []struct {
+		cmd     string
+		payload string
+		calls   string
+	}{
+		{"admin/kick", "admin", "global,adminAuth,kick"},
+		{"admin/kick", "user", "global,adminAuth"},
+		{"msg/send", "", "global,rateLimit,audit,send"},
+		{"login", "", "global,login"},
+	}
+	for _, test := range tests {
+		if calls := strings.Join(serve(test.cmd, test.payload), ","); calls != test.calls {
+			t.Fatalf("命令[%s]的处理链应该为%s，实际为%s", test.cmd, test.calls, calls)
+		}
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	r, conn := newTestRoute()
+	r.Use(Recovery())
+	r.Match("cmd:panic", func(m *MContext) {
+		panic("handler panic")
+	})
+	r.Match("cmd:forbidden", func(m *MContext) {
+		m.AbortWithError(NewCmdError(403, "没有权限！"))
+	})
+	r.Match("cmd:error", func(m *MContext) {
+		m.AbortWithError(fmt.Errorf("出错了"))
+	})
+	tests := map[string]uint16{
+		"panic":     packets.CmdackStatusInternalError,
+		"forbidden": 403,
+		"error":     packets.CmdackStatusInternalError,
+	}
+	for cmd, status := range tests {
+		r.Serve(GetMContext(NewPacketContext(packets.NewCmdPacket(cmd, nil), conn)))
+		writes := conn.Writes()
+		if !strings.Contains(writes[len(writes)-1], fmt.Sprintf("CMD: %s Status: %d", cmd, status)) {
+			t.Fatalf("命令[%s]应该回复状态%d，实际为%s", cmd, status, writes[len(writes)-1])
+		}
+	}
+}
+
+func TestMContext_Copy(t *testing.T) {
+	r, _ := newTestRoute()
+	r.ctx.TGO.ConnManager = newConnManager()
+	conn := &StatefulConnTest{id: 1}
+	r.ctx.TGO.ConnManager.AddConn(1, conn)
+
+	r.Use(func(m *MContext) {
+		m.Set(ContextKeyClientID, uint64(100))
+	})
+	copyChan := make(chan *MContext, 1)
+	r.Match("cmd:async", func(m *MContext) {
+		copyChan <- m.Copy()
+	})
+	r.Serve(GetMContext(NewPacketContext(packets.NewCmdPacket("async", nil), conn)))
+	cp := <-copyChan
+	r.Serve(GetMContext(NewPacketContext(packets.NewCmdPacket("other", nil), conn))) // 原MContext已放回池中被重用
+
+	if cp.CmdPacket().CMD != "async" || cp.ClientID() != 100 || cp.Value(ContextKeyClientID) != uint64(100) {
+		t.Fatalf("副本的数据不正确！")
+	}
+	if _, ok := cp.Deadline(); !ok {
+		t.Fatalf("副本应该有deadline")
+	}
+	select {
+	case <-cp.Done():
+		t.Fatalf("连接未关闭副本的上下文不应该Done")
+	default:
+	}
+	r.Serve(GetMContext(NewPacketContext(packets.NewCmdPacket("async", nil), conn)))
+	released := <-copyChan
+	released.Release()
+	select {
+	case <-released.Done():
+	default:
+		t.Fatalf("Release后副本的上下文应该Done")
+	}
+	r.ctx.TGO.ConnManager.RemoveConn(1, conn)
+	select {
+	case <-cp.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("连接关闭后副本的上下文应该Done")
+	}
+}
+
+func BenchmarkRoute_Serve(b *testing.B) {
+	r, conn := newTestRoute()
+	r.Match("cmd:login", func(m *MContext) {})
+	r.Match("cmd:group/:groupID/members", func(m *MContext) {
+		m.Param("groupID")
+	})
+	r.Match("type:7", func(m *MContext) {})
+	cmdPacket := packets.NewCmdPacket("group/100/members", nil)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r.Serve(GetMContext(NewPacketContext(cmdPacket, conn)))
+	}
+}
@@ -0,0 +1,132 @@
+package tgo
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	routeSeparator      = "/"
+	routeParamPrefix    = ":" // 参数段 例如 group/:groupID/members
+	routeWildcardPrefix = "*" // 通配段 匹配剩余所有段 只能在最后 例如 file/*path
+)
+
+// Param 路由参数
+type Param struct {
+	Key   string
+	Value string
+}
+
+// Params 路由参数集合
+type Params []Param
+
+// Get 获取参数值
+func (ps Params) Get(key string) (string, bool) {
+	for _, p := range ps {
+		if p.Key == key {
+			return p.Value, true
+		}
+	}
+	return "", false
+}
+
+// routeNode 命令路由树节点 静态段优先于参数段，参数段优先于通配段
+type routeNode struct {
+	staticChildren map[string]*routeNode
+	paramChild     *routeNode
+	wildcardChild  *routeNode
+	name           string // 参数段或通配段的参数名
+	pattern        string // 注册的完整规则（只有叶子节点有）
+	handlers       HandlersChain
+}
+
+func newRouteNode() *routeNode {
+	return &routeNode{staticChildren: map[string]*routeNode{}}
+}
+
+// add 添加路由规则 规则冲突返回错误
+func (n *routeNode) add(pattern string, handlers HandlersChain) error {
+	if pattern == "" {
+		return fmt.Errorf("路由规则不能为空！")
+	}
+	segments := strings.Split(pattern, routeSeparator)
+	node := n
+	for i, segment := range segments {
+		switch {
+		case strings.HasPrefix(segment, routeParamPrefix):
+			name := segment[len(routeParamPrefix):]
+			if name == "" {
+				return fmt.Errorf("路由规则[%s]的参数名不能为空！", pattern)
+			}
+			if node.paramChild == nil {
+				node.paramChild = newRouteNode()
+				node.paramChild.name = name
+			} else if node.paramChild.name != name {
+				return fmt.Errorf("路由规则[%s]的参数[%s]与已注册的参数[%s]冲突！", pattern, name, node.paramChild.name)
+			}
+			node = node.paramChild
+		case strings.HasPrefix(segment, routeWildcardPrefix):
+			name := segment[len(routeWildcardPrefix):]
+			if i != len(segments)-1 {
+				return fmt.Errorf("路由规则[%s]的通配段只能在最后！", pattern)
+			}
+			if node.wildcardChild != nil {
+				return fmt.Errorf("路由规则[%s]与已注册的规则[%s]冲突！", pattern, node.wildcardChild.pattern)
+			}
+			node.wildcardChild = newRouteNode()
+			node.wildcardChild.name = name
+			node = node.wildcardChild
+		default:
+			child, ok := node.staticChildren[segment]
+			if !ok {
+				child = newRouteNode()
+				node.staticChildren[segment] = child
+			}
+			node = child
+		}
+	}
+	if node.handlers != nil {
+		return fmt.Errorf("路由规则[%s]与已注册的规则[%s]冲突！", pattern, node.pattern)
+	}
+	node.pattern = pattern
+	node.handlers = handlers
+	return nil
+}
+
+// find 查找匹配的路由 没有匹配返回nil
+func (n *routeNode) find(path string) (*routeNode, Params) {
+	var params Params
+	node := n.match(strings.Split(path, routeSeparator), &params)
+	if node == nil {
+		return nil, nil
+	}
+	return node, params
+}
+
+func (n *routeNode) match(segments []string, params *Params) *routeNode {
+	if len(segments) == 0 {
+		if n.handlers != nil {
+			return n
+		}
+		return nil
+	}
+	segment := segments[0]
+	if child, ok := n.staticChildren[segment]; ok {
+		if node := child.match(segments[1:], params); node != nil {
+			return node
+		}
+	}
+	if n.paramChild != nil && segment != "" {
+		paramLen := len(*params)
+		*params = append(*params, Param{Key: n.paramChild.name, Value: segment})
+		if node := n.paramChild.match(segments[1:], params); node != nil {
+			return node
+		}
+		*params = (*params)[:paramLen]
+	}
+	if n.wildcardChild != nil && n.wildcardChild.handlers != nil {
+		*params = append(*params, Param{Key: n.wildcardChild.name, Value: strings.Join(segments, routeSeparator)})
+		return n.wildcardChild
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package tgo
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"github.com/tgo-team/tgo-core/tgo/packets"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrClientOffline = errors.New("客户端不在线！")
+	ErrCmdTimeout    = errors.New("等待命令回复超时！")
+)
+
+// EncodePayload 编码命令的payload 实现了encoding.BinaryMarshaler使用二进制编码，否则使用JSON
+func EncodePayload(v interface{}) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if marshaler, ok := v.(encoding.BinaryMarshaler); ok {
+		return marshaler.MarshalBinary()
+	}
+	return json.Marshal(v)
+}
+
+// DecodePayload 解码命令的payload 实现了encoding.BinaryUnmarshaler使用二进制解码，否则使用JSON
+func DecodePayload(payload []byte, v interface{}) error {
+	if unmarshaler, ok := v.(encoding.BinaryUnmarshaler); ok {
+		return unmarshaler.UnmarshalBinary(payload)
+	}
+	return json.Unmarshal(payload, v)
+}
+
+// rpcManager 服务端发起的命令 等待客户端回复的Cmdack
+type rpcManager struct {
+	requestIDSequence uint64
+	pendingMap        map[uint64]*rpcPending
+	pendingLock       sync.Mutex
+}
+
+// rpcPending 等待回复的命令 只接受发送命令的连接回复的Cmdack
+type rpcPending struct {
+	conn      Conn
+	replyChan chan *packets.CmdackPacket
+}
+
+func newRPCManager() *rpcManager {
+	return &rpcManager{
+		pendingMap: map[uint64]*rpcPending{},
+	}
+}
+
+func (r *rpcManager) add(conn Conn) (uint64, chan *packets.CmdackPacket) {
+	requestID := atomic.AddUint64(&r.requestIDSequence, 1)
+	replyChan := make(chan *packets.CmdackPacket, 1)
+	r.pendingLock.Lock()
+	r.pendingMap[requestID] = &rpcPending{conn: conn, replyChan: replyChan}
+	r.pendingLock.Unlock()
+	return requestID, replyChan
+}
+
+func (r *rpcManager) remove(requestID uint64) {
+	r.pendingLock.Lock()
+	delete(r.pendingMap, requestID)
+	r.pendingLock.Unlock()
+}
+
+// complete 如果packet是连接conn对服务端发起命令的回复，交给等待的请求并返回true
+// 其他连接带上相同请求编号的Cmdack不会完成请求，按普通的包处理
+func (r *rpcManager) complete(packet packets.Packet, conn Conn) bool {
+	cmdackPacket, ok := packet.(*packets.CmdackPacket)
+	if !ok || cmdackPacket.RequestID == 0 {
+		return false
+	}
+	r.pendingLock.Lock()
+	pending, ok := r.pendingMap[cmdackPacket.RequestID]
+	if ok && pending.conn != conn {
+		ok = false
+	}
+	if ok {
+		delete(r.pendingMap, cmdackPacket.RequestID)
+	}
+	r.pendingLock.Unlock()
+	if !ok {
+		return false
+	}
+	pending.replyChan <- cmdackPacket
+	return true
+}
+
+// SendCmd 向客户端发送命令并等待客户端的Cmdack回复
+func (t *TGO) SendCmd(clientID uint64, cmd string, payload []byte, timeout time.Duration) (*packets.CmdackPacket, error) {
+	conn := t.ConnManager.GetConn(clientID)
+	if conn == nil {
+		return nil, ErrClientOffline
+	}
+	requestID, replyChan := t.rpc.add(conn)
+	defer t.rpc.remove(requestID)
+
+	cmdPacket := packets.NewCmdPacket(cmd, payload)
+	cmdPacket.RequestID = requestID
+	data, err := t.GetOpts().Pro.EncodePacket(cmdPacket)
+	if err != nil {
+		return nil, err
+	}
+	_, err = conn.Write(data)
+	if err != nil {
+		return nil, err
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case cmdackPacket := <-replyChan:
+		return cmdackPacket, nil
+	case <-timer.C:
+		return nil, ErrCmdTimeout
+	case <-t.exitChan:
+		return nil, ErrCmdTimeout
+	}
+}
+
+// CallCmd 向客户端发送命令（req按EncodePayload编码）并将回复的payload解码到resp（resp为nil不解码） 返回回复的状态
+func (t *TGO) CallCmd(clientID uint64, cmd string, req interface{}, resp interface{}, timeout time.Duration) (uint16, error) {
+	payload, err := EncodePayload(req)
+	if err != nil {
+		return 0, err
+	}
+	cmdackPacket, err := t.SendCmd(clientID, cmd, payload, timeout)
+	if err != nil {
+		return 0, err
+	}
+	if resp != nil && len(cmdackPacket.Payload) > 0 {
+		err = DecodePayload(cmdackPacket.Payload, resp)
+	}
+	return cmdackPacket.Status, err
+}
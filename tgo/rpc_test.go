@@ -0,0 +1,102 @@
+package tgo
+
+import (
+	"github.com/tgo-team/tgo-core/tgo/packets"
+	"strings"
+	"testing"
+	"time"
+)
+
+type rpcTestValue struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func TestTGO_CallCmd(t *testing.T) {
+	opts := NewOptions()
+	opts.Pro = &ProtocolTest{}
+	tg := startTGO(opts)
+	defer tg.Stop()
+
+	conn := &ServerConnTest{}
+	tg.ConnManager.AddConn(1, conn)
+	go func() {
+		for len(conn.Writes()) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		cmdackPacket := packets.NewCmdackPacket("device/info", packets.CmdackStatusSuccess, []byte(`{"name":"sensor","count":3}`))
+		cmdackPacket.RequestID = 1
+		tg.AcceptPacketChan <- NewPacketContext(cmdackPacket, conn)
+	}()
+	var resp rpcTestValue
+	status, err := tg.CallCmd(1, "device/info", &rpcTestValue{Name: "query"}, &resp, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != packets.CmdackStatusSuccess || resp.Name != "sensor" || resp.Count != 3 {
+		t.Fatalf("回复不正确！status: %d resp: %v", status, resp)
+	}
+	if !strings.Contains(conn.Writes()[0], "RequestID: 1") {
+		t.Fatalf("发送的命令应该带上请求编号，实际为%s", conn.Writes()[0])
+	}
+
+	_, err = tg.SendCmd(1, "device/info", nil, 10*time.Millisecond)
+	if err != ErrCmdTimeout {
+		t.Fatalf("没有回复应该超时，实际为%v", err)
+	}
+	_, err = tg.SendCmd(2, "device/info", nil, 10*time.Millisecond)
+	if err != ErrClientOffline {
+		t.Fatalf("客户端不在线应该返回ErrClientOffline，实际为%v", err)
+	}
+}
+
+func TestTGO_SendCmd_otherConn(t *testing.T) {
+	opts := NewOptions()
+	opts.Pro = &ProtocolTest{}
+	tg := startTGO(opts)
+	defer tg.Stop()
+
+	conn := &ServerConnTest{}
+	otherConn := &ServerConnTest{}
+	tg.ConnManager.AddConn(1, conn)
+	tg.ConnManager.AddConn(2, otherConn)
+	go func() {
+		for len(conn.Writes()) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		// 其他连接伪造的回复不能完成命令
+		cmdackPacket := packets.NewCmdackPacket("device/info", packets.CmdackStatusSuccess, []byte("other"))
+		cmdackPacket.RequestID = 1
+		tg.AcceptPacketChan <- NewPacketContext(cmdackPacket, otherConn)
+		cmdackPacket = packets.NewCmdackPacket("device/info", packets.CmdackStatusSuccess, []byte("self"))
+		cmdackPacket.RequestID = 1
+		tg.AcceptPacketChan <- NewPacketContext(cmdackPacket, conn)
+	}()
+	cmdackPacket, err := tg.SendCmd(1, "device/info", nil, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(cmdackPacket.Payload) != "self" {
+		t.Fatalf("应该只接受发送命令的连接的回复，实际为%s", cmdackPacket.Payload)
+	}
+}
+
+func TestMContext_ReplyValue(t *testing.T) {
+	r, conn := newTestRoute()
+	r.Match("cmd:echo", func(m *MContext) {
+		var req rpcTestValue
+		if err := m.BindCmd(&req); err != nil {
+			m.AbortWithError(NewCmdError(packets.CmdackStatusBadRequest, err.Error()))
+			return
+		}
+		req.Count++
+		m.ReplyValue(packets.CmdackStatusSuccess, req)
+	})
+	cmdPacket := packets.NewCmdPacket("echo", []byte(`{"name":"a","count":1}`))
+	cmdPacket.RequestID = 99
+	r.Serve(GetMContext(NewPacketContext(cmdPacket, conn)))
+	writes := conn.Writes()
+	if len(writes) != 1 || !strings.Contains(writes[0], `RequestID: 99 Payload:  {"name":"a","count":2}`) {
+		t.Fatalf("回复不正确！%v", writes)
+	}
+}
@@ -0,0 +1,211 @@
+// Package server tcp、websocket等server共用的有状态连接
+package server
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tgo-team/tgo-core/tgo"
+)
+
+// RawConn 底层连接（net.Conn、websocket连接等）
+type RawConn interface {
+	io.ReadWriteCloser
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+	SetDeadline(t time.Time) error
+	RemoteAddr() net.Addr
+}
+
+// Conn 实现tgo.StatefulConn
+// 第一个包（Connect）由Accept读取，认证成功后StartIOLoop开始读取之后的包，读取失败或关闭时通知TGO连接退出
+type Conn struct {
+	raw       RawConn
+	ctx       *tgo.Context
+	id        uint64
+	auth      int32
+	writeLock sync.Mutex
+	closeOnce sync.Once
+	exitChan  chan struct{}
+	onClose   func(conn *Conn)
+	loopWait  sync.WaitGroup
+}
+
+// NewConn 创建连接 onClose在连接关闭时调用（server用于移除连接）
+func NewConn(raw RawConn, ctx *tgo.Context, onClose func(conn *Conn)) *Conn {
+	return &Conn{
+		raw:      raw,
+		ctx:      ctx,
+		exitChan: make(chan struct{}),
+		onClose:  onClose,
+	}
+}
+
+func (c *Conn) Read(b []byte) (n int, err error) {
+	return c.raw.Read(b)
+}
+
+// Write 写入数据 可以在多个协程中调用
+// Write 写入数据 超过Options.MsgTimeout没有写完返回错误（客户端不读取时不会一直阻塞投递协程）
+func (c *Conn) Write(b []byte) (n int, err error) {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	if timeout := c.ctx.TGO.GetOpts().MsgTimeout; timeout > 0 {
+		c.raw.SetWriteDeadline(time.Now().Add(timeout))
+	}
+	return c.raw.Write(b)
+}
+
+// StartIOLoop 开始读取包
+func (c *Conn) StartIOLoop() {
+	c.loopWait.Add(1)
+	go c.readLoop()
+}
+
+func (c *Conn) readLoop() {
+	defer c.loopWait.Done()
+	tg := c.ctx.TGO
+	for {
+		c.extendReadDeadline()
+		packet, err := tg.GetOpts().Pro.DecodePacket(c)
+		if err != nil {
+			select {
+			case <-c.exitChan:
+			default:
+				if err != io.EOF {
+					tg.LogFields(tgo.DebugLevel, []tgo.Field{tgo.FieldClientID(c.GetID()), tgo.FieldRemoteAddr(c)}, "读取包失败！-> %v", err)
+				}
+			}
+			c.Close()
+			return
+		}
+		select {
+		case tg.AcceptPacketChan <- tgo.NewPacketContext(packet, c):
+		case <-c.exitChan:
+			return
+		}
+	}
+}
+
+// extendReadDeadline 超过MaxHeartbeatInterval没有收到包则断开（配置可以在运行时修改）
+func (c *Conn) extendReadDeadline() {
+	interval := c.ctx.TGO.GetOpts().MaxHeartbeatInterval
+	if interval > 0 {
+		c.raw.SetReadDeadline(time.Now().Add(interval))
+	}
+}
+
+// Close 关闭连接并通知TGO连接退出
+func (c *Conn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.exitChan)
+		err = c.raw.Close()
+		if c.IsAuth() {
+			c.ctx.TGO.AcceptConnExitChan <- c
+		}
+		// 通知退出后再从server移除 server停止时CloseAll会等待正在关闭的连接
+		if c.onClose != nil {
+			c.onClose(c)
+		}
+	})
+	return err
+}
+
+func (c *Conn) SetAuth(auth bool) {
+	if auth {
+		atomic.StoreInt32(&c.auth, 1)
+	} else {
+		atomic.StoreInt32(&c.auth, 0)
+	}
+}
+
+func (c *Conn) IsAuth() bool {
+	return atomic.LoadInt32(&c.auth) == 1
+}
+
+func (c *Conn) SetID(id uint64) {
+	atomic.StoreUint64(&c.id, id)
+}
+
+func (c *Conn) GetID() uint64 {
+	return atomic.LoadUint64(&c.id)
+}
+
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.raw.SetDeadline(t)
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.raw.RemoteAddr()
+}
+
+func (c *Conn) String() string {
+	return fmt.Sprintf("Conn[%d %s]", c.GetID(), c.raw.RemoteAddr())
+}
+
+// Accept 在连接自己的协程中读取第一个包（Connect）再交给TGO 读取第一个包同样受MaxHeartbeatInterval限制
+// 读取失败或者不是Connect包时关闭连接
+func Accept(ctx *tgo.Context, conn *Conn) {
+	conn.loopWait.Add(1)
+	go func() {
+		defer conn.loopWait.Done()
+		conn.extendReadDeadline()
+		packet, err := ctx.TGO.ReadConnect(conn)
+		if err != nil {
+			return
+		}
+		select {
+		case ctx.TGO.AcceptPacketChan <- tgo.NewPacketContext(packet, conn):
+		case <-conn.exitChan:
+		}
+	}()
+}
+
+// ConnSet server持有的连接 server停止时关闭所有连接
+type ConnSet struct {
+	conns map[*Conn]struct{}
+	sync.Mutex
+}
+
+func NewConnSet() *ConnSet {
+	return &ConnSet{conns: map[*Conn]struct{}{}}
+}
+
+func (s *ConnSet) Add(conn *Conn) {
+	s.Lock()
+	s.conns[conn] = struct{}{}
+	s.Unlock()
+}
+
+func (s *ConnSet) Remove(conn *Conn) {
+	s.Lock()
+	delete(s.conns, conn)
+	s.Unlock()
+}
+
+func (s *ConnSet) Len() int {
+	s.Lock()
+	defer s.Unlock()
+	return len(s.conns)
+}
+
+// CloseAll 关闭所有连接并等待连接的读取协程退出
+func (s *ConnSet) CloseAll() {
+	s.Lock()
+	conns := make([]*Conn, 0, len(s.conns))
+	for conn := range s.conns {
+		conns = append(conns, conn)
+	}
+	s.Unlock()
+	for _, conn := range conns {
+		conn.Close()
+	}
+	for _, conn := range conns {
+		conn.loopWait.Wait()
+	}
+}
@@ -0,0 +1,78 @@
+// Package tcp TCP server 监听Options.TCPAddress
+package tcp
+
+import (
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/tgo-team/tgo-core/tgo"
+	"github.com/tgo-team/tgo-core/tgo/server"
+)
+
+type Server struct {
+	ctx       *tgo.Context
+	listener  net.Listener
+	conns     *server.ConnSet
+	waitGroup sync.WaitGroup
+}
+
+// New 创建TCP server 例如: tgo.RegistryServer(tcp.New)
+func New(ctx *tgo.Context) tgo.Server {
+	return &Server{
+		ctx:   ctx,
+		conns: server.NewConnSet(),
+	}
+}
+
+// Start 开始监听 地址为空时不启动
+func (s *Server) Start() error {
+	address := s.ctx.TGO.GetOpts().TCPAddress
+	if address == "" {
+		return nil
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+	s.ctx.TGO.Info("TCP服务 -> %s", listener.Addr())
+	s.waitGroup.Add(1)
+	go s.acceptLoop()
+	return nil
+}
+
+func (s *Server) acceptLoop() {
+	defer s.waitGroup.Done()
+	for {
+		rawConn, err := s.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			s.ctx.TGO.Warn("TCP接受连接失败！-> %v", err)
+			continue
+		}
+		conn := server.NewConn(rawConn.(*net.TCPConn), s.ctx, s.conns.Remove)
+		s.conns.Add(conn)
+		server.Accept(s.ctx, conn)
+	}
+}
+
+// Addr 实际监听的地址
+func (s *Server) Addr() net.Addr {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+func (s *Server) Stop() error {
+	if s.listener == nil {
+		return nil
+	}
+	err := s.listener.Close()
+	s.waitGroup.Wait()
+	s.conns.CloseAll()
+	return err
+}
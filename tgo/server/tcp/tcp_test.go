@@ -0,0 +1,173 @@
+package tcp
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tgo-team/tgo-core/tgo"
+	"github.com/tgo-team/tgo-core/tgo/packets"
+	"github.com/tgo-team/tgo-core/tgo/protocol"
+	"github.com/tgo-team/tgo-core/tgo/storage"
+)
+
+func startTestTGO(t *testing.T) (*tgo.TGO, string) {
+	opts := tgo.NewOptions()
+	opts.DataPath = t.TempDir()
+	opts.TCPAddress = "127.0.0.1:0"
+	opts.HTTPAddress = ""
+	opts.LogLevel = tgo.ErrorLevel
+	opts.Pro = protocol.New()
+	opts.AdminToken = "token"
+	tg, err := tgo.NewBuilder(opts).Server(New).Storage(storage.New).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tg.MatchDefaultHandlers()
+	if err = tg.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tg.Stop() })
+	return tg, tg.Servers[0].(*Server).Addr().String()
+}
+
+func connect(t *testing.T, addr string, clientID uint64, password string) (net.Conn, packets.ConnReturnCode) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	writePacket(t, conn, packets.NewConnectPacket(clientID, password))
+	connack, ok := readPacket(t, conn).(*packets.ConnackPacket)
+	if !ok {
+		t.Fatal("第一个回复的包应该为Connack！")
+	}
+	return conn, connack.ReturnCode
+}
+
+func writePacket(t *testing.T, conn net.Conn, packet packets.Packet) {
+	data, err := protocol.Encode(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = conn.Write(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readPacket(t *testing.T, conn net.Conn) packets.Packet {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	packet, err := protocol.Decode(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return packet
+}
+
+func TestServer_SendMessage(t *testing.T) {
+	tg, addr := startTestTGO(t)
+	tg.Storage.AddClient(tgo.NewClient(1, "111"))
+	tg.Storage.AddClient(tgo.NewClient(2, "222"))
+
+	if _, code := connect(t, addr, 1, "wrong"); code != packets.ConnReturnCodePasswordOrUnameError {
+		t.Fatalf("密码错误应该返回%d，实际为%d", packets.ConnReturnCodePasswordOrUnameError, code)
+	}
+	sender, code := connect(t, addr, 1, "111")
+	if code != packets.ConnReturnCodeSuccess {
+		t.Fatalf("连接失败！-> %d", code)
+	}
+	receiver, code := connect(t, addr, 2, "222")
+	if code != packets.ConnReturnCodeSuccess {
+		t.Fatalf("连接失败！-> %d", code)
+	}
+
+	writePacket(t, sender, packets.NewPingreqPacket())
+	if _, ok := readPacket(t, sender).(*packets.PingrespPacket); !ok {
+		t.Fatal("应该回复Pingresp！")
+	}
+
+	writePacket(t, sender, packets.NewMessagePacket(100, 2, []byte("hello")))
+	msgack, ok := readPacket(t, sender).(*packets.MsgackPacket)
+	if !ok || len(msgack.MessageIDs) != 1 || msgack.MessageIDs[0] != 100 {
+		t.Fatalf("应该回复消息[100]的Msgack！-> %v", msgack)
+	}
+	message, ok := readPacket(t, receiver).(*packets.MessagePacket)
+	if !ok || message.MessageID != 100 || message.From != 1 || string(message.Payload) != "hello" {
+		t.Fatalf("收到的消息不正确！-> %v", message)
+	}
+
+	writePacket(t, receiver, packets.NewMsgackPacket([]uint64{100}))
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		msgList, _ := tg.Storage.GetMsgInChannel(2, 1, 10)
+		if len(msgList) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("确认后的消息应该从管道中移除！")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServer_AdminKick(t *testing.T) {
+	tg, addr := startTestTGO(t)
+	tg.Storage.AddClient(tgo.NewClient(1, "111"))
+	conn, code := connect(t, addr, 1, "111")
+	if code != packets.ConnReturnCodeSuccess {
+		t.Fatalf("连接失败！-> %d", code)
+	}
+	req := httptest.NewRequest("DELETE", "/admin/conns/1", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	w := httptest.NewRecorder()
+	tg.HTTPMux().ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("应该返回204，实际为%d -> %s", w.Code, w.Body.String())
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := protocol.Decode(conn); err == nil {
+		t.Fatal("连接应该被断开！")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for tg.ConnManager.Len() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("断开的连接应该从ConnManager移除！")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestServer_firstPacket 不发送数据的连接不影响其他连接 第一个包不是Connect时关闭连接
+func TestServer_firstPacket(t *testing.T) {
+	tg, addr := startTestTGO(t)
+	tg.Storage.AddClient(tgo.NewClient(1, "111"))
+	idle, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idle.Close()
+	if _, code := connect(t, addr, 1, "111"); code != packets.ConnReturnCodeSuccess {
+		t.Fatalf("连接失败！-> %d", code)
+	}
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	writePacket(t, conn, packets.NewPingreqPacket())
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err = protocol.Decode(conn); err == nil {
+		t.Fatal("第一个包不是Connect时应该断开连接！")
+	}
+	server := tg.Servers[0].(*Server)
+	deadline := time.Now().Add(5 * time.Second)
+	for server.conns.Len() != 2 { // 认证的连接和不发送数据的连接
+		if time.Now().After(deadline) {
+			t.Fatalf("断开的连接应该从server移除！-> %d", server.conns.Len())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,302 @@
+// Package websocket WebSocket server 监听Options.WebSocketAddress
+// 包使用二进制帧传输，一个帧可以包含多个包，一个包也可以分在多个帧中
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tgo-team/tgo-core/tgo"
+	"github.com/tgo-team/tgo-core/tgo/server"
+)
+
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+type Server struct {
+	ctx        *tgo.Context
+	listener   net.Listener
+	httpServer *http.Server
+	conns      *server.ConnSet
+	waitGroup  sync.WaitGroup
+}
+
+// New 创建WebSocket server 例如: tgo.RegistryServer(websocket.New)
+func New(ctx *tgo.Context) tgo.Server {
+	return &Server{
+		ctx:   ctx,
+		conns: server.NewConnSet(),
+	}
+}
+
+// Start 开始监听 地址为空时不启动
+func (s *Server) Start() error {
+	address := s.ctx.TGO.GetOpts().WebSocketAddress
+	if address == "" {
+		return nil
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+	s.httpServer = &http.Server{Handler: http.HandlerFunc(s.handleUpgrade)}
+	s.ctx.TGO.Info("WebSocket服务 -> %s", listener.Addr())
+	s.waitGroup.Add(1)
+	go func() {
+		defer s.waitGroup.Done()
+		if err := s.httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			s.ctx.TGO.Error("WebSocket服务退出！-> %v", err)
+		}
+	}()
+	return nil
+}
+
+// Addr 实际监听的地址
+func (s *Server) Addr() net.Addr {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+func (s *Server) Stop() error {
+	if s.httpServer == nil {
+		return nil
+	}
+	err := s.httpServer.Close() // 已升级的连接不受http.Server管理
+	s.waitGroup.Wait()
+	s.conns.CloseAll()
+	return err
+}
+
+// handleUpgrade 完成WebSocket握手并将连接交给TGO
+func (s *Server) handleUpgrade(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet || !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") || key == "" {
+		http.Error(w, "需要WebSocket连接！", http.StatusBadRequest)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "不支持WebSocket！", http.StatusInternalServerError)
+		return
+	}
+	netConn, rw, err := hijacker.Hijack()
+	if err != nil {
+		s.ctx.TGO.Warn("WebSocket握手失败！-> %v", err)
+		return
+	}
+	response := "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: " + AcceptKey(key) + "\r\n\r\n"
+	if _, err = netConn.Write([]byte(response)); err != nil {
+		netConn.Close()
+		return
+	}
+	wsConn := newWSConn(netConn, rw.Reader, false)
+	wsConn.maxFrameSize = int64(s.ctx.TGO.GetOpts().MaxMsgSize) + maxFrameOverhead
+	conn := server.NewConn(wsConn, s.ctx, s.conns.Remove)
+	s.conns.Add(conn)
+	server.Accept(s.ctx, conn)
+}
+
+// AcceptKey 通过Sec-WebSocket-Key计算Sec-WebSocket-Accept
+func AcceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func headerContains(header http.Header, name, value string) bool {
+	for _, v := range header[http.CanonicalHeaderKey(name)] {
+		for _, token := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ---------- frame ----------
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// maxFrameOverhead 一个帧除了消息内容以外最多还可以有多少字节（包头等）
+const maxFrameOverhead = 1024
+
+var (
+	errFrameTooLarge = errors.New("WebSocket控制帧不合法！")
+	errFrameLength   = errors.New("WebSocket帧长度超过限制！")
+	errFrameMask     = errors.New("WebSocket帧的掩码不正确！")
+)
+
+// wsConn 将WebSocket的数据帧当作字节流读写 实现server.RawConn
+type wsConn struct {
+	net.Conn
+	reader       *bufio.Reader
+	client       bool  // 客户端发送的帧需要掩码 服务端发送的帧不能有掩码
+	maxFrameSize int64 // 读取的帧最大长度 0表示不限制
+	remaining    int64
+	maskKey      [4]byte
+	masked       bool
+	maskPos      int
+	writeLock    sync.Mutex
+}
+
+func newWSConn(conn net.Conn, reader *bufio.Reader, client bool) *wsConn {
+	if reader == nil {
+		reader = bufio.NewReader(conn)
+	}
+	return &wsConn{Conn: conn, reader: reader, client: client}
+}
+
+func (c *wsConn) Read(b []byte) (int, error) {
+	for c.remaining == 0 {
+		if err := c.nextFrame(); err != nil {
+			return 0, err
+		}
+	}
+	if int64(len(b)) > c.remaining {
+		b = b[:c.remaining]
+	}
+	n, err := c.reader.Read(b)
+	if c.masked {
+		for i := 0; i < n; i++ {
+			b[i] ^= c.maskKey[c.maskPos%4]
+			c.maskPos++
+		}
+	}
+	c.remaining -= int64(n)
+	return n, err
+}
+
+// nextFrame 读取下一个帧头 控制帧在这里处理
+func (c *wsConn) nextFrame() error {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return err
+	}
+	opcode := header[0] & 0x0f
+	masked := header[1]&0x80 > 0
+	length := int64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err := io.ReadFull(c.reader, ext); err != nil {
+			return err
+		}
+		length = int64(ext[0])<<8 | int64(ext[1])
+	case 127:
+		ext := make([]byte, 8)
+		if _, err := io.ReadFull(c.reader, ext); err != nil {
+			return err
+		}
+		if ext[0]&0x80 > 0 { // 最高位必须为0
+			return errFrameLength
+		}
+		length = 0
+		for _, v := range ext {
+			length = length<<8 | int64(v)
+		}
+	}
+	if c.maxFrameSize > 0 && length > c.maxFrameSize {
+		return errFrameLength
+	}
+	if masked == c.client { // RFC6455 5.1
+		return errFrameMask
+	}
+	var maskKey [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.reader, maskKey[:]); err != nil {
+			return err
+		}
+	}
+	switch opcode {
+	case opContinuation, opText, opBinary:
+		c.remaining = length
+		c.masked = masked
+		c.maskKey = maskKey
+		c.maskPos = 0
+		return nil
+	}
+	// 控制帧
+	if length > 125 {
+		return errFrameTooLarge
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= maskKey[i%4]
+		}
+	}
+	switch opcode {
+	case opPing:
+		return c.writeFrame(opPong, payload)
+	case opClose:
+		c.writeFrame(opClose, payload)
+		return errClosed
+	}
+	return nil
+}
+
+var errClosed = errors.New("WebSocket连接已关闭！")
+
+func (c *wsConn) Write(b []byte) (int, error) {
+	if err := c.writeFrame(opBinary, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	frame := make([]byte, 0, len(payload)+14)
+	frame = append(frame, 0x80|opcode)
+	var maskBit byte
+	if c.client {
+		maskBit = 0x80
+	}
+	length := len(payload)
+	switch {
+	case length < 126:
+		frame = append(frame, maskBit|byte(length))
+	case length <= 0xffff:
+		frame = append(frame, maskBit|126, byte(length>>8), byte(length))
+	default:
+		frame = append(frame, maskBit|127)
+		for i := 7; i >= 0; i-- {
+			frame = append(frame, byte(uint64(length)>>(uint(i)*8)))
+		}
+	}
+	if c.client {
+		maskKey := [4]byte{byte(time.Now().UnixNano()), 0x5a, 0xa5, byte(length)}
+		frame = append(frame, maskKey[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		for i := start; i < len(frame); i++ {
+			frame[i] ^= maskKey[(i-start)%4]
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+	_, err := c.Conn.Write(frame)
+	return err
+}
@@ -0,0 +1,98 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/tgo-team/tgo-core/tgo"
+	"github.com/tgo-team/tgo-core/tgo/packets"
+	"github.com/tgo-team/tgo-core/tgo/protocol"
+	"github.com/tgo-team/tgo-core/tgo/storage"
+)
+
+func TestAcceptKey(t *testing.T) {
+	// RFC6455 1.3的例子
+	if key := AcceptKey("dGhlIHNhbXBsZSBub25jZQ=="); key != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Sec-WebSocket-Accept不正确！-> %s", key)
+	}
+}
+
+func TestServer_Connect(t *testing.T) {
+	opts := tgo.NewOptions()
+	opts.DataPath = t.TempDir()
+	opts.WebSocketAddress = "127.0.0.1:0"
+	opts.HTTPAddress = ""
+	opts.LogLevel = tgo.ErrorLevel
+	opts.Pro = protocol.New()
+	tg, err := tgo.NewBuilder(opts).Server(New).Storage(storage.New).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tg.MatchDefaultHandlers()
+	if err = tg.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer tg.Stop()
+	tg.Storage.AddClient(tgo.NewClient(1, "111"))
+
+	netConn, err := net.Dial("tcp", tg.Servers[0].(*Server).Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer netConn.Close()
+	netConn.SetDeadline(time.Now().Add(5 * time.Second))
+	netConn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n"))
+	reader := bufio.NewReader(netConn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("握手失败！-> %d %v", resp.StatusCode, resp.Header)
+	}
+	conn := newWSConn(netConn, reader, true)
+
+	for _, packet := range []packets.Packet{packets.NewConnectPacket(1, "111"), packets.NewPingreqPacket()} {
+		data, _ := protocol.Encode(packet)
+		if _, err = conn.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = conn.writeFrame(opPing, []byte("ping")); err != nil { // 控制帧不影响包的读取
+		t.Fatal(err)
+	}
+	connack, err := protocol.Decode(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, ok := connack.(*packets.ConnackPacket); !ok || p.ReturnCode != packets.ConnReturnCodeSuccess {
+		t.Fatalf("应该回复连接成功！-> %v", connack)
+	}
+	pingresp, err := protocol.Decode(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := pingresp.(*packets.PingrespPacket); !ok {
+		t.Fatalf("应该回复Pingresp！-> %v", pingresp)
+	}
+}
+
+// TestWSConn_invalidFrame 长度溢出、超过限制、没有掩码的帧返回错误
+func TestWSConn_invalidFrame(t *testing.T) {
+	cases := map[string][]byte{
+		"长度最高位为1": {0x82, 0x80 | 127, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 1, 2, 3, 4},
+		"超过限制":    {0x82, 0x80 | 126, 0x10, 0x00, 1, 2, 3, 4},
+		"没有掩码":    {0x82, 3, 'a', 'b', 'c'},
+	}
+	for name, data := range cases {
+		conn := newWSConn(nil, bufio.NewReader(bytes.NewReader(data)), false)
+		conn.maxFrameSize = 1024
+		if _, err := conn.Read(make([]byte, 16)); err != errFrameLength && err != errFrameMask {
+			t.Fatalf("%s: 应该返回帧错误！-> %v", name, err)
+		}
+	}
+}
@@ -1,7 +1,12 @@
 package tgo
 
-type TestServer struct {
+import (
+	"github.com/tgo-team/tgo-core/tgo/packets"
+	"sync"
+	"time"
+)
 
+type TestServer struct {
 }
 
 func (ts *TestServer) Start() error {
@@ -9,4 +14,69 @@ func (ts *TestServer) Start() error {
 }
 func (ts *TestServer) Stop() error {
 	return nil
-}
\ No newline at end of file
+}
+
+// ServerConnTest 记录写入数据的连接
+type ServerConnTest struct {
+	writes []string
+	sync.Mutex
+}
+
+func (c *ServerConnTest) Read(b []byte) (n int, err error) {
+	return 0, nil
+}
+
+func (c *ServerConnTest) Write(b []byte) (n int, err error) {
+	c.Lock()
+	c.writes = append(c.writes, string(b))
+	c.Unlock()
+	return len(b), nil
+}
+
+func (c *ServerConnTest) Writes() []string {
+	c.Lock()
+	defer c.Unlock()
+	return append([]string{}, c.writes...)
+}
+
+// ProtocolTest 将包编码为包的字符串描述
+type ProtocolTest struct {
+}
+
+func (p *ProtocolTest) DecodePacket(reader Conn) (packets.Packet, error) {
+	return nil, nil
+}
+
+func (p *ProtocolTest) EncodePacket(packet packets.Packet) ([]byte, error) {
+	return []byte(packet.String()), nil
+}
+
+// StatefulConnTest 有状态的测试连接
+type StatefulConnTest struct {
+	ServerConnTest
+	id   uint64
+	auth bool
+}
+
+func (c *StatefulConnTest) StartIOLoop() {
+}
+
+func (c *StatefulConnTest) SetAuth(auth bool) {
+	c.auth = auth
+}
+
+func (c *StatefulConnTest) IsAuth() bool {
+	return c.auth
+}
+
+func (c *StatefulConnTest) SetID(id uint64) {
+	c.id = id
+}
+
+func (c *StatefulConnTest) GetID() uint64 {
+	return c.id
+}
+
+func (c *StatefulConnTest) SetDeadline(t time.Time) error {
+	return nil
+}
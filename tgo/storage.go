@@ -9,6 +9,7 @@ import (
 type Client struct {
 	ClientID uint64
 	Password string
+	Tags     []string // 客户端标签（广播管道按标签定向投递）
 }
 
 func NewClient(clientID uint64, password string) *Client {
@@ -18,12 +19,24 @@ func (c *Client) MarshalBinary() (data []byte, err error) {
 	var body bytes.Buffer
 	body.Write(packets.EncodeUint64(c.ClientID))
 	body.Write(packets.EncodeString(c.Password))
+	body.Write(packets.EncodeUint16(uint16(len(c.Tags))))
+	for _, tag := range c.Tags {
+		body.Write(packets.EncodeString(tag))
+	}
 	return body.Bytes(), nil
 }
 
 func (c *Client) UnmarshalBinary(data []byte) error {
 	c.ClientID = binary.BigEndian.Uint64(data[:8])
-	c.Password = packets.DecodeString(bytes.NewBuffer(data[8:]))
+	buff := bytes.NewBuffer(data[8:])
+	c.Password = packets.DecodeString(buff)
+	if buff.Len() >= 2 { // 兼容没有标签的旧数据
+		tagCount := int(packets.DecodeUint16(buff))
+		c.Tags = make([]string, 0, tagCount)
+		for i := 0; i < tagCount; i++ {
+			c.Tags = append(c.Tags, packets.DecodeString(buff))
+		}
+	}
 	return nil
 }
 
@@ -43,3 +56,23 @@ type Storage interface {
 	UpdateClient(clientID uint64, password string) error // 修改客户端
 	GetClient(clientID uint64) (*Client, error)          // 获取客户端
 }
+
+// CursorStorage 支持读取游标的存储（可选实现，群组管道读扩散需要）
+type CursorStorage interface {
+	GetChannelIDs(clientID uint64) ([]uint64, error)                                      // 获取客户端绑定的所有管道
+	GetReadCursor(clientID uint64, channelID uint64) (uint64, error)                      // 获取客户端在管道内的读取游标（最后读取的消息ID） 0表示没有游标
+	UpdateReadCursor(clientID uint64, channelID uint64, messageID uint64) error           // 更新客户端在管道内的读取游标
+	GetMsgInChannelAfter(channelID uint64, messageID uint64, limit int64) ([]*Msg, error) // 获取管道内消息[messageID]之后的消息 messageID为0表示从头开始
+	GetLastMsgID(channelID uint64) (uint64, error)                                        // 获取管道内最后一条消息的ID 没有消息返回0
+}
+
+// ChannelTypeStorage 支持按类型查询管道的存储（可选实现，广播管道需要）
+type ChannelTypeStorage interface {
+	GetChannelIDsByType(channelType int) ([]uint64, error) // 获取某个类型的所有管道
+}
+
+// RetainStorage 支持保留消息的存储（可选实现，没有实现时保留消息只保存在内存）
+type RetainStorage interface {
+	SetRetainMsg(channelID uint64, msg *Msg) error // 设置管道的保留消息 msg为nil表示清除
+	GetRetainMsg(channelID uint64) (*Msg, error)   // 获取管道的保留消息 没有返回nil
+}
@@ -0,0 +1,567 @@
+// Package storage 基于磁盘的存储 数据保存在内存中，修改追加写入DataPath/storage下的日志文件，启动时重放日志恢复数据
+// NewMemory创建的存储不写日志，只保存在内存中
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tgo-team/tgo-core/tgo"
+)
+
+const journalName = "journal.log"
+
+// 日志记录的操作
+const (
+	opAddMsg       = "add_msg"
+	opRemoveMsg    = "remove_msg"
+	opAddChannel   = "add_channel"
+	opBind         = "bind"
+	opAddClient    = "add_client"
+	opUpdateClient = "update_client"
+	opReadCursor   = "read_cursor"
+	opRetainMsg    = "retain_msg"
+)
+
+// record 日志中的一条记录
+type record struct {
+	Op         string            `json:"op"`
+	ChannelID  uint64            `json:"channel_id,omitempty"`
+	ClientID   uint64            `json:"client_id,omitempty"`
+	MessageID  uint64            `json:"message_id,omitempty"`
+	MessageIDs []uint64          `json:"message_ids,omitempty"`
+	Password   string            `json:"password,omitempty"`
+	Msg        *tgo.Msg          `json:"msg,omitempty"`
+	Channel    *tgo.ChannelModel `json:"channel,omitempty"`
+	Client     *tgo.Client       `json:"client,omitempty"`
+}
+
+// DiskStorage 实现tgo.Storage、tgo.CursorStorage、tgo.ChannelTypeStorage和tgo.RetainStorage
+// 每SyncEvery次修改或者每SyncTimeout同步一次磁盘，日志超过MaxBytesPerFile并且超过上次快照的2倍时压缩为当前数据的快照
+type DiskStorage struct {
+	ctx            *tgo.Context
+	path           string // 日志文件 为空时只保存在内存中
+	storageMsgChan chan *tgo.MsgContext
+	file           *os.File
+	writer         *bufio.Writer
+	size           int64
+	snapshotSize   int64 // 上次压缩后的日志大小
+	unsynced       int64
+	exitChan       chan struct{}
+	waitGroup      sync.WaitGroup
+
+	channelMsgMap map[uint64][]*tgo.Msg
+	channelMap    map[uint64]*tgo.ChannelModel
+	clientMap     map[uint64]*tgo.Client
+	bindMap       map[uint64][]uint64 // 管道 -> 客户端
+	readCursorMap map[string]uint64
+	retainMsgMap  map[uint64]*tgo.Msg
+	sync.RWMutex
+}
+
+// New 创建磁盘存储 例如: tgo.RegistryStorage(storage.New)
+func New(ctx *tgo.Context) tgo.Storage {
+	s, err := Open(ctx)
+	if err != nil {
+		ctx.TGO.Error("打开存储失败！-> %v", err)
+		return nil
+	}
+	return s
+}
+
+// NewMemory 创建只保存在内存中的存储 重启后数据丢失 用于测试（见tgotest）
+func NewMemory(ctx *tgo.Context) tgo.Storage {
+	return newDiskStorage(ctx, "")
+}
+
+func newDiskStorage(ctx *tgo.Context, path string) *DiskStorage {
+	return &DiskStorage{
+		ctx:            ctx,
+		path:           path,
+		storageMsgChan: make(chan *tgo.MsgContext, ctx.TGO.GetOpts().MemQueueSize),
+		exitChan:       make(chan struct{}),
+		channelMsgMap:  map[uint64][]*tgo.Msg{},
+		channelMap:     map[uint64]*tgo.ChannelModel{},
+		clientMap:      map[uint64]*tgo.Client{},
+		bindMap:        map[uint64][]uint64{},
+		readCursorMap:  map[string]uint64{},
+		retainMsgMap:   map[uint64]*tgo.Msg{},
+	}
+}
+
+// Open 打开DataPath/storage下的存储并重放日志
+func Open(ctx *tgo.Context) (*DiskStorage, error) {
+	opts := ctx.TGO.GetOpts()
+	dir := filepath.Join(opts.DataPath, "storage")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := newDiskStorage(ctx, filepath.Join(dir, journalName))
+	if err := s.replay(); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	s.file = file
+	s.writer = bufio.NewWriter(file)
+	s.size = info.Size()
+	if opts.SyncTimeout > 0 {
+		s.waitGroup.Add(1)
+		go s.syncLoop(opts.SyncTimeout)
+	}
+	return s, nil
+}
+
+// replay 重放日志 最后一行不完整（写入时宕机）时忽略
+func (s *DiskStorage) replay() error {
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	lineNum := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				s.ctx.TGO.Warn("忽略存储日志最后不完整的一行！")
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		lineNum++
+		var r record
+		if err = json.Unmarshal(line, &r); err != nil {
+			return fmt.Errorf("存储日志第%d行格式不正确！-> %v", lineNum, err)
+		}
+		s.applyRecord(&r)
+	}
+}
+
+// applyRecord 将记录应用到内存（调用方需持有锁或者在重放时调用）
+func (s *DiskStorage) applyRecord(r *record) {
+	switch r.Op {
+	case opAddMsg:
+		s.channelMsgMap[r.ChannelID] = append(s.channelMsgMap[r.ChannelID], r.Msg)
+	case opRemoveMsg:
+		s.removeMsg(r.MessageIDs, r.ChannelID)
+	case opAddChannel:
+		s.channelMap[r.Channel.ChannelID] = r.Channel
+	case opBind:
+		for _, clientID := range s.bindMap[r.ChannelID] {
+			if clientID == r.ClientID {
+				return
+			}
+		}
+		s.bindMap[r.ChannelID] = append(s.bindMap[r.ChannelID], r.ClientID)
+	case opAddClient:
+		s.clientMap[r.Client.ClientID] = r.Client
+	case opUpdateClient:
+		if c := s.clientMap[r.ClientID]; c != nil {
+			c.Password = r.Password
+		}
+	case opReadCursor:
+		s.readCursorMap[cursorKey(r.ClientID, r.ChannelID)] = r.MessageID
+	case opRetainMsg:
+		if r.Msg == nil {
+			delete(s.retainMsgMap, r.ChannelID)
+		} else {
+			s.retainMsgMap[r.ChannelID] = r.Msg
+		}
+	}
+}
+
+func (s *DiskStorage) removeMsg(messageIDs []uint64, channelID uint64) {
+	removeIDs := make(map[uint64]struct{}, len(messageIDs))
+	for _, messageID := range messageIDs {
+		removeIDs[messageID] = struct{}{}
+	}
+	msgList := s.channelMsgMap[channelID]
+	remain := msgList[:0]
+	for _, msg := range msgList {
+		if _, ok := removeIDs[msg.MessageID]; !ok {
+			remain = append(remain, msg)
+		}
+	}
+	for i := len(remain); i < len(msgList); i++ {
+		msgList[i] = nil
+	}
+	if len(remain) == 0 {
+		delete(s.channelMsgMap, channelID)
+		return
+	}
+	s.channelMsgMap[channelID] = remain
+}
+
+// write 写入日志并应用到内存
+func (s *DiskStorage) write(r *record) error {
+	if s.path == "" {
+		s.Lock()
+		s.applyRecord(r)
+		s.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	if s.file == nil {
+		return os.ErrClosed
+	}
+	if _, err = s.writer.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	s.size += int64(len(data) + 1)
+	s.applyRecord(r)
+	s.unsynced++
+	opts := s.ctx.TGO.GetOpts()
+	// 当前数据本身超过MaxBytesPerFile时 避免每次写入都压缩
+	if opts.MaxBytesPerFile > 0 && s.size > max(opts.MaxBytesPerFile, 2*s.snapshotSize) {
+		return s.compact()
+	}
+	if s.unsynced >= opts.SyncEvery {
+		return s.sync()
+	}
+	return nil
+}
+
+// sync 同步磁盘（调用方需持有锁）
+func (s *DiskStorage) sync() error {
+	if s.unsynced == 0 {
+		return nil
+	}
+	if err := s.writer.Flush(); err != nil {
+		return err
+	}
+	s.unsynced = 0
+	return s.file.Sync()
+}
+
+func (s *DiskStorage) syncLoop(interval time.Duration) {
+	defer s.waitGroup.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.Lock()
+			if s.file != nil {
+				if err := s.sync(); err != nil {
+					s.ctx.TGO.Error("同步存储失败！-> %v", err)
+				}
+			}
+			s.Unlock()
+		case <-s.exitChan:
+			return
+		}
+	}
+}
+
+// compact 将当前数据写为新的日志替换旧日志（调用方需持有锁）
+func (s *DiskStorage) compact() error {
+	tmpPath := s.path + ".tmp"
+	tmpFile, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(tmpFile)
+	encoder := json.NewEncoder(writer)
+	var size int64
+	err = s.snapshot(func(r *record) error {
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		size += int64(len(data) + 1)
+		return encoder.Encode(r)
+	})
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	tmpFile.Close()
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	s.writer.Flush()
+	s.file.Close()
+	if err = os.Rename(tmpPath, s.path); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		s.file = nil
+		return err
+	}
+	s.file = file
+	s.writer = bufio.NewWriter(file)
+	s.size = size
+	s.snapshotSize = size
+	s.unsynced = 0
+	s.ctx.TGO.Debug("存储日志压缩完成 -> %d bytes", size)
+	return nil
+}
+
+// snapshot 以记录的形式输出当前数据（调用方需持有锁）
+func (s *DiskStorage) snapshot(fn func(r *record) error) error {
+	for _, c := range s.clientMap {
+		if err := fn(&record{Op: opAddClient, Client: c}); err != nil {
+			return err
+		}
+	}
+	for _, c := range s.channelMap {
+		if err := fn(&record{Op: opAddChannel, Channel: c}); err != nil {
+			return err
+		}
+	}
+	for channelID, clientIDs := range s.bindMap {
+		for _, clientID := range clientIDs {
+			if err := fn(&record{Op: opBind, ChannelID: channelID, ClientID: clientID}); err != nil {
+				return err
+			}
+		}
+	}
+	for channelID, msgList := range s.channelMsgMap {
+		for _, msg := range msgList {
+			if err := fn(&record{Op: opAddMsg, ChannelID: channelID, Msg: msg}); err != nil {
+				return err
+			}
+		}
+	}
+	for key, messageID := range s.readCursorMap {
+		var clientID, channelID uint64
+		fmt.Sscanf(key, "%d-%d", &clientID, &channelID)
+		if err := fn(&record{Op: opReadCursor, ClientID: clientID, ChannelID: channelID, MessageID: messageID}); err != nil {
+			return err
+		}
+	}
+	for channelID, msg := range s.retainMsgMap {
+		if err := fn(&record{Op: opRetainMsg, ChannelID: channelID, Msg: msg}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close 同步并关闭日志文件
+func (s *DiskStorage) Close() error {
+	s.Lock()
+	if s.file == nil {
+		s.Unlock()
+		return nil
+	}
+	close(s.exitChan)
+	err := s.sync()
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	s.file = nil
+	s.Unlock()
+	s.waitGroup.Wait()
+	return err
+}
+
+// ---------- 消息 ----------
+
+func (s *DiskStorage) StorageMsgChan() chan *tgo.MsgContext {
+	return s.storageMsgChan
+}
+
+func (s *DiskStorage) AddMsgInChannel(msg *tgo.Msg, channelID uint64) error {
+	msgContext := tgo.NewMsgContext(msg, channelID) // 链路信息不保存
+	if err := s.write(&record{Op: opAddMsg, ChannelID: channelID, Msg: storedMsg(msg)}); err != nil {
+		return err
+	}
+	s.storageMsgChan <- msgContext
+	return nil
+}
+
+func (s *DiskStorage) RemoveMsgInChannel(messageIDs []uint64, channelID uint64) error {
+	if len(messageIDs) == 0 {
+		return nil
+	}
+	return s.write(&record{Op: opRemoveMsg, ChannelID: channelID, MessageIDs: messageIDs})
+}
+
+// GetMsgInChannel 分页获取管道内的消息 pageIndex从1开始
+func (s *DiskStorage) GetMsgInChannel(channelID uint64, pageIndex int64, pageSize int64) ([]*tgo.Msg, error) {
+	if pageIndex < 1 || pageSize <= 0 {
+		return nil, nil
+	}
+	s.RLock()
+	defer s.RUnlock()
+	msgList := s.channelMsgMap[channelID]
+	start := (pageIndex - 1) * pageSize
+	if start >= int64(len(msgList)) {
+		return nil, nil
+	}
+	end := start + pageSize
+	if end > int64(len(msgList)) {
+		end = int64(len(msgList))
+	}
+	return append([]*tgo.Msg(nil), msgList[start:end]...), nil
+}
+
+func (s *DiskStorage) GetMsgInChannelAfter(channelID uint64, messageID uint64, limit int64) ([]*tgo.Msg, error) {
+	s.RLock()
+	defer s.RUnlock()
+	msgList := s.channelMsgMap[channelID]
+	start := 0
+	if messageID != 0 {
+		for i, msg := range msgList {
+			if msg.MessageID == messageID {
+				start = i + 1
+				break
+			}
+		}
+	}
+	msgList = msgList[start:]
+	if int64(len(msgList)) > limit {
+		msgList = msgList[:limit]
+	}
+	return append([]*tgo.Msg(nil), msgList...), nil
+}
+
+func (s *DiskStorage) GetLastMsgID(channelID uint64) (uint64, error) {
+	s.RLock()
+	defer s.RUnlock()
+	msgList := s.channelMsgMap[channelID]
+	if len(msgList) == 0 {
+		return 0, nil
+	}
+	return msgList[len(msgList)-1].MessageID, nil
+}
+
+// ---------- 管道 ----------
+
+func (s *DiskStorage) AddChannel(c *tgo.ChannelModel) error {
+	model := *c
+	return s.write(&record{Op: opAddChannel, Channel: &model})
+}
+
+func (s *DiskStorage) GetChannel(channelID uint64) (*tgo.ChannelModel, error) {
+	s.RLock()
+	defer s.RUnlock()
+	return s.channelMap[channelID], nil
+}
+
+func (s *DiskStorage) GetChannelIDsByType(channelType int) ([]uint64, error) {
+	s.RLock()
+	defer s.RUnlock()
+	channelIDs := make([]uint64, 0)
+	for channelID, model := range s.channelMap {
+		if model.ChannelType == channelType {
+			channelIDs = append(channelIDs, channelID)
+		}
+	}
+	sort.Slice(channelIDs, func(i, j int) bool { return channelIDs[i] < channelIDs[j] })
+	return channelIDs, nil
+}
+
+func (s *DiskStorage) Bind(clientID uint64, channelID uint64) error {
+	return s.write(&record{Op: opBind, ChannelID: channelID, ClientID: clientID})
+}
+
+func (s *DiskStorage) GetClientIDs(channelID uint64) ([]uint64, error) {
+	s.RLock()
+	defer s.RUnlock()
+	return append([]uint64(nil), s.bindMap[channelID]...), nil
+}
+
+func (s *DiskStorage) GetChannelIDs(clientID uint64) ([]uint64, error) {
+	s.RLock()
+	defer s.RUnlock()
+	channelIDs := make([]uint64, 0)
+	for channelID, clientIDs := range s.bindMap {
+		for _, id := range clientIDs {
+			if id == clientID {
+				channelIDs = append(channelIDs, channelID)
+				break
+			}
+		}
+	}
+	sort.Slice(channelIDs, func(i, j int) bool { return channelIDs[i] < channelIDs[j] })
+	return channelIDs, nil
+}
+
+func (s *DiskStorage) GetReadCursor(clientID uint64, channelID uint64) (uint64, error) {
+	s.RLock()
+	defer s.RUnlock()
+	return s.readCursorMap[cursorKey(clientID, channelID)], nil
+}
+
+func (s *DiskStorage) UpdateReadCursor(clientID uint64, channelID uint64, messageID uint64) error {
+	return s.write(&record{Op: opReadCursor, ClientID: clientID, ChannelID: channelID, MessageID: messageID})
+}
+
+func (s *DiskStorage) SetRetainMsg(channelID uint64, msg *tgo.Msg) error {
+	if msg != nil {
+		msg = storedMsg(msg)
+	}
+	return s.write(&record{Op: opRetainMsg, ChannelID: channelID, Msg: msg})
+}
+
+func (s *DiskStorage) GetRetainMsg(channelID uint64) (*tgo.Msg, error) {
+	s.RLock()
+	defer s.RUnlock()
+	return s.retainMsgMap[channelID], nil
+}
+
+// ---------- 客户端 ----------
+
+func (s *DiskStorage) AddClient(c *tgo.Client) error {
+	client := *c
+	return s.write(&record{Op: opAddClient, Client: &client})
+}
+
+func (s *DiskStorage) UpdateClient(clientID uint64, password string) error {
+	return s.write(&record{Op: opUpdateClient, ClientID: clientID, Password: password})
+}
+
+func (s *DiskStorage) GetClient(clientID uint64) (*tgo.Client, error) {
+	s.RLock()
+	defer s.RUnlock()
+	c := s.clientMap[clientID]
+	if c == nil {
+		return nil, nil
+	}
+	client := *c
+	return &client, nil
+}
+
+func cursorKey(clientID uint64, channelID uint64) string {
+	return fmt.Sprintf("%d-%d", clientID, channelID)
+}
+
+// storedMsg 保存的消息不包含链路信息
+func storedMsg(msg *tgo.Msg) *tgo.Msg {
+	stored := *msg
+	stored.TraceID = 0
+	stored.SpanID = 0
+	return &stored
+}
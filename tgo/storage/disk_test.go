@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/tgo-team/tgo-core/tgo"
+	"github.com/tgo-team/tgo-core/tgo/server/tcp"
+)
+
+func newTestContext(t *testing.T) *tgo.Context {
+	opts := tgo.NewOptions()
+	opts.DataPath = t.TempDir()
+	opts.TCPAddress = "127.0.0.1:0"
+	opts.HTTPAddress = ""
+	opts.LogLevel = tgo.ErrorLevel
+	tg, err := tgo.NewBuilder(opts).Server(tcp.New).Storage(New).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tg.Stop() })
+	return &tgo.Context{TGO: tg}
+}
+
+func TestDiskStorage_Replay(t *testing.T) {
+	ctx := newTestContext(t)
+	s, err := Open(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.AddClient(tgo.NewClient(1, "123456"))
+	s.UpdateClient(1, "654321")
+	s.AddChannel(tgo.NewChannelModel(1, tgo.ChannelTypePerson))
+	s.AddChannel(tgo.NewChannelModel(2, tgo.ChannelTypeBroadcast))
+	s.Bind(1, 1)
+	s.Bind(1, 1)
+	for i := 1; i <= 5; i++ {
+		if err = s.AddMsgInChannel(tgo.NewMsg(uint64(i), 2, []byte("hello")), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.RemoveMsgInChannel([]uint64{2, 4}, 1)
+	s.UpdateReadCursor(1, 2, 3)
+	s.SetRetainMsg(2, tgo.NewMsg(9, 1, []byte("retain")))
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = Open(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	checkDiskStorage(t, s)
+}
+
+// TestDiskStorage_Compact 压缩后的日志只包含当前数据
+func TestDiskStorage_Compact(t *testing.T) {
+	ctx := newTestContext(t)
+	s, err := Open(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		s.AddClient(tgo.NewClient(1, "123456"))
+	}
+	s.Lock()
+	err = s.compact()
+	s.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.UpdateClient(1, "654321")
+	s.Close()
+
+	data, err := ioutil.ReadFile(filepath.Join(ctx.TGO.GetOpts().DataPath, "storage", journalName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines != 2 {
+		t.Fatalf("压缩后日志应该有2行，实际为%d", lines)
+	}
+	s, err = Open(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	client, _ := s.GetClient(1)
+	if client == nil || client.Password != "654321" {
+		t.Fatalf("客户端不正确！-> %v", client)
+	}
+}
+
+// TestDiskStorage_CompactThreshold 当前数据超过MaxBytesPerFile时 日志超过上次快照的2倍才压缩
+func TestDiskStorage_CompactThreshold(t *testing.T) {
+	ctx := newTestContext(t)
+	ctx.TGO.GetOpts().MaxBytesPerFile = 200
+	s, err := Open(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	compactions := 0
+	for i := 1; i <= 50; i++ {
+		if err = s.AddClient(tgo.NewClient(uint64(i), "123456")); err != nil {
+			t.Fatal(err)
+		}
+		s.RLock()
+		if s.size == s.snapshotSize {
+			compactions++
+		}
+		s.RUnlock()
+	}
+	if compactions == 0 || compactions > 5 {
+		t.Fatalf("压缩次数不正确！-> %d", compactions)
+	}
+	s.RLock()
+	defer s.RUnlock()
+	if s.size > 2*s.snapshotSize {
+		t.Fatalf("日志应该在超过快照的2倍时压缩！-> %d %d", s.size, s.snapshotSize)
+	}
+}
+
+func checkDiskStorage(t *testing.T, s *DiskStorage) {
+	client, _ := s.GetClient(1)
+	if client == nil || client.Password != "654321" {
+		t.Fatalf("客户端不正确！-> %v", client)
+	}
+	clientIDs, _ := s.GetClientIDs(1)
+	if len(clientIDs) != 1 || clientIDs[0] != 1 {
+		t.Fatalf("管道的客户端应该为[1]，实际为%v", clientIDs)
+	}
+	channelIDs, _ := s.GetChannelIDsByType(tgo.ChannelTypeBroadcast)
+	if len(channelIDs) != 1 || channelIDs[0] != 2 {
+		t.Fatalf("广播管道应该为[2]，实际为%v", channelIDs)
+	}
+	msgList, _ := s.GetMsgInChannel(1, 1, 2)
+	if len(msgList) != 2 || msgList[0].MessageID != 1 || msgList[1].MessageID != 3 {
+		t.Fatalf("第一页消息不正确！-> %v", msgList)
+	}
+	msgList, _ = s.GetMsgInChannel(1, 2, 2)
+	if len(msgList) != 1 || msgList[0].MessageID != 5 || string(msgList[0].Payload) != "hello" {
+		t.Fatalf("第二页消息不正确！-> %v", msgList)
+	}
+	msgList, _ = s.GetMsgInChannelAfter(1, 3, 10)
+	if len(msgList) != 1 || msgList[0].MessageID != 5 {
+		t.Fatalf("消息[3]之后的消息不正确！-> %v", msgList)
+	}
+	if lastMsgID, _ := s.GetLastMsgID(1); lastMsgID != 5 {
+		t.Fatalf("最后一条消息应该为5，实际为%d", lastMsgID)
+	}
+	cursor, _ := s.GetReadCursor(1, 2)
+	if cursor != 3 {
+		t.Fatalf("游标应该为3，实际为%d", cursor)
+	}
+	retainMsg, _ := s.GetRetainMsg(2)
+	if retainMsg == nil || string(retainMsg.Payload) != "retain" {
+		t.Fatalf("保留消息不正确！-> %v", retainMsg)
+	}
+}
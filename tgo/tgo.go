@@ -1,7 +1,9 @@
 package tgo
 
 import (
+	"errors"
 	"github.com/tgo-team/tgo-core/tgo/packets"
+	"io"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -13,9 +15,20 @@ type TGO struct {
 	*Route
 	exitChan                chan int
 	waitGroup               WaitGroupWrapper
-	Storage                 Storage // storage msg
-	monitor                 Monitor // Monitor
-	channelMap              map[uint64]Channel
+	Storage                 Storage                // storage msg
+	monitor                 Monitor                // Monitor
+	channels                *channelRegistry       // 已加载的管道
+	channelTypes            map[int]newChannelFunc // Builder指定的管道类型
+	auth                    Authenticator
+	topics                  *topicManager   // 主题订阅
+	rpc                     *rpcManager     // 服务端发起的命令
+	http                    *httpServer     // 内置http服务
+	limiter                 *packetLimiter  // 包的速率限制
+	packetTaps              *packetTaps     // 管理接口实时查看收到的包
+	cluster                 Cluster         // 集群 为空表示单机
+	syncing                 *syncingClients // 还没有同步完读扩散消息的客户端
+	retainMsgMap            map[uint64]*Msg // 管道的保留消息（存储没有实现RetainStorage时使用）
+	retainMsgLock           sync.RWMutex
 	AcceptConnChan          chan Conn // 接受连接
 	AcceptPacketChan        chan *PacketContext
 	AcceptConnExitChan      chan Conn                  // 接受连接退出
@@ -24,73 +37,74 @@ type TGO struct {
 	sync.RWMutex
 }
 
+// New 通过全局登记的server、存储等创建TGO 需要每个TGO使用不同的server、存储时使用Builder
 func New(opts *Options) *TGO {
-	tg := &TGO{
-		exitChan:                make(chan int, 0),
-		channelMap:              map[uint64]Channel{},
-		AcceptPacketChan:        make(chan *PacketContext, 1024),
-		AcceptConnChan:          make(chan Conn, 1024),
-		AcceptConnExitChan:      make(chan Conn, 1024),
-		AcceptAuthenticatedChan: make(chan *AuthenticatedContext, 1024),
-		ConnManager:             newConnManager(),
-	}
-
-	lg := NewLog(opts.LogLevel)
-	if lg != nil {
-		opts.Log =lg
-	}
-	//if opts.Monitor == nil {
-	//	opts.Monitor = tg
-	//}
-	tg.storeOpts(opts)
-
-	ctx := &Context{
-		TGO: tg,
-	}
-
-	// server
-	tg.Servers = GetServers(ctx)
-	if tg.Servers == nil {
-		opts.Log.Fatal("请先配置Server！")
-	}
-
-	// route
-	tg.Route = NewRoute(ctx)
-
-	// storage
-	tg.Storage = NewStorage(ctx) // new storage
-	if tg.Storage == nil {
-		opts.Log.Fatal("请先配置存储！")
+	tg, err := NewBuilder(opts).build()
+	if err != nil {
+		opts.Log.Fatal("%v", err)
 	}
-
-	tg.waitGroup.Wrap(tg.msgLoop)
+	tg.startLoops()
 	return tg
 }
 
+func (t *TGO) startLoops() {
+	t.waitGroup.Wrap(t.msgLoop)
+	t.waitGroup.Wrap(t.channelEvictLoop)
+	t.waitGroup.Wrap(t.monitorLoop)
+}
+
 func (t *TGO) Start() error {
+	t.Info("生效的配置：\n%s", t.GetOpts().Dump())
+	if err := t.loadRetainedTopics(); err != nil {
+		t.Warn("加载保留消息的主题失败！-> %v", err)
+	}
 	for _, server := range t.Servers {
 		err := server.Start()
 		if err != nil {
 			return err
 		}
 	}
-	return nil
+	if t.cluster != nil {
+		if err := t.cluster.Start(); err != nil {
+			return err
+		}
+	}
+	return t.startHTTP()
 }
 
 func (t *TGO) Stop() error {
-	close(t.exitChan)
-	close(t.AcceptPacketChan)
-	close(t.AcceptAuthenticatedChan)
-	close(t.AcceptConnChan)
-	close(t.AcceptConnExitChan)
+	// 先停止server 避免连接在关闭时写入已关闭的chan
 	for _, server := range t.Servers {
 		err := server.Stop()
 		if err != nil {
 			return err
 		}
 	}
+	// 集群转发的消息需要msgLoop投递 在关闭chan之前停止
+	if t.cluster != nil {
+		if err := t.cluster.Stop(); err != nil {
+			t.Warn("停止集群失败！-> %v", err)
+		}
+	}
+	close(t.exitChan)
+	close(t.AcceptPacketChan)
+	close(t.AcceptAuthenticatedChan)
+	close(t.AcceptConnChan)
+	close(t.AcceptConnExitChan)
+	if err := t.stopHTTP(); err != nil {
+		t.Warn("停止HTTP服务失败！-> %v", err)
+	}
 	t.waitGroup.Wait()
+	t.closeAllChannel()
+	if closer, ok := t.Storage.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			t.Warn("关闭存储失败！-> %v", err)
+		}
+	}
 	t.Info("TGO -> 退出")
+	if closer, ok := t.GetOpts().Log.(io.Closer); ok {
+		closer.Close()
+	}
 	return nil
 }
 
@@ -105,63 +119,99 @@ func (t *TGO) GetOpts() *Options {
 func (t *TGO) msgLoop() {
 	for {
 		select {
-		case conn := <-t.AcceptConnChan: // 接受到连接请求
-			packet, err := t.GetOpts().Pro.DecodePacket(conn)
-			if err != nil {
-				t.Error("解析连接数据失败！-> %v", err)
+		case conn := <-t.AcceptConnChan: // 接受到连接请求 第一个包在msgLoop中读取，server应该在连接自己的协程中调用ReadConnect
+			if conn == nil {
 				continue
 			}
-
-			if packet.GetFixedHeader().PacketType != packets.Connect && !t.GetOpts().TestOn {
-				t.Error("包类型[%d]错误！发起连接后的第一个包必须为Connect包！", packet.GetFixedHeader().PacketType)
+			packet, err := t.ReadConnect(conn)
+			if err != nil {
 				continue
 			}
 			t.AcceptPacketChan <- NewPacketContext(packet, conn)
 		case authenticatedContext := <-t.AcceptAuthenticatedChan: // 连接已认证
 			if authenticatedContext != nil {
-				t.Debug("连接[%v]认证成功！", authenticatedContext.Conn)
+				t.LogFields(DebugLevel, []Field{FieldClientID(authenticatedContext.ClientID), FieldRemoteAddr(authenticatedContext.Conn)}, "连接认证成功！")
 				channelID := authenticatedContext.ClientID
+				t.syncing.add(authenticatedContext.ClientID) // 连接对读扩散投递可见之前标记 同步完成后移除
 				t.ConnManager.AddConn(authenticatedContext.ClientID, authenticatedContext.Conn)
+				if t.cluster != nil {
+					t.cluster.ClientOnline(authenticatedContext.ClientID)
+				}
+				t.monitorGauge(metricConnections, nil, float64(t.ConnManager.Len()))
+				t.loadClientTags(authenticatedContext.ClientID)
 				channel, err := t.GetChannel(channelID)
 				if err != nil {
 					t.Error("获取管道[%d]失败！-> %v", channelID, err)
+					t.syncing.remove(authenticatedContext.ClientID)
 					continue
 				}
 				if channel == nil {
 					t.Error("管道[%d]不存在！", channelID)
+					t.syncing.remove(authenticatedContext.ClientID)
 					continue
 				}
 				// 开始推送离线消息
 				t.waitGroup.Wrap(func() {
-					t.pushOfflineMsg(authenticatedContext.ClientID,authenticatedContext.Conn)
+					defer t.syncing.remove(authenticatedContext.ClientID)
+					t.pushOfflineMsg(authenticatedContext.ClientID, authenticatedContext.Conn)
+					t.syncChannelMsg(authenticatedContext.ClientID, authenticatedContext.Conn)
 				})
 			}
 		case packetContext := <-t.AcceptPacketChan: // 接受到包请求
 			if packetContext != nil {
-				t.Debug("收到[%v]的包 ->  %v", packetContext.Conn, packetContext.Packet)
+				t.LogFields(DebugLevel, []Field{FieldRemoteAddr(packetContext.Conn)}, "收到包 -> %v", packetContext.Packet)
+				t.monitorCounter(metricPacketsReceived, Labels{"type": packetTypeName(packetContext.Packet.GetFixedHeader().PacketType)}, 1)
+				t.packetTaps.publish(packetContext)
+				if !t.checkPacket(packetContext) {
+					continue
+				}
+				if t.rpc.complete(packetContext.Packet, packetContext.Conn) { // 服务端发起命令的回复
+					continue
+				}
 				t.Serve(GetMContext(packetContext))
 			} else {
 				t.Warn("Receive the message is nil")
 			}
 		case msgContext := <-t.Storage.StorageMsgChan(): // 消息存储成功
 			if msgContext != nil {
-				channel, err := t.GetChannel(msgContext.ChannelID())
+				if msgContext.msg.TraceID == 0 { // 存储返回的消息可能是重新创建的
+					msgContext.msg.TraceID, msgContext.msg.SpanID = msgContext.traceID, msgContext.spanID
+				}
+				span := t.startSpan(SpanStorageMsgChan, msgContext.msg, msgContext.ChannelID())
+				channel, release, err := t.acquireChannel(msgContext.ChannelID())
 				if err != nil {
 					t.Error("获取管道[%d]失败！-> %v", msgContext.ChannelID(), err)
+					t.finishSpan(span, err)
 					continue
 				}
 				if channel == nil {
 					t.Error("管道[%d]不存在！", msgContext.ChannelID())
+					t.finishSpan(span, ErrChannelNotExist)
 					continue
 				}
+				t.monitorCounter(metricMessagesStored, Labels{"channel_type": channelTypeName(channel)}, 1)
 				channel.DeliveryMsgChan() <- msgContext.msg
+				release()
+				t.finishSpan(span, nil)
 			}
 		case conn := <-t.AcceptConnExitChan: // 连接退出
 			if conn != nil {
-				t.Debug("连接[%v]退出！", conn)
+				t.LogFields(DebugLevel, []Field{FieldRemoteAddr(conn)}, "连接退出！")
+				t.limiter.remove(conn)
 				cn, ok := conn.(StatefulConn)
 				if ok {
-					t.ConnManager.RemoveConn(cn.GetID())
+					clientID := cn.GetID()
+					if !t.ConnManager.RemoveConn(clientID, conn) { // 客户端已经重新连接
+						continue
+					}
+					if t.cluster != nil {
+						t.cluster.ClientOffline(clientID)
+					}
+					t.monitorGauge(metricConnections, nil, float64(t.ConnManager.Len()))
+					t.topics.trie.UnsubscribeAll(clientID)
+					t.waitGroup.Wrap(func() {
+						t.markBroadcastRead(clientID)
+					})
 				}
 
 			}
@@ -169,37 +219,70 @@ func (t *TGO) msgLoop() {
 			goto exit
 
 		}
-		println("test---")
 	}
 exit:
 	t.Debug("停止收取消息。")
 }
 
-// GetChannel 通过[channelID]获取管道信息
-func (t *TGO) GetChannel(channelID uint64) (Channel, error) {
-	defer  t.Unlock()
-	t.Lock()
-	channel, ok := t.channelMap[channelID]
-	if !ok {
-		channelModel, err := t.Storage.GetChannel(channelID)
-		if err != nil {
-			return nil, err
-		}
-		if channelModel != nil {
-			channel = channelModel.NewChannel(t.ctx)
-			t.channelMap[channelID] =channel
-			if err!=nil {
-				return nil,err
-			}
-			return channel,nil
+var ErrNotConnectPacket = errors.New("发起连接后的第一个包必须为Connect包！")
+
+// ReadConnect 读取连接的第一个包 第一个包必须为Connect包（测试模式除外）
+// 读取失败或者包类型错误时关闭连接并返回错误 读取会阻塞，应该在连接自己的协程中调用
+func (t *TGO) ReadConnect(conn Conn) (packets.Packet, error) {
+	packet, err := t.GetOpts().Pro.DecodePacket(conn)
+	if err != nil {
+		t.LogFields(ErrorLevel, []Field{FieldRemoteAddr(conn)}, "解析连接数据失败！-> %v", err)
+		t.monitorCounter(metricDecodeErrors, nil, 1)
+		closeConn(conn)
+		return nil, err
+	}
+	if packet.GetFixedHeader().PacketType != packets.Connect && !t.GetOpts().TestOn {
+		t.LogFields(ErrorLevel, []Field{FieldRemoteAddr(conn)}, "包类型[%d]错误！发起连接后的第一个包必须为Connect包！", packet.GetFixedHeader().PacketType)
+		closeConn(conn)
+		return nil, ErrNotConnectPacket
+	}
+	return packet, nil
+}
+
+// WriteMsg 将管道[channelID]的消息编码为消息包写入连接（自定义管道类型投递消息时使用）
+func (t *TGO) WriteMsg(conn Conn, channelID uint64, msg *Msg) error {
+	return t.writeMsgPacket(conn, channelID, msg, false)
+}
+
+// writeMsgPacket 将消息编码为消息包写入连接 retain表示推送的是管道的保留消息
+func (t *TGO) writeMsgPacket(conn Conn, channelID uint64, msg *Msg, retain bool) (err error) {
+	span := t.startSpan(SpanConnWrite, msg, channelID)
+	if span != nil {
+		if statefulConn, ok := conn.(StatefulConn); ok {
+			span.ClientID = statefulConn.GetID()
 		}
+		defer func() {
+			t.finishSpan(span, err)
+		}()
+	}
+	msgPacket := packets.NewMessagePacket(msg.MessageID, channelID, msg.Payload)
+	msgPacket.From = msg.From
+	msgPacket.Retain = retain
+	msgPacketData, err := t.GetOpts().Pro.EncodePacket(msgPacket)
+	if err != nil {
+		return err
 	}
-	return channel, nil
+	_, err = conn.Write(msgPacketData)
+	if err != nil {
+		t.monitorCounter(metricDeliveryErrors, nil, 1)
+		return err
+	}
+	t.monitorCounter(metricMessagesDelivered, nil, 1)
+	if !retain && msg.Timestamp > 0 {
+		t.monitorObserve(metricDeliveryLatency, nil, float64(time.Now().UnixNano()/1000000-msg.Timestamp)/1000)
+	}
+	return nil
 }
 
 // pushOfflineMsg 推送离线消息
 func (t *TGO) pushOfflineMsg(clientID uint64, conn Conn) {
-	channel, err := t.GetChannel(clientID)
+	channel, release, err := t.acquireChannel(clientID)
+	defer release()
 	if err != nil {
 		t.Error("查询连接[%v]的Channel失败！-> %v", conn, err)
 		return
@@ -209,13 +292,15 @@ func (t *TGO) pushOfflineMsg(clientID uint64, conn Conn) {
 		return
 	}
 
-	var currentPageIndex int64= 1 // 当前页码
-	var pageSize int64 = 100 // 每页数据量
-	var maxPageIndex int64= 1000 // 最大页码数（TODO: 超过最大页码不管有没有推送完离线消息都终止，所以最大页码下标尽量设置大点）
-	startPushTimeMill := time.Now().UnixNano()/(1000*1000) // 开始push时间 毫秒
+	var currentPageIndex int64 = 1                             // 当前页码
+	var pageSize int64 = 100                                   // 每页数据量
+	var maxPageIndex int64 = 1000                              // 最大页码数（TODO: 超过最大页码不管有没有推送完离线消息都终止，所以最大页码下标尽量设置大点）
+	startPushTimeMill := time.Now().UnixNano() / (1000 * 1000) // 开始push时间 毫秒
 
-	for currentPageIndex = 1;currentPageIndex<maxPageIndex;currentPageIndex ++ {
+	for currentPageIndex = 1; currentPageIndex < maxPageIndex; currentPageIndex++ {
+		start := time.Now()
 		msgList, err := t.Storage.GetMsgInChannel(channel.Model().ChannelID, currentPageIndex, pageSize)
+		t.monitorStorage("get_msg", start)
 		if err != nil {
 			t.Error("获取管道[%d]的消息失败！-> %v", channel.Model().ChannelID, err)
 			return
@@ -231,7 +316,93 @@ func (t *TGO) pushOfflineMsg(clientID uint64, conn Conn) {
 		}
 	}
 
-	exit:
-		t.Debug("客户端[%v]的离线消息推送完成！",clientID)
+exit:
+	t.Debug("客户端[%v]的离线消息推送完成！", clientID)
+
+}
+
+// syncChannelMsg 推送客户端所在管道的保留消息 同步需要主动同步消息的管道（例如读扩散的群组管道）
+// 存储没有实现CursorStorage时无法查询客户端绑定的管道，只推送个人管道和广播管道的保留消息
+func (t *TGO) syncChannelMsg(clientID uint64, conn Conn) {
+	channelIDs := []uint64{clientID}
+	if cursorStorage, ok := t.Storage.(CursorStorage); ok {
+		boundChannelIDs, err := cursorStorage.GetChannelIDs(clientID)
+		if err != nil {
+			t.Error("查询客户端[%d]的管道失败！-> %v", clientID, err)
+			return
+		}
+		for _, channelID := range boundChannelIDs {
+			if channelID != clientID {
+				channelIDs = append(channelIDs, channelID)
+			}
+		}
+	}
+	broadcastChannelIDs, err := t.getBroadcastChannelIDs()
+	if err != nil {
+		t.Error("查询广播管道失败！-> %v", err)
+	}
+	channelIDs = append(channelIDs, broadcastChannelIDs...)
+	for _, channelID := range channelIDs {
+		err = t.pushRetainMsg(channelID, conn)
+		if err != nil {
+			t.Warn("推送管道[%d]的保留消息给客户端[%d]失败！-> %v", channelID, clientID, err)
+		}
+		if channelID == clientID { // 个人管道已推送过离线消息
+			continue
+		}
+		channel, release, err := t.acquireChannel(channelID)
+		if err != nil {
+			t.Error("获取管道[%d]失败！-> %v", channelID, err)
+			continue
+		}
+		if syncer, ok := channel.(MsgSyncer); ok {
+			if err = syncer.SyncMsg(clientID, conn); err != nil {
+				t.Error("同步客户端[%d]在管道[%d]的消息失败！-> %v", clientID, channelID, err)
+			}
+		}
+		release()
+	}
+}
+
+// getBroadcastChannelIDs 获取所有广播管道（存储需要实现ChannelTypeStorage）
+func (t *TGO) getBroadcastChannelIDs() ([]uint64, error) {
+	channelTypeStorage, ok := t.Storage.(ChannelTypeStorage)
+	if !ok {
+		return nil, nil
+	}
+	return channelTypeStorage.GetChannelIDsByType(ChannelTypeBroadcast)
+}
 
+// loadClientTags 从存储加载在线客户端的标签
+func (t *TGO) loadClientTags(clientID uint64) {
+	client, err := t.Storage.GetClient(clientID)
+	if err != nil {
+		t.Warn("获取客户端[%d]失败！-> %v", clientID, err)
+		return
+	}
+	if client != nil && len(client.Tags) > 0 {
+		t.ConnManager.SetTags(clientID, client.Tags)
+	}
+}
+
+// markBroadcastRead 客户端下线时记录客户端在广播管道的读取游标
+func (t *TGO) markBroadcastRead(clientID uint64) {
+	broadcastChannelIDs, err := t.getBroadcastChannelIDs()
+	if err != nil {
+		t.Error("查询广播管道失败！-> %v", err)
+		return
+	}
+	for _, channelID := range broadcastChannelIDs {
+		channel, release, err := t.acquireChannel(channelID)
+		if err != nil {
+			t.Error("获取管道[%d]失败！-> %v", channelID, err)
+			continue
+		}
+		if broadcastChannel, ok := channel.(*BroadcastChannel); ok {
+			if err = broadcastChannel.MarkRead(clientID); err != nil {
+				t.Warn("记录客户端[%d]在广播管道[%d]的读取游标失败！-> %v", clientID, channelID, err)
+			}
+		}
+		release()
+	}
 }
@@ -4,25 +4,30 @@ import "fmt"
 
 // --------- log -------------
 func (t *TGO) Info(format string, a ...interface{}) {
-	t.GetOpts().Log.Info(fmt.Sprintf("【%s】%s", t.getLogPrefix(), format), a...)
+	logf(t.GetOpts().Log, InfoLevel, nil, fmt.Sprintf("【%s】%s", t.getLogPrefix(), format), a...)
 }
 
 func (t *TGO) Error(format string, a ...interface{}) {
-	t.GetOpts().Log.Error(fmt.Sprintf("【%s】%s", t.getLogPrefix(), format), a...)
+	logf(t.GetOpts().Log, ErrorLevel, nil, fmt.Sprintf("【%s】%s", t.getLogPrefix(), format), a...)
 }
 
 func (t *TGO) Warn(format string, a ...interface{}) {
-	t.GetOpts().Log.Warn(fmt.Sprintf("【%s】%s", t.getLogPrefix(), format), a...)
+	logf(t.GetOpts().Log, WarnLevel, nil, fmt.Sprintf("【%s】%s", t.getLogPrefix(), format), a...)
 }
 
 func (t *TGO) Debug(format string, a ...interface{}) {
-	t.GetOpts().Log.Debug(fmt.Sprintf("【%s】%s", t.getLogPrefix(), format), a...)
+	logf(t.GetOpts().Log, DebugLevel, nil, fmt.Sprintf("【%s】%s", t.getLogPrefix(), format), a...)
 }
 
 func (t *TGO) Fatal(format string, a ...interface{}) {
-	t.GetOpts().Log.Fatal(fmt.Sprintf("【%s】%s", t.getLogPrefix(), format), a...)
+	logf(t.GetOpts().Log, FatalLevel, nil, fmt.Sprintf("【%s】%s", t.getLogPrefix(), format), a...)
 }
 
 func (t *TGO) getLogPrefix() string {
 	return "TGO"
 }
+
+// LogFields 输出带字段的日志 例如: t.LogFields(DebugLevel, []Field{FieldClientID(clientID)}, "连接认证成功！")
+func (t *TGO) LogFields(level LogLevel, fields []Field, format string, a ...interface{}) {
+	logf(t.GetOpts().Log, level, fields, fmt.Sprintf("【%s】%s", t.getLogPrefix(), format), a...)
+}
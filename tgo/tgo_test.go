@@ -1,53 +1,32 @@
 package tgo
 
 import (
-	"net"
-	"testing"
+	"fmt"
+	"sync"
 )
 
-
-func TestTTGO_pushOfflineMsg(t *testing.T) {
-	RegistryStorage(func(context *Context) Storage {
+// newTestBuilder 使用内存存储和测试server的Builder
+func newTestBuilder(opts *Options) *Builder {
+	opts.TCPAddress = "127.0.0.1:0"
+	opts.HTTPAddress = "127.0.0.1:0"
+	opts.HTTPSAddress = "127.0.0.1:0"
+	return NewBuilder(opts).Storage(func(context *Context) Storage {
 		return NewMemoryStorage(context)
-	})
-	RegistryServer(func(context *Context) Server {
+	}).Server(func(context *Context) Server {
 		return &ServerTest{}
 	})
-	opts := NewOptions()
-	tg := startTGO(opts)
+}
 
-	var clientID uint64= 100
+func startTGO(opts *Options) *TGO {
+	return startBuilder(newTestBuilder(opts))
+}
 
-	err := tg.Storage.AddClient(NewClient(clientID, "123456"))
-	if err != nil {
-		t.Error(err)
-	}
-	err = tg.Storage.AddChannel(NewChannelModel(clientID,ChannelTypePerson))
+func startBuilder(builder *Builder) *TGO {
+	tg, err := builder.Build()
 	if err != nil {
-		t.Error(err)
-	}
-	err = tg.Storage.Bind(clientID,clientID)
-	if err != nil {
-		t.Error(err)
-	}
-	s, _ := net.Pipe()
-	for i := 0; i < 999; i++ {
-		err = tg.Storage.AddMsgInChannel(NewMsg(uint64(1+i), 99, []byte("hello")),clientID)
-		if err != nil {
-			t.Error(err)
-		}
+		panic(err)
 	}
-
-	tg.pushOfflineMsg(clientID, s)
-
-}
-
-func startTGO(opts *Options) *TGO {
-	opts.TCPAddress = "127.0.0.1:0"
-	opts.HTTPAddress = "127.0.0.1:0"
-	opts.HTTPSAddress = "127.0.0.1:0"
-	tg := New(opts)
-	err := tg.Start()
+	err = tg.Start()
 	if err != nil {
 		panic(err)
 	}
@@ -55,22 +34,25 @@ func startTGO(opts *Options) *TGO {
 }
 
 type MemoryStorage struct {
-	storageMsgChan chan *MsgContext
-	channelMsgMap  map[uint64][]*Msg
-	channelMap     map[uint64]*ChannelModel
-	clientMap      map[uint64]*Client
-	clientChannelRelationMap  map[uint64][]uint64
-	ctx            *Context
+	storageMsgChan           chan *MsgContext
+	channelMsgMap            map[uint64][]*Msg
+	channelMap               map[uint64]*ChannelModel
+	clientMap                map[uint64]*Client
+	clientChannelRelationMap map[uint64][]uint64
+	readCursorMap            map[string]uint64
+	ctx                      *Context
+	sync.RWMutex
 }
 
 func NewMemoryStorage(ctx *Context) *MemoryStorage {
 	return &MemoryStorage{
-		storageMsgChan: make(chan *MsgContext, 0),
-		channelMsgMap:  make(map[uint64][]*Msg),
-		channelMap:     make(map[uint64]*ChannelModel),
-		clientMap:      make(map[uint64]*Client),
+		storageMsgChan:           make(chan *MsgContext, 0),
+		channelMsgMap:            make(map[uint64][]*Msg),
+		channelMap:               make(map[uint64]*ChannelModel),
+		clientMap:                make(map[uint64]*Client),
 		clientChannelRelationMap: make(map[uint64][]uint64),
-		ctx:            ctx,
+		readCursorMap:            make(map[string]uint64),
+		ctx:                      ctx,
 	}
 }
 
@@ -79,57 +61,145 @@ func (s *MemoryStorage) StorageMsgChan() chan *MsgContext {
 }
 
 func (s *MemoryStorage) AddMsgInChannel(msg *Msg, channelID uint64) error {
-	msgs := s.channelMsgMap[channelID]
-	if msgs == nil {
-		msgs = make([]*Msg, 0)
-	}
-	msgs = append(msgs, msg)
-	s.channelMsgMap[channelID] = msgs
-	s.storageMsgChan <- NewMsgContext(msg,channelID)
+	s.Lock()
+	s.channelMsgMap[channelID] = append(s.channelMsgMap[channelID], msg)
+	s.Unlock()
+	s.storageMsgChan <- NewMsgContext(msg, channelID)
 	return nil
 }
 
 func (s *MemoryStorage) AddChannel(c *ChannelModel) error {
+	s.Lock()
+	defer s.Unlock()
 	s.channelMap[c.ChannelID] = c
 	return nil
 }
 func (s *MemoryStorage) GetChannel(channelID uint64) (*ChannelModel, error) {
-	ch := s.channelMap[channelID]
-	return ch, nil
+	s.RLock()
+	defer s.RUnlock()
+	return s.channelMap[channelID], nil
 }
 
 func (s *MemoryStorage) AddClient(c *Client) error {
+	s.Lock()
+	defer s.Unlock()
 	s.clientMap[c.ClientID] = c
 	return nil
 }
 
 func (s *MemoryStorage) Bind(clientID uint64, channelID uint64) error {
-	clientIDs := s.clientChannelRelationMap[channelID]
-	if clientIDs==nil {
-		clientIDs = make([]uint64,0)
-	}
-	clientIDs = append(clientIDs,clientID)
-	s.clientChannelRelationMap[channelID] = clientIDs
+	s.Lock()
+	defer s.Unlock()
+	s.clientChannelRelationMap[channelID] = append(s.clientChannelRelationMap[channelID], clientID)
 	return nil
 }
 
 func (s *MemoryStorage) GetClientIDs(channelID uint64) ([]uint64, error) {
+	s.RLock()
+	defer s.RUnlock()
 	return s.clientChannelRelationMap[channelID], nil
 }
 
 func (s *MemoryStorage) GetClient(clientID uint64) (*Client, error) {
-
+	s.RLock()
+	defer s.RUnlock()
 	return s.clientMap[clientID], nil
 }
 
+// UpdateClient 管理接口修改客户端密码时使用
+func (s *MemoryStorage) UpdateClient(clientID uint64, password string) error {
+	s.Lock()
+	defer s.Unlock()
+	c := s.clientMap[clientID]
+	if c != nil {
+		c.Password = password
+	}
+	return nil
+}
+
 func (s *MemoryStorage) GetMsgInChannel(channelID uint64, pageIndex int64, pageSize int64) ([]*Msg, error) {
+	s.RLock()
+	defer s.RUnlock()
 	msgList := s.channelMsgMap[channelID]
 	if int64(len(msgList)) >= (pageIndex-1)*pageSize+pageSize {
 		return msgList[(pageIndex-1)*pageSize : (pageIndex-1)*pageSize+pageSize], nil
 	}
+	if int64(len(msgList)) < (pageIndex-1)*pageSize {
+		return nil, nil
+	}
 	return msgList[(pageIndex-1)*pageSize:], nil
 }
 
-func (s *MemoryStorage) RemoveMsgInChannel(messageIDs []uint64, channelID uint64) error   {
+func (s *MemoryStorage) RemoveMsgInChannel(messageIDs []uint64, channelID uint64) error {
+	return nil
+}
+
+func (s *MemoryStorage) GetChannelIDs(clientID uint64) ([]uint64, error) {
+	s.RLock()
+	defer s.RUnlock()
+	channelIDs := make([]uint64, 0)
+	for channelID, clientIDs := range s.clientChannelRelationMap {
+		for _, id := range clientIDs {
+			if id == clientID {
+				channelIDs = append(channelIDs, channelID)
+				break
+			}
+		}
+	}
+	return channelIDs, nil
+}
+
+func (s *MemoryStorage) GetReadCursor(clientID uint64, channelID uint64) (uint64, error) {
+	s.RLock()
+	defer s.RUnlock()
+	return s.readCursorMap[fmt.Sprintf("%d-%d", clientID, channelID)], nil
+}
+
+func (s *MemoryStorage) UpdateReadCursor(clientID uint64, channelID uint64, messageID uint64) error {
+	s.Lock()
+	defer s.Unlock()
+	s.readCursorMap[fmt.Sprintf("%d-%d", clientID, channelID)] = messageID
 	return nil
-}
\ No newline at end of file
+}
+
+func (s *MemoryStorage) GetMsgInChannelAfter(channelID uint64, messageID uint64, limit int64) ([]*Msg, error) {
+	s.RLock()
+	defer s.RUnlock()
+	msgList := s.channelMsgMap[channelID]
+	start := 0
+	if messageID != 0 {
+		for i, msg := range msgList {
+			if msg.MessageID == messageID {
+				start = i + 1
+				break
+			}
+		}
+	}
+	msgList = msgList[start:]
+	if int64(len(msgList)) > limit {
+		msgList = msgList[:limit]
+	}
+	return msgList, nil
+}
+
+func (s *MemoryStorage) GetLastMsgID(channelID uint64) (uint64, error) {
+	s.RLock()
+	defer s.RUnlock()
+	msgList := s.channelMsgMap[channelID]
+	if len(msgList) == 0 {
+		return 0, nil
+	}
+	return msgList[len(msgList)-1].MessageID, nil
+}
+
+func (s *MemoryStorage) GetChannelIDsByType(channelType int) ([]uint64, error) {
+	s.RLock()
+	defer s.RUnlock()
+	channelIDs := make([]uint64, 0)
+	for channelID, channelModel := range s.channelMap {
+		if channelModel.ChannelType == channelType {
+			channelIDs = append(channelIDs, channelID)
+		}
+	}
+	return channelIDs, nil
+}
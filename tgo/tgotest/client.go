@@ -0,0 +1,218 @@
+package tgotest
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tgo-team/tgo-core/tgo/packets"
+	"github.com/tgo-team/tgo-core/tgo/protocol"
+)
+
+// Client 虚拟客户端 在后台一直读取连接（服务端写入不会阻塞），收到的包按顺序保存，Expect系列方法取出第一个符合条件的包
+type Client struct {
+	ID       uint64 // Connect认证后的客户端ID
+	s        *Server
+	conn     net.Conn
+	received []packets.Packet
+	notify   chan struct{}
+	done     chan struct{} // 连接断开时关闭
+	err      error         // 连接断开的原因
+	sequence uint64        // 命令的请求编号
+	sync.Mutex
+}
+
+func newClient(s *Server, conn net.Conn) *Client {
+	c := &Client{
+		s:      s,
+		conn:   conn,
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	go c.readLoop()
+	return c
+}
+
+func (c *Client) readLoop() {
+	defer close(c.done)
+	for {
+		packet, err := protocol.Decode(c.conn)
+		if err != nil {
+			c.Lock()
+			c.err = err
+			c.Unlock()
+			return
+		}
+		c.Lock()
+		c.received = append(c.received, packet)
+		c.Unlock()
+		select {
+		case c.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Write 发送包
+func (c *Client) Write(packet packets.Packet) {
+	c.s.t.Helper()
+	data, err := protocol.Encode(packet)
+	if err != nil {
+		c.s.t.Fatalf("编码[%v]失败！-> %v", packet, err)
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(c.s.Timeout))
+	if _, err = c.conn.Write(data); err != nil {
+		c.s.t.Fatalf("发送[%v]失败！-> %v", packet, err)
+	}
+}
+
+// Send 发送消息到管道 返回消息ID（用于ExpectMsgack）
+func (c *Client) Send(channelID uint64, payload []byte) uint64 {
+	c.s.t.Helper()
+	messageID := nextMessageID()
+	c.Write(packets.NewMessagePacket(messageID, channelID, payload))
+	return messageID
+}
+
+// Ack 确认收到的消息
+func (c *Client) Ack(messageIDs ...uint64) {
+	c.s.t.Helper()
+	c.Write(packets.NewMsgackPacket(messageIDs))
+}
+
+// Cmd 发送命令 返回请求编号（用于ExpectCmdack）
+func (c *Client) Cmd(cmd string, payload []byte) uint64 {
+	c.s.t.Helper()
+	cmdPacket := packets.NewCmdPacket(cmd, payload)
+	cmdPacket.RequestID = atomic.AddUint64(&c.sequence, 1)
+	c.Write(cmdPacket)
+	return cmdPacket.RequestID
+}
+
+// Expect 等待第一个符合match的包 超时或者连接断开时测试失败 desc用于失败时的描述
+func (c *Client) Expect(desc string, match func(packet packets.Packet) bool) packets.Packet {
+	c.s.t.Helper()
+	timer := time.NewTimer(c.s.Timeout)
+	defer timer.Stop()
+	for {
+		if packet := c.take(match); packet != nil {
+			return packet
+		}
+		select {
+		case <-c.notify:
+		case <-c.done:
+			if packet := c.take(match); packet != nil {
+				return packet
+			}
+			c.s.t.Fatalf("客户端[%d]等待%s时连接已断开！-> %v", c.ID, desc, c.Err())
+		case <-timer.C:
+			c.s.t.Fatalf("客户端[%d]等待%s超时！已收到的包: %v", c.ID, desc, c.Received())
+		}
+	}
+}
+
+// take 取出第一个符合match的包
+func (c *Client) take(match func(packet packets.Packet) bool) packets.Packet {
+	c.Lock()
+	defer c.Unlock()
+	for i, packet := range c.received {
+		if match(packet) {
+			c.received = append(c.received[:i], c.received[i+1:]...)
+			return packet
+		}
+	}
+	return nil
+}
+
+// ExpectConnack 等待Connack
+func (c *Client) ExpectConnack() *packets.ConnackPacket {
+	c.s.t.Helper()
+	return c.Expect("Connack", func(packet packets.Packet) bool {
+		_, ok := packet.(*packets.ConnackPacket)
+		return ok
+	}).(*packets.ConnackPacket)
+}
+
+// ExpectMessage 等待消息
+func (c *Client) ExpectMessage() *packets.MessagePacket {
+	c.s.t.Helper()
+	return c.Expect("消息", func(packet packets.Packet) bool {
+		_, ok := packet.(*packets.MessagePacket)
+		return ok
+	}).(*packets.MessagePacket)
+}
+
+// ExpectMsgack 等待包含messageID的Msgack
+func (c *Client) ExpectMsgack(messageID uint64) *packets.MsgackPacket {
+	c.s.t.Helper()
+	return c.Expect(fmt.Sprintf("消息[%d]的Msgack", messageID), func(packet packets.Packet) bool {
+		msgack, ok := packet.(*packets.MsgackPacket)
+		if !ok {
+			return false
+		}
+		for _, id := range msgack.MessageIDs {
+			if id == messageID {
+				return true
+			}
+		}
+		return false
+	}).(*packets.MsgackPacket)
+}
+
+// ExpectCmdack 等待请求编号为requestID的Cmdack
+func (c *Client) ExpectCmdack(requestID uint64) *packets.CmdackPacket {
+	c.s.t.Helper()
+	return c.Expect(fmt.Sprintf("请求[%d]的Cmdack", requestID), func(packet packets.Packet) bool {
+		cmdack, ok := packet.(*packets.CmdackPacket)
+		return ok && cmdack.RequestID == requestID
+	}).(*packets.CmdackPacket)
+}
+
+// ExpectNoMessage 在d时间内没有收到消息 收到时测试失败
+func (c *Client) ExpectNoMessage(d time.Duration) {
+	c.s.t.Helper()
+	time.Sleep(d)
+	for _, packet := range c.Received() {
+		if msg, ok := packet.(*packets.MessagePacket); ok {
+			c.s.t.Fatalf("客户端[%d]不应该收到消息！-> %v", c.ID, msg)
+		}
+	}
+}
+
+// ExpectClosed 等待服务端断开连接
+func (c *Client) ExpectClosed() {
+	c.s.t.Helper()
+	select {
+	case <-c.done:
+	case <-time.After(c.s.Timeout):
+		c.s.t.Fatalf("客户端[%d]等待连接断开超时！", c.ID)
+	}
+}
+
+// Received 已收到还没有被Expect取出的包
+func (c *Client) Received() []packets.Packet {
+	c.Lock()
+	defer c.Unlock()
+	return append([]packets.Packet(nil), c.received...)
+}
+
+// Err 连接断开的原因 连接没有断开时为nil
+func (c *Client) Err() error {
+	select {
+	case <-c.done:
+	default:
+		return nil
+	}
+	c.Lock()
+	defer c.Unlock()
+	return c.err
+}
+
+// Close 断开连接
+func (c *Client) Close() error {
+	err := c.conn.Close()
+	<-c.done
+	return err
+}
@@ -0,0 +1,55 @@
+package tgotest
+
+import (
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/tgo-team/tgo-core/tgo"
+	"github.com/tgo-team/tgo-core/tgo/server"
+)
+
+// ErrServerStopped server已经停止
+var ErrServerStopped = errors.New("server已经停止！")
+
+// PipeServer 基于net.Pipe的内存server 不监听端口 通过Dial建立连接
+type PipeServer struct {
+	ctx     *tgo.Context
+	conns   *server.ConnSet
+	stopped bool
+	sync.Mutex
+}
+
+// NewPipeServer 创建内存server 例如: builder.Server(tgotest.NewPipeServer)
+func NewPipeServer(ctx *tgo.Context) tgo.Server {
+	return &PipeServer{
+		ctx:   ctx,
+		conns: server.NewConnSet(),
+	}
+}
+
+func (s *PipeServer) Start() error {
+	return nil
+}
+
+// Dial 建立一个连接 返回客户端一端 服务端一端和tcp一样交给TGO处理
+func (s *PipeServer) Dial() (net.Conn, error) {
+	s.Lock()
+	defer s.Unlock()
+	if s.stopped {
+		return nil, ErrServerStopped
+	}
+	serverConn, clientConn := net.Pipe()
+	conn := server.NewConn(serverConn, s.ctx, s.conns.Remove)
+	s.conns.Add(conn)
+	server.Accept(s.ctx, conn)
+	return clientConn, nil
+}
+
+func (s *PipeServer) Stop() error {
+	s.Lock()
+	s.stopped = true
+	s.Unlock()
+	s.conns.CloseAll()
+	return nil
+}
@@ -0,0 +1,134 @@
+// Package tgotest 端到端测试TGO的处理
+//
+// 在进程内启动一个使用内存存储（storage.NewMemory）和内存连接（PipeServer）的TGO，连接虚拟客户端收发包并在超时内断言收到的包：
+//
+//	s := tgotest.New(t, func(tg *tgo.TGO) {
+//		tg.Match("cmd:echo", func(m *tgo.MContext) {
+//			m.Reply(packets.CmdackStatusSuccess, m.CmdPacket().Payload)
+//		})
+//	})
+//	s.AddClient(1, "111")
+//	c := s.Connect(1, "111")
+//	requestID := c.Cmd("echo", []byte("hi"))
+//	cmdack := c.ExpectCmdack(requestID)
+package tgotest
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tgo-team/tgo-core/tgo"
+	"github.com/tgo-team/tgo-core/tgo/packets"
+	"github.com/tgo-team/tgo-core/tgo/protocol"
+	"github.com/tgo-team/tgo-core/tgo/storage"
+)
+
+// DefaultTimeout Expect等待包的默认超时时间
+const DefaultTimeout = 5 * time.Second
+
+// Server 测试用的TGO 测试结束时自动停止
+type Server struct {
+	TGO     *tgo.TGO
+	Pipe    *PipeServer
+	Timeout time.Duration // 虚拟客户端Expect等待包的超时时间
+	t       testing.TB
+}
+
+// New 使用默认配置启动 见NewWithOptions
+func New(t testing.TB, setup ...func(tg *tgo.TGO)) *Server {
+	return NewWithOptions(t, nil, setup...)
+}
+
+// NewWithOptions 启动测试用的TGO 已注册默认处理（MatchDefaultHandlers） setup在启动前调用，用于注册自定义处理
+// 不监听任何端口（TCP、WebSocket、HTTP地址会被清空） 管理接口可以通过TGO.HTTPMux()调用
+func NewWithOptions(t testing.TB, opts *tgo.Options, setup ...func(tg *tgo.TGO)) *Server {
+	t.Helper()
+	if opts == nil {
+		opts = tgo.NewOptions()
+		opts.LogLevel = tgo.ErrorLevel
+	}
+	if opts.DataPath == "" {
+		opts.DataPath = t.TempDir()
+	}
+	if opts.Pro == nil {
+		opts.Pro = protocol.New()
+	}
+	opts.TCPAddress = ""
+	opts.WebSocketAddress = ""
+	opts.HTTPAddress = ""
+	opts.HTTPSAddress = ""
+
+	s := &Server{Timeout: DefaultTimeout, t: t}
+	tg, err := tgo.NewBuilder(opts).Server(func(ctx *tgo.Context) tgo.Server {
+		s.Pipe = NewPipeServer(ctx).(*PipeServer)
+		return s.Pipe
+	}).Storage(storage.NewMemory).Build()
+	if err != nil {
+		t.Fatalf("创建TGO失败！-> %v", err)
+	}
+	s.TGO = tg
+	tg.MatchDefaultHandlers()
+	for _, fn := range setup {
+		fn(tg)
+	}
+	if err = tg.Start(); err != nil {
+		tg.Stop()
+		t.Fatalf("启动TGO失败！-> %v", err)
+	}
+	t.Cleanup(func() { tg.Stop() })
+	return s
+}
+
+// AddClient 添加客户端
+func (s *Server) AddClient(clientID uint64, password string) {
+	s.t.Helper()
+	if err := s.TGO.Storage.AddClient(tgo.NewClient(clientID, password)); err != nil {
+		s.t.Fatalf("添加客户端[%d]失败！-> %v", clientID, err)
+	}
+}
+
+// AddChannel 添加管道并绑定成员
+func (s *Server) AddChannel(channelID uint64, channelType int, clientIDs ...uint64) {
+	s.t.Helper()
+	if err := s.TGO.Storage.AddChannel(tgo.NewChannelModel(channelID, channelType)); err != nil {
+		s.t.Fatalf("添加管道[%d]失败！-> %v", channelID, err)
+	}
+	for _, clientID := range clientIDs {
+		if err := s.TGO.Bind(clientID, channelID); err != nil {
+			s.t.Fatalf("绑定客户端[%d]到管道[%d]失败！-> %v", clientID, channelID, err)
+		}
+	}
+}
+
+// Dial 建立没有认证的连接 第一个包需要是Connect包
+func (s *Server) Dial() *Client {
+	s.t.Helper()
+	conn, err := s.Pipe.Dial()
+	if err != nil {
+		s.t.Fatalf("建立连接失败！-> %v", err)
+	}
+	c := newClient(s, conn)
+	s.t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// Connect 建立连接并认证 认证失败时测试失败
+func (s *Server) Connect(clientID uint64, password string) *Client {
+	s.t.Helper()
+	c := s.Dial()
+	connect := packets.NewConnectPacket(clientID, password)
+	connect.PasswordFlag = password != ""
+	c.Write(connect)
+	if connack := c.ExpectConnack(); connack.ReturnCode != packets.ConnReturnCodeSuccess {
+		s.t.Fatalf("客户端[%d]认证失败！-> %v", clientID, connack)
+	}
+	c.ID = clientID
+	return c
+}
+
+var messageIDSequence = uint64(time.Now().UnixNano())
+
+func nextMessageID() uint64 {
+	return atomic.AddUint64(&messageIDSequence, 1)
+}
@@ -0,0 +1,88 @@
+package tgotest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tgo-team/tgo-core/tgo"
+	"github.com/tgo-team/tgo-core/tgo/packets"
+)
+
+func TestServer_messageAndCmd(t *testing.T) {
+	s := New(t, func(tg *tgo.TGO) {
+		tg.Match("cmd:echo", func(m *tgo.MContext) {
+			m.Reply(packets.CmdackStatusSuccess, m.CmdPacket().Payload)
+		})
+	})
+	s.AddClient(1, "111")
+	s.AddClient(2, "222")
+	c1 := s.Connect(1, "111")
+	c2 := s.Connect(2, "222")
+
+	messageID := c1.Send(2, []byte("hello"))
+	c1.ExpectMsgack(messageID)
+	msg := c2.ExpectMessage()
+	if msg.MessageID != messageID || msg.From != 1 || string(msg.Payload) != "hello" {
+		t.Fatalf("收到的消息不正确！-> %v", msg)
+	}
+	c2.Ack(msg.MessageID)
+	c1.ExpectNoMessage(20 * time.Millisecond)
+
+	cmdack := c1.ExpectCmdack(c1.Cmd("echo", []byte("ping")))
+	if cmdack.Status != packets.CmdackStatusSuccess || string(cmdack.Payload) != "ping" {
+		t.Fatalf("命令回复不正确！-> %v", cmdack)
+	}
+}
+
+func TestServer_authFailed(t *testing.T) {
+	s := New(t)
+	s.AddClient(1, "111")
+	c := s.Dial()
+	connect := packets.NewConnectPacket(1, "wrong")
+	connect.PasswordFlag = true
+	c.Write(connect)
+	if connack := c.ExpectConnack(); connack.ReturnCode != packets.ConnReturnCodePasswordOrUnameError {
+		t.Fatalf("密码错误应该返回%d，实际为%d", packets.ConnReturnCodePasswordOrUnameError, connack.ReturnCode)
+	}
+	c.ExpectClosed()
+}
+
+// TestServer_offlineMsg 连接前保存在个人管道的消息 连接后全部推送
+func TestServer_offlineMsg(t *testing.T) {
+	s := New(t)
+	var clientID uint64 = 100
+	s.AddClient(clientID, "123456")
+	s.AddChannel(clientID, tgo.ChannelTypePerson, clientID)
+	count := 999
+	for i := 1; i <= count; i++ {
+		if err := s.TGO.Storage.AddMsgInChannel(tgo.NewMsg(uint64(i), 99, []byte("hello")), clientID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := s.Connect(clientID, "123456")
+	received := map[uint64]bool{}
+	for len(received) < count {
+		msg := c.ExpectMessage()
+		received[msg.MessageID] = true
+		c.Ack(msg.MessageID)
+	}
+}
+
+func TestServer_group(t *testing.T) {
+	s := New(t)
+	var groupID uint64 = 1000
+	for clientID := uint64(1); clientID <= 3; clientID++ {
+		s.AddClient(clientID, "pwd")
+	}
+	s.AddChannel(groupID, tgo.ChannelTypeGroup, 1, 2, 3)
+	clients := []*Client{s.Connect(1, "pwd"), s.Connect(2, "pwd"), s.Connect(3, "pwd")}
+
+	messageID := clients[0].Send(groupID, []byte("hi"))
+	clients[0].ExpectMsgack(messageID)
+	for _, c := range clients[1:] {
+		if msg := c.ExpectMessage(); msg.MessageID != messageID || string(msg.Payload) != "hi" {
+			t.Fatalf("客户端[%d]收到的群组消息不正确！-> %v", c.ID, msg)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package tgo
+
+import (
+	"github.com/tgo-team/tgo-core/tgo/packets"
+	"sync"
+)
+
+const (
+	CmdTopicSubscribe   = "topic/subscribe"   // 订阅主题 payload为主题过滤器
+	CmdTopicUnsubscribe = "topic/unsubscribe" // 取消订阅主题 payload为主题过滤器
+)
+
+// topicManager 主题订阅和保留消息的主题索引
+type topicManager struct {
+	trie           *topicTrie
+	retainedTopics map[string]uint64 // 有保留消息的主题 -> 主题管道ID（保留消息本身通过TGO.GetRetainMsg获取）
+	retainedLock   sync.RWMutex
+}
+
+func newTopicManager() *topicManager {
+	return &topicManager{
+		trie:           newTopicTrie(),
+		retainedTopics: map[string]uint64{},
+	}
+}
+
+// setRetained 记录主题是否有保留消息
+func (tm *topicManager) setRetained(topic string, channelID uint64, retained bool) {
+	tm.retainedLock.Lock()
+	defer tm.retainedLock.Unlock()
+	if !retained {
+		delete(tm.retainedTopics, topic)
+		return
+	}
+	tm.retainedTopics[topic] = channelID
+}
+
+// matchRetained 获取匹配主题过滤器并且有保留消息的主题管道
+func (tm *topicManager) matchRetained(filter string) []uint64 {
+	tm.retainedLock.RLock()
+	defer tm.retainedLock.RUnlock()
+	channelIDs := make([]uint64, 0)
+	for topic, channelID := range tm.retainedTopics {
+		if TopicMatch(filter, topic) {
+			channelIDs = append(channelIDs, channelID)
+		}
+	}
+	return channelIDs
+}
+
+// loadRetainedTopics 启动时从存储重建有保留消息的主题索引（存储需要实现ChannelTypeStorage和RetainStorage）
+// 没有重建时只有加载过的主题管道才会加入索引，重启后订阅收不到保留消息
+func (t *TGO) loadRetainedTopics() error {
+	channelTypeStorage, ok := t.Storage.(ChannelTypeStorage)
+	if !ok {
+		return nil
+	}
+	if _, ok = t.Storage.(RetainStorage); !ok { // 保留消息只保存在内存时重启后没有保留消息
+		return nil
+	}
+	channelIDs, err := channelTypeStorage.GetChannelIDsByType(ChannelTypeTopic)
+	if err != nil {
+		return err
+	}
+	for _, channelID := range channelIDs {
+		msg, err := t.GetRetainMsg(channelID)
+		if err != nil {
+			return err
+		}
+		if msg == nil {
+			continue
+		}
+		model, err := t.Storage.GetChannel(channelID)
+		if err != nil {
+			return err
+		}
+		if model != nil {
+			t.topics.setRetained(model.Topic, channelID, true)
+		}
+	}
+	return nil
+}
+
+// SubscribeTopic 客户端订阅主题过滤器 客户端在线时立即推送匹配的保留消息
+func (t *TGO) SubscribeTopic(clientID uint64, filter string) error {
+	err := t.topics.trie.Subscribe(filter, clientID)
+	if err != nil {
+		return err
+	}
+	conn := t.ConnManager.GetConn(clientID)
+	if conn == nil {
+		return nil
+	}
+	for _, channelID := range t.topics.matchRetained(filter) {
+		err = t.pushRetainMsg(channelID, conn)
+		if err != nil {
+			t.Warn("推送管道[%d]的保留消息给客户端[%d]失败！-> %v", channelID, clientID, err)
+		}
+	}
+	return nil
+}
+
+// UnsubscribeTopic 客户端取消订阅主题过滤器
+func (t *TGO) UnsubscribeTopic(clientID uint64, filter string) {
+	t.topics.trie.Unsubscribe(filter, clientID)
+}
+
+// handleTopicSubscribe 处理订阅主题的命令
+func (t *TGO) handleTopicSubscribe(m *MContext) {
+	statefulConn, ok := m.Conn().(StatefulConn)
+	if !ok {
+		m.Reply(packets.CmdackStatusBadRequest, []byte("连接未认证！"))
+		return
+	}
+	err := t.SubscribeTopic(statefulConn.GetID(), string(m.CmdPacket().Payload))
+	if err != nil {
+		m.Reply(packets.CmdackStatusBadRequest, []byte(err.Error()))
+		return
+	}
+	m.Reply(packets.CmdackStatusSuccess, nil)
+}
+
+// handleTopicUnsubscribe 处理取消订阅主题的命令
+func (t *TGO) handleTopicUnsubscribe(m *MContext) {
+	statefulConn, ok := m.Conn().(StatefulConn)
+	if !ok {
+		m.Reply(packets.CmdackStatusBadRequest, []byte("连接未认证！"))
+		return
+	}
+	t.UnsubscribeTopic(statefulConn.GetID(), string(m.CmdPacket().Payload))
+	m.Reply(packets.CmdackStatusSuccess, nil)
+}
@@ -0,0 +1,182 @@
+package tgo
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+const (
+	topicLevelSeparator = "/"
+	topicSingleWildcard = "+" // 单层通配符
+	topicMultiWildcard  = "#" // 多层通配符 只能在最后一层
+	topicSystemPrefix   = "$" // 以$开头的主题不被首层通配符匹配
+)
+
+var (
+	ErrTopicEmpty         = errors.New("主题不能为空！")
+	ErrTopicFilterInvalid = errors.New("主题过滤器不合法！")
+	ErrTopicHasWildcard   = errors.New("发布的主题不能包含通配符！")
+)
+
+// topicNode 主题树节点
+type topicNode struct {
+	children map[string]*topicNode
+	clients  map[uint64]bool
+}
+
+func newTopicNode() *topicNode {
+	return &topicNode{
+		children: map[string]*topicNode{},
+		clients:  map[uint64]bool{},
+	}
+}
+
+// topicTrie 主题订阅树 支持MQTT风格的+和#通配符
+type topicTrie struct {
+	root *topicNode
+	sync.RWMutex
+}
+
+func newTopicTrie() *topicTrie {
+	return &topicTrie{root: newTopicNode()}
+}
+
+// ValidateTopicFilter 校验订阅的主题过滤器
+func ValidateTopicFilter(filter string) error {
+	if filter == "" {
+		return ErrTopicEmpty
+	}
+	levels := strings.Split(filter, topicLevelSeparator)
+	for i, level := range levels {
+		if strings.Contains(level, topicMultiWildcard) && (level != topicMultiWildcard || i != len(levels)-1) {
+			return ErrTopicFilterInvalid
+		}
+		if strings.Contains(level, topicSingleWildcard) && level != topicSingleWildcard {
+			return ErrTopicFilterInvalid
+		}
+	}
+	return nil
+}
+
+// ValidateTopic 校验发布的主题
+func ValidateTopic(topic string) error {
+	if topic == "" {
+		return ErrTopicEmpty
+	}
+	if strings.ContainsAny(topic, topicSingleWildcard+topicMultiWildcard) {
+		return ErrTopicHasWildcard
+	}
+	return nil
+}
+
+// Subscribe 客户端订阅主题过滤器
+func (t *topicTrie) Subscribe(filter string, clientID uint64) error {
+	if err := ValidateTopicFilter(filter); err != nil {
+		return err
+	}
+	t.Lock()
+	defer t.Unlock()
+	node := t.root
+	for _, level := range strings.Split(filter, topicLevelSeparator) {
+		child, ok := node.children[level]
+		if !ok {
+			child = newTopicNode()
+			node.children[level] = child
+		}
+		node = child
+	}
+	node.clients[clientID] = true
+	return nil
+}
+
+// Unsubscribe 客户端取消订阅主题过滤器
+func (t *topicTrie) Unsubscribe(filter string, clientID uint64) {
+	t.Lock()
+	defer t.Unlock()
+	t.unsubscribe(t.root, strings.Split(filter, topicLevelSeparator), clientID)
+}
+
+// unsubscribe 删除订阅 返回节点是否已经为空（可以被父节点删除）
+func (t *topicTrie) unsubscribe(node *topicNode, levels []string, clientID uint64) bool {
+	if len(levels) == 0 {
+		delete(node.clients, clientID)
+	} else if child, ok := node.children[levels[0]]; ok {
+		if t.unsubscribe(child, levels[1:], clientID) {
+			delete(node.children, levels[0])
+		}
+	}
+	return len(node.clients) == 0 && len(node.children) == 0
+}
+
+// UnsubscribeAll 取消客户端的所有订阅
+func (t *topicTrie) UnsubscribeAll(clientID uint64) {
+	t.Lock()
+	defer t.Unlock()
+	t.unsubscribeAll(t.root, clientID)
+}
+
+func (t *topicTrie) unsubscribeAll(node *topicNode, clientID uint64) bool {
+	delete(node.clients, clientID)
+	for level, child := range node.children {
+		if t.unsubscribeAll(child, clientID) {
+			delete(node.children, level)
+		}
+	}
+	return len(node.clients) == 0 && len(node.children) == 0
+}
+
+// Match 获取订阅了主题[topic]的所有客户端
+func (t *topicTrie) Match(topic string) []uint64 {
+	t.RLock()
+	defer t.RUnlock()
+	clientMap := map[uint64]bool{}
+	t.match(t.root, strings.Split(topic, topicLevelSeparator), 0, clientMap)
+	clientIDs := make([]uint64, 0, len(clientMap))
+	for clientID := range clientMap {
+		clientIDs = append(clientIDs, clientID)
+	}
+	return clientIDs
+}
+
+func (t *topicTrie) match(node *topicNode, levels []string, depth int, clientMap map[uint64]bool) {
+	systemTopic := depth == 0 && strings.HasPrefix(levels[0], topicSystemPrefix)
+	if multi, ok := node.children[topicMultiWildcard]; ok && !systemTopic { // #匹配剩下的所有层（包括父层本身）
+		for clientID := range multi.clients {
+			clientMap[clientID] = true
+		}
+	}
+	if depth == len(levels) {
+		for clientID := range node.clients {
+			clientMap[clientID] = true
+		}
+		return
+	}
+	if child, ok := node.children[levels[depth]]; ok {
+		t.match(child, levels, depth+1, clientMap)
+	}
+	if single, ok := node.children[topicSingleWildcard]; ok && !systemTopic {
+		t.match(single, levels, depth+1, clientMap)
+	}
+}
+
+// TopicMatch 主题过滤器[filter]是否匹配主题[topic]
+func TopicMatch(filter string, topic string) bool {
+	filterLevels := strings.Split(filter, topicLevelSeparator)
+	topicLevels := strings.Split(topic, topicLevelSeparator)
+	if strings.HasPrefix(topic, topicSystemPrefix) && (filterLevels[0] == topicSingleWildcard || filterLevels[0] == topicMultiWildcard) {
+		return false
+	}
+	for i, filterLevel := range filterLevels {
+		if filterLevel == topicMultiWildcard {
+			return true
+		}
+		if i >= len(topicLevels) {
+			return false
+		}
+		if filterLevel != topicSingleWildcard && filterLevel != topicLevels[i] {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
@@ -0,0 +1,74 @@
+package tgo
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestTopicTrie_Match(t *testing.T) {
+	trie := newTopicTrie()
+	subscribes := map[string]uint64{
+		"building/3/+/temperature": 1,
+		"building/#":               2,
+		"building/3/1/temperature": 3,
+		"#":                        4,
+		"building/+":               5,
+		"$SYS/#":                   6,
+	}
+	for filter, clientID := range subscribes {
+		if err := trie.Subscribe(filter, clientID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		topic     string
+		clientIDs []uint64
+	}{
+		{"building/3/1/temperature", []uint64{1, 2, 3, 4}},
+		{"building/3/2/temperature", []uint64{1, 2, 4}},
+		{"building/3/2/humidity", []uint64{2, 4}},
+		{"building/3", []uint64{2, 4, 5}},
+		{"building", []uint64{2, 4}},
+		{"$SYS/broker/load", []uint64{6}},
+	}
+	for _, test := range tests {
+		clientIDs := trie.Match(test.topic)
+		sort.Slice(clientIDs, func(i, j int) bool { return clientIDs[i] < clientIDs[j] })
+		if len(clientIDs) != len(test.clientIDs) {
+			t.Fatalf("主题[%s]应该匹配%v，实际为%v", test.topic, test.clientIDs, clientIDs)
+		}
+		for i := range clientIDs {
+			if clientIDs[i] != test.clientIDs[i] {
+				t.Fatalf("主题[%s]应该匹配%v，实际为%v", test.topic, test.clientIDs, clientIDs)
+			}
+		}
+		for filter, clientID := range subscribes {
+			matched := false
+			for _, id := range test.clientIDs {
+				matched = matched || id == clientID
+			}
+			if TopicMatch(filter, test.topic) != matched {
+				t.Fatalf("TopicMatch(%s,%s)应该为%v", filter, test.topic, matched)
+			}
+		}
+	}
+
+	trie.Unsubscribe("building/#", 2)
+	trie.UnsubscribeAll(4)
+	if clientIDs := trie.Match("building"); len(clientIDs) != 0 {
+		t.Fatalf("取消订阅后不应该再匹配，实际为%v", clientIDs)
+	}
+}
+
+func TestValidateTopicFilter(t *testing.T) {
+	for _, filter := range []string{"a/#", "+/b/+", "#", "a/+/c"} {
+		if err := ValidateTopicFilter(filter); err != nil {
+			t.Fatalf("[%s]应该合法 -> %v", filter, err)
+		}
+	}
+	for _, filter := range []string{"", "a/#/c", "a/b#", "a+/b"} {
+		if err := ValidateTopicFilter(filter); err == nil {
+			t.Fatalf("[%s]应该不合法", filter)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package tgo
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 消息处理链路上的阶段
+const (
+	SpanRouteServe      = "route.serve"      // Route处理消息包
+	SpanStorageAddMsg   = "storage.add_msg"  // 消息存入管道（Storage.AddMsgInChannel）
+	SpanStorageMsgChan  = "storage.msg_chan" // 存储成功后放入管道的投递队列
+	SpanChannelDelivery = "channel.delivery" // 管道投递消息（deliveryMsg）
+	SpanConnWrite       = "conn.write"       // 消息写入连接
+)
+
+// Span 消息处理链路上的一个阶段
+type Span struct {
+	TraceID   uint64        `json:"trace_id"`
+	SpanID    uint64        `json:"span_id"`
+	ParentID  uint64        `json:"parent_id"` // 消息链路的根Span为0
+	Name      string        `json:"name"`
+	MessageID uint64        `json:"message_id"`
+	ChannelID uint64        `json:"channel_id"`
+	ClientID  uint64        `json:"client_id"` // conn.write写入的客户端
+	Start     time.Time     `json:"start"`
+	Duration  time.Duration `json:"duration"`
+	Err       string        `json:"err,omitempty"`
+}
+
+// TraceExporter 导出已完成的Span
+type TraceExporter interface {
+	Export(span *Span)
+}
+
+// TraceQuerier 可以按消息ID查询Span的TraceExporter（内置的/debug/traces接口使用）
+type TraceQuerier interface {
+	SpansByMessageID(messageID uint64) []*Span
+}
+
+var traceIDSequence = uint64(time.Now().UnixNano())
+
+func newTraceID() uint64 {
+	return atomic.AddUint64(&traceIDSequence, 1)
+}
+
+// startSpan 开始消息[msg]的一个阶段 没有配置TraceExporter返回nil
+// msg没有TraceID时Span单独作为一条链路（不会修改msg）
+func (t *TGO) startSpan(name string, msg *Msg, channelID uint64) *Span {
+	if t.GetOpts().TraceExporter == nil {
+		return nil
+	}
+	span := &Span{
+		SpanID:    newTraceID(),
+		Name:      name,
+		ChannelID: channelID,
+		Start:     time.Now(),
+	}
+	if msg != nil {
+		span.MessageID = msg.MessageID
+		span.TraceID = msg.TraceID
+		span.ParentID = msg.SpanID
+	}
+	if span.TraceID == 0 {
+		span.TraceID = newTraceID()
+		span.ParentID = 0
+	}
+	return span
+}
+
+// startMsgSpan 同startSpan msg没有TraceID时以此Span为根开始消息的链路
+// 只能在msg还没有被共享时调用（例如PutMsg）
+func (t *TGO) startMsgSpan(name string, msg *Msg, channelID uint64) *Span {
+	span := t.startSpan(name, msg, channelID)
+	if span != nil && msg.TraceID == 0 {
+		msg.TraceID = span.TraceID
+		msg.SpanID = span.SpanID
+	}
+	return span
+}
+
+// finishSpan 结束Span并导出
+func (t *TGO) finishSpan(span *Span, err error) {
+	if span == nil {
+		return
+	}
+	span.Duration = time.Since(span.Start)
+	if err != nil {
+		span.Err = err.Error()
+	}
+	exporter := t.GetOpts().TraceExporter
+	if exporter != nil {
+		exporter.Export(span)
+	}
+}
+
+// handleTraces 按消息ID查询消息的处理链路 GET /debug/traces?message_id=1
+func (t *TGO) handleTraces(w http.ResponseWriter, r *http.Request) {
+	querier, ok := t.GetOpts().TraceExporter.(TraceQuerier)
+	if !ok {
+		http.Error(w, "TraceExporter不支持查询！", http.StatusNotImplemented)
+		return
+	}
+	messageID, err := strconv.ParseUint(r.URL.Query().Get("message_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "message_id格式不正确！", http.StatusBadRequest)
+		return
+	}
+	spans := querier.SpansByMessageID(messageID)
+	if spans == nil {
+		spans = []*Span{}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(spans)
+}
+
+// ---------- RingTraceExporter ----------
+
+// RingTraceExporter 内置的TraceExporter 在内存中保存最近的size个Span
+type RingTraceExporter struct {
+	spans []*Span
+	next  int
+	sync.RWMutex
+}
+
+func NewRingTraceExporter(size int) *RingTraceExporter {
+	if size <= 0 {
+		size = 1
+	}
+	return &RingTraceExporter{
+		spans: make([]*Span, size),
+	}
+}
+
+func (r *RingTraceExporter) Export(span *Span) {
+	r.Lock()
+	r.spans[r.next] = span
+	r.next = (r.next + 1) % len(r.spans)
+	r.Unlock()
+}
+
+// SpansByMessageID 查询消息的所有Span（按开始时间排序）
+func (r *RingTraceExporter) SpansByMessageID(messageID uint64) []*Span {
+	return r.filter(func(span *Span) bool {
+		return span.MessageID == messageID
+	})
+}
+
+// SpansByTraceID 查询链路的所有Span（按开始时间排序）
+func (r *RingTraceExporter) SpansByTraceID(traceID uint64) []*Span {
+	return r.filter(func(span *Span) bool {
+		return span.TraceID == traceID
+	})
+}
+
+func (r *RingTraceExporter) filter(match func(span *Span) bool) []*Span {
+	r.RLock()
+	var spans []*Span
+	for _, span := range r.spans {
+		if span != nil && match(span) {
+			spans = append(spans, span)
+		}
+	}
+	r.RUnlock()
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].Start.Before(spans[j].Start)
+	})
+	return spans
+}
@@ -0,0 +1,86 @@
+package tgo
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/tgo-team/tgo-core/tgo/packets"
+)
+
+func TestTGO_traceMsg(t *testing.T) {
+	opts := NewOptions()
+	opts.Pro = &ProtocolTest{}
+	opts.AdminToken = "token"
+	tg := startTGO(opts)
+	defer tg.Stop()
+
+	var clientID uint64 = 100
+	tg.Storage.AddChannel(NewChannelModel(clientID, ChannelTypePerson))
+	tg.Storage.Bind(clientID, clientID)
+	conn := &ServerConnTest{}
+	tg.ConnManager.AddConn(clientID, conn)
+
+	tg.Match("type:3", func(m *MContext) {
+		msg := m.Msg()
+		go func() { // MemoryStorage的StorageMsgChan没有缓冲，不能在msgLoop里存储
+			channel, err := tg.GetChannel(clientID)
+			if err == nil {
+				channel.PutMsg(msg)
+			}
+		}()
+	})
+	tg.AcceptPacketChan <- NewPacketContext(packets.NewMessagePacket(7, clientID, []byte("hello")), conn)
+
+	exporter := tg.GetOpts().TraceExporter.(*RingTraceExporter)
+	waitFor(t, func() bool { return len(exporter.SpansByMessageID(7)) == 5 })
+
+	spans := exporter.SpansByMessageID(7)
+	root := spans[0]
+	if root.Name != SpanRouteServe || root.ParentID != 0 {
+		t.Fatalf("根Span应该为%s，实际为%s", SpanRouteServe, root.Name)
+	}
+	names := map[string]bool{}
+	for _, span := range spans {
+		names[span.Name] = true
+		if span.TraceID != root.TraceID {
+			t.Fatalf("Span[%s]的TraceID不一致！", span.Name)
+		}
+		if span != root && span.ParentID != root.SpanID {
+			t.Fatalf("Span[%s]的ParentID不正确！", span.Name)
+		}
+	}
+	for _, name := range []string{SpanStorageAddMsg, SpanStorageMsgChan, SpanChannelDelivery, SpanConnWrite} {
+		if !names[name] {
+			t.Fatalf("缺少Span[%s]！", name)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "http://"+tg.HTTPAddr().String()+"/debug/traces?message_id=7", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var result []*Span
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 5 {
+		t.Fatalf("接口应该返回5个Span，实际为%d个", len(result))
+	}
+}
+
+func TestRingTraceExporter_overwrite(t *testing.T) {
+	exporter := NewRingTraceExporter(2)
+	for i := uint64(1); i <= 3; i++ {
+		exporter.Export(&Span{MessageID: i})
+	}
+	if len(exporter.SpansByMessageID(1)) != 0 {
+		t.Fatal("最早的Span应该被覆盖！")
+	}
+	if len(exporter.SpansByMessageID(3)) != 1 {
+		t.Fatal("没有查询到最新的Span！")
+	}
+}
@@ -0,0 +1,26 @@
+package tgo
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// 版本信息 编译时通过 -ldflags "-X github.com/tgo-team/tgo-core/tgo.Version=v1.0.0" 设置
+var (
+	Version   = "dev"
+	GitCommit = ""
+	BuildTime = ""
+)
+
+// VersionInfo 版本信息 例如: tgo dev (commit abc123, built 2026-01-01T00:00:00Z, go1.22 linux/amd64)
+func VersionInfo() string {
+	commit := GitCommit
+	if commit == "" {
+		commit = "unknown"
+	}
+	buildTime := BuildTime
+	if buildTime == "" {
+		buildTime = "unknown"
+	}
+	return fmt.Sprintf("tgo %s (commit %s, built %s, %s %s/%s)", Version, commit, buildTime, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}